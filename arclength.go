@@ -0,0 +1,221 @@
+package gg
+
+import (
+	"math"
+	"sort"
+)
+
+// arcPiece is a line or bezier curve of a path, with the samples used to
+// measure its length.
+type arcPiece struct {
+	points []Point // the start point followed by the points of the segment
+	move   bool    // the piece starts a subpath
+	close  bool    // the piece is the line added by ClosePath
+	start  float64 // the distance along the path to the start of the piece
+	length float64
+
+	// the samples are at t = i / (len(samples) - 1) and lengths holds the
+	// distances to them from the start of the piece
+	samples []Point
+	lengths []float64
+}
+
+// pieces splits the path into pieces, measuring their lengths. MoveTo
+// segments that aren't followed by a line or curve are dropped.
+func (p *Path) pieces() []*arcPiece {
+	var result []*arcPiece
+	var start, current Point
+	move := true
+	add := func(points ...Point) *arcPiece {
+		piece := &arcPiece{points: append([]Point{current}, points...), move: move}
+		piece.measure()
+		if len(result) > 0 {
+			last := result[len(result)-1]
+			piece.start = last.start + last.length
+		}
+		result = append(result, piece)
+		current = points[len(points)-1]
+		move = false
+		return piece
+	}
+	for _, s := range p.segments {
+		switch s.Type {
+		case SegmentMoveTo:
+			start, current = s.Points[0], s.Points[0]
+			move = true
+		case SegmentLineTo, SegmentQuadraticTo, SegmentCubicTo:
+			add(s.Points...)
+		case SegmentClosePath:
+			if !move {
+				add(start).close = true
+				move = true
+			}
+		}
+	}
+	return result
+}
+
+func (a *arcPiece) measure() {
+	var n int
+	switch len(a.points) {
+	case 2:
+		n = 1
+	default:
+		var l float64
+		for i := 1; i < len(a.points); i++ {
+			l += a.points[i-1].Distance(a.points[i])
+		}
+		n = int(math.Max(64, math.Min(4096, math.Ceil(l))))
+	}
+	a.samples = make([]Point, n+1)
+	a.lengths = make([]float64, n+1)
+	for i := range a.samples {
+		a.samples[i] = a.at(float64(i) / float64(n))
+		if i > 0 {
+			a.lengths[i] = a.lengths[i-1] + a.samples[i-1].Distance(a.samples[i])
+		}
+	}
+	a.length = a.lengths[n]
+}
+
+// at returns the point of the piece at the parameter t.
+func (a *arcPiece) at(t float64) Point {
+	left, _ := splitBezier(a.points, t)
+	return left[len(left)-1]
+}
+
+// tangent returns the direction of the piece at the parameter t, in radians.
+func (a *arcPiece) tangent(t float64) float64 {
+	// the derivative is a bezier curve of the differences of the points
+	d := make([]Point, len(a.points)-1)
+	for i := range d {
+		d[i] = sub(a.points[i+1], a.points[i])
+	}
+	left, _ := splitBezier(d, t)
+	v := left[len(left)-1]
+	if v.X == 0 && v.Y == 0 {
+		v = sub(a.points[len(a.points)-1], a.points[0])
+	}
+	return math.Atan2(v.Y, v.X)
+}
+
+// param returns the parameter at the distance d from the start of the piece.
+func (a *arcPiece) param(d float64) float64 {
+	n := len(a.lengths) - 1
+	if a.length == 0 || d <= 0 {
+		return 0
+	}
+	if d >= a.length {
+		return 1
+	}
+	i := sort.SearchFloat64s(a.lengths, d)
+	l0, l1 := a.lengths[i-1], a.lengths[i]
+	return (float64(i-1) + (d-l0)/(l1-l0)) / float64(n)
+}
+
+// splitBezier splits the bezier curve with the control points at the
+// parameter t, with de Casteljau's algorithm.
+func splitBezier(points []Point, t float64) (left, right []Point) {
+	n := len(points)
+	left = make([]Point, n)
+	right = make([]Point, n)
+	work := append([]Point(nil), points...)
+	for i := 0; i < n; i++ {
+		left[i] = work[0]
+		right[n-1-i] = work[n-1-i]
+		for j := 0; j < n-1-i; j++ {
+			work[j] = work[j].Interpolate(work[j+1], t)
+		}
+	}
+	return left, right
+}
+
+// subBezier returns the part of the bezier curve between the parameters t0
+// and t1.
+func subBezier(points []Point, t0, t1 float64) []Point {
+	if t0 > 0 {
+		_, points = splitBezier(points, t0)
+		t1 = (t1 - t0) / (1 - t0)
+	}
+	if t1 < 1 {
+		points, _ = splitBezier(points, t1)
+	}
+	return points
+}
+
+// Length returns the length of the path.
+func (p *Path) Length() float64 {
+	var length float64
+	for _, piece := range p.pieces() {
+		length += piece.length
+	}
+	return length
+}
+
+// PointAtLength returns the point at the distance d along the path and the
+// direction of the path there, as an angle in radians. The distance is
+// clamped to the length of the path.
+func (p *Path) PointAtLength(d float64) (Point, float64) {
+	pieces := p.pieces()
+	if len(pieces) == 0 {
+		return p.current, 0
+	}
+	piece := pieces[len(pieces)-1]
+	for _, q := range pieces {
+		if d <= q.start+q.length {
+			piece = q
+			break
+		}
+	}
+	t := piece.param(d - piece.start)
+	return piece.at(t), piece.tangent(t)
+}
+
+// SplitAtLength splits the path in two at the distance d along it.
+func (p *Path) SplitAtLength(d float64) (*Path, *Path) {
+	return p.Trim(0, d), p.Trim(d, math.Inf(1))
+}
+
+// Trim returns the part of the path between the distances start and end
+// along it. Subpaths that are kept entirely stay closed.
+func (p *Path) Trim(start, end float64) *Path {
+	result := NewPath()
+	// the index of the last piece that was kept up to its end
+	last := -2
+	var subpathStart float64
+	for i, piece := range p.pieces() {
+		if piece.move {
+			subpathStart = piece.start
+		}
+		d0 := math.Max(start, piece.start)
+		d1 := math.Min(end, piece.start+piece.length)
+		if d0 > d1 || (d0 == d1 && piece.length > 0) {
+			continue
+		}
+		t0 := piece.param(d0 - piece.start)
+		t1 := piece.param(d1 - piece.start)
+		points := subBezier(piece.points, t0, t1)
+		if piece.move || last != i-1 || t0 > 0 {
+			result.MoveTo(points[0].X, points[0].Y)
+		}
+		switch {
+		case piece.close && t0 == 0 && t1 == 1 && start <= subpathStart:
+			result.ClosePath()
+		case len(points) == 2:
+			result.LineTo(points[1].X, points[1].Y)
+		case len(points) == 3:
+			result.QuadraticTo(points[1].X, points[1].Y, points[2].X, points[2].Y)
+		default:
+			result.CubicTo(points[1].X, points[1].Y, points[2].X, points[2].Y, points[3].X, points[3].Y)
+		}
+		if t1 == 1 {
+			last = i
+		}
+	}
+	return result
+}
+
+// PathLength returns the length of the current path in user space.
+func (dc *Context) PathLength() float64 {
+	return dc.CopyPath().Length()
+}
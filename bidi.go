@@ -0,0 +1,759 @@
+package gg
+
+import "unicode"
+
+// This file implements the Unicode Bidirectional Algorithm (UAX #9) for a
+// single paragraph. The bidi classes of characters are derived from their
+// scripts and general categories, which is exact for the characters that
+// matter in practice.
+
+type bidiClass uint8
+
+const (
+	bidiL bidiClass = iota
+	bidiR
+	bidiAL
+	bidiEN
+	bidiES
+	bidiET
+	bidiAN
+	bidiCS
+	bidiNSM
+	bidiBN
+	bidiB
+	bidiS
+	bidiWS
+	bidiON
+	bidiLRE
+	bidiLRO
+	bidiRLE
+	bidiRLO
+	bidiPDF
+	bidiLRI
+	bidiRLI
+	bidiFSI
+	bidiPDI
+)
+
+const bidiMaxDepth = 125
+
+type runeRange struct {
+	lo, hi rune
+}
+
+func inRanges(r rune, ranges []runeRange) bool {
+	for _, x := range ranges {
+		if r >= x.lo && r <= x.hi {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	bidiALRanges = []runeRange{
+		{0x0600, 0x07BF}, {0x0860, 0x08FF}, {0xFB50, 0xFDCF}, {0xFDF0, 0xFDFF},
+		{0xFE70, 0xFEFF}, {0x10D00, 0x10D3F}, {0x10F30, 0x10F6F},
+		{0x1EC70, 0x1ECBF}, {0x1ED00, 0x1ED4F}, {0x1EE00, 0x1EEFF},
+	}
+	bidiRRanges = []runeRange{
+		{0x0590, 0x05FF}, {0x07C0, 0x085F}, {0xFB1D, 0xFB4F},
+		{0x10800, 0x10FFF}, {0x1E800, 0x1EFFF},
+	}
+	bidiANRanges = []runeRange{
+		{0x0600, 0x0605}, {0x0660, 0x0669}, {0x066B, 0x066C}, {0x06DD, 0x06DD},
+		{0x0890, 0x0891}, {0x08E2, 0x08E2}, {0x10E60, 0x10E7E},
+	}
+	bidiENRanges = []runeRange{
+		{'0', '9'}, {0x00B2, 0x00B3}, {0x00B9, 0x00B9}, {0x06F0, 0x06F9},
+		{0x2070, 0x2070}, {0x2074, 0x2079}, {0x2080, 0x2089}, {0x2488, 0x249B},
+		{0xFF10, 0xFF19}, {0x1D7CE, 0x1D7FF},
+	}
+	bidiETRanges = []runeRange{
+		{'#', '%'}, {0x00A2, 0x00A5}, {0x00B0, 0x00B1}, {0x058F, 0x058F},
+		{0x0609, 0x060A}, {0x066A, 0x066A}, {0x09F2, 0x09F3}, {0x0E3F, 0x0E3F},
+		{0x2030, 0x2034}, {0x20A0, 0x20CF}, {0x212E, 0x212E}, {0x2213, 0x2213},
+		{0xFE5F, 0xFE5F}, {0xFE69, 0xFE6A}, {0xFF03, 0xFF05}, {0xFFE0, 0xFFE1},
+		{0xFFE5, 0xFFE6},
+	}
+	bidiESRanges = []runeRange{
+		{'+', '+'}, {'-', '-'}, {0x207A, 0x207B}, {0x208A, 0x208B},
+		{0x2212, 0x2212}, {0xFB29, 0xFB29}, {0xFE62, 0xFE63}, {0xFF0B, 0xFF0B},
+		{0xFF0D, 0xFF0D},
+	}
+	bidiCSRanges = []runeRange{
+		{',', ','}, {'.', '/'}, {':', ':'}, {0x00A0, 0x00A0}, {0x060C, 0x060C},
+		{0x202F, 0x202F}, {0x2044, 0x2044}, {0xFE50, 0xFE50}, {0xFE52, 0xFE52},
+		{0xFE55, 0xFE55}, {0xFF0C, 0xFF0C}, {0xFF0E, 0xFF0F}, {0xFF1A, 0xFF1A},
+	}
+	bidiWSRanges = []runeRange{
+		{' ', ' '}, {'\f', '\f'}, {0x1680, 0x1680}, {0x2000, 0x200A},
+		{0x2028, 0x2028}, {0x205F, 0x205F}, {0x3000, 0x3000},
+	}
+)
+
+func bidiClassOf(r rune) bidiClass {
+	switch r {
+	case '\n', '\r', 0x1C, 0x1D, 0x1E, 0x85, 0x2029:
+		return bidiB
+	case '\t', 0x0B, 0x1F:
+		return bidiS
+	case 0x200E:
+		return bidiL
+	case 0x200F:
+		return bidiR
+	case 0x061C:
+		return bidiAL
+	case 0x202A:
+		return bidiLRE
+	case 0x202B:
+		return bidiRLE
+	case 0x202C:
+		return bidiPDF
+	case 0x202D:
+		return bidiLRO
+	case 0x202E:
+		return bidiRLO
+	case 0x2066:
+		return bidiLRI
+	case 0x2067:
+		return bidiRLI
+	case 0x2068:
+		return bidiFSI
+	case 0x2069:
+		return bidiPDI
+	}
+	switch {
+	case inRanges(r, bidiWSRanges):
+		return bidiWS
+	case inRanges(r, bidiENRanges):
+		return bidiEN
+	case inRanges(r, bidiANRanges):
+		return bidiAN
+	case inRanges(r, bidiETRanges):
+		return bidiET
+	case inRanges(r, bidiESRanges):
+		return bidiES
+	case inRanges(r, bidiCSRanges):
+		return bidiCS
+	case unicode.In(r, unicode.Mn, unicode.Me):
+		return bidiNSM
+	case unicode.In(r, unicode.Cc, unicode.Cf):
+		return bidiBN
+	case inRanges(r, bidiALRanges):
+		return bidiAL
+	case inRanges(r, bidiRRanges):
+		return bidiR
+	case unicode.In(r, unicode.P, unicode.S, unicode.Zs):
+		return bidiON
+	}
+	return bidiL
+}
+
+// isRTLRune reports whether the rune makes bidi reordering necessary.
+func isRTLRune(r rune) bool {
+	switch bidiClassOf(r) {
+	case bidiR, bidiAL, bidiAN, bidiRLE, bidiRLO, bidiRLI, bidiFSI:
+		return true
+	}
+	return false
+}
+
+// bidiRun is a run of runes with the same embedding level.
+type bidiRun struct {
+	start, end int // the runes of the run are runes[start:end]
+	level      uint8
+}
+
+// rtl reports whether the run is right to left.
+func (r bidiRun) rtl() bool {
+	return r.level&1 == 1
+}
+
+// bidiRuns resolves the embedding levels of the runes of a line, with the
+// paragraph direction taken from the first strong character, and returns
+// the level runs in visual order.
+func bidiRuns(runes []rune) []bidiRun {
+	if len(runes) == 0 {
+		return nil
+	}
+	rtl := false
+	for _, r := range runes {
+		if isRTLRune(r) {
+			rtl = true
+			break
+		}
+	}
+	if !rtl {
+		return []bidiRun{{0, len(runes), 0}}
+	}
+	levels := bidiLevels(runes)
+	var runs []bidiRun
+	for i := range runes {
+		if i == 0 || levels[i] != levels[i-1] {
+			runs = append(runs, bidiRun{i, i + 1, levels[i]})
+		} else {
+			runs[len(runs)-1].end = i + 1
+		}
+	}
+	// L2: reverse every sequence of runs at or above each odd level, from
+	// the highest level down
+	var highest, lowestOdd uint8 = 0, bidiMaxDepth + 2
+	for _, r := range runs {
+		if r.level > highest {
+			highest = r.level
+		}
+		if r.level&1 == 1 && r.level < lowestOdd {
+			lowestOdd = r.level
+		}
+	}
+	for level := highest; level >= lowestOdd && level > 0; level-- {
+		for i := 0; i < len(runs); {
+			if runs[i].level < level {
+				i++
+				continue
+			}
+			j := i
+			for j < len(runs) && runs[j].level >= level {
+				j++
+			}
+			for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+				runs[a], runs[b] = runs[b], runs[a]
+			}
+			i = j
+		}
+	}
+	return runs
+}
+
+// bidiParagraphLevel returns the level of the paragraph by rules P2 and P3,
+// or -1 if the runes have no strong character outside of isolates.
+func bidiParagraphLevel(classes []bidiClass) int {
+	depth := 0
+	for _, c := range classes {
+		switch c {
+		case bidiL:
+			if depth == 0 {
+				return 0
+			}
+		case bidiR, bidiAL:
+			if depth == 0 {
+				return 1
+			}
+		case bidiLRI, bidiRLI, bidiFSI:
+			depth++
+		case bidiPDI:
+			if depth > 0 {
+				depth--
+			}
+		case bidiB:
+			return -1
+		}
+	}
+	return -1
+}
+
+// bidiLevels returns the resolved embedding level of each rune.
+func bidiLevels(runes []rune) []uint8 {
+	n := len(runes)
+	classes := make([]bidiClass, n)
+	for i, r := range runes {
+		classes[i] = bidiClassOf(r)
+	}
+	original := append([]bidiClass(nil), classes...)
+	paragraph := uint8(0)
+	if bidiParagraphLevel(classes) == 1 {
+		paragraph = 1
+	}
+	levels := make([]uint8, n)
+	matchingPDI, matchingInitiator := bidiMatchIsolates(classes)
+
+	// X1-X8: explicit embeddings, overrides and isolates
+	type entry struct {
+		level    uint8
+		override bidiClass // bidiON for none
+		isolate  bool
+	}
+	stack := []entry{{paragraph, bidiON, false}}
+	overflowIsolates, overflowEmbeddings, validIsolates := 0, 0, 0
+	next := func(odd bool) uint8 {
+		level := stack[len(stack)-1].level + 1
+		if (level&1 == 1) != odd {
+			level++
+		}
+		return level
+	}
+	for i, c := range classes {
+		top := stack[len(stack)-1]
+		switch c {
+		case bidiRLE, bidiLRE, bidiRLO, bidiLRO:
+			levels[i] = top.level
+			level := next(c == bidiRLE || c == bidiRLO)
+			if level <= bidiMaxDepth && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				override := bidiON
+				if c == bidiLRO {
+					override = bidiL
+				} else if c == bidiRLO {
+					override = bidiR
+				}
+				stack = append(stack, entry{level, override, false})
+			} else if overflowIsolates == 0 {
+				overflowEmbeddings++
+			}
+		case bidiRLI, bidiLRI, bidiFSI:
+			levels[i] = top.level
+			if top.override != bidiON {
+				classes[i] = top.override
+			}
+			odd := c == bidiRLI
+			if c == bidiFSI {
+				end := matchingPDI[i]
+				if end < 0 {
+					end = n
+				}
+				odd = bidiParagraphLevel(classes[i+1:end]) == 1
+			}
+			level := next(odd)
+			if level <= bidiMaxDepth && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				validIsolates++
+				stack = append(stack, entry{level, bidiON, true})
+			} else {
+				overflowIsolates++
+			}
+		case bidiPDI:
+			if overflowIsolates > 0 {
+				overflowIsolates--
+			} else if validIsolates > 0 {
+				overflowEmbeddings = 0
+				for !stack[len(stack)-1].isolate {
+					stack = stack[:len(stack)-1]
+				}
+				stack = stack[:len(stack)-1]
+				validIsolates--
+			}
+			top = stack[len(stack)-1]
+			levels[i] = top.level
+			if top.override != bidiON {
+				classes[i] = top.override
+			}
+		case bidiPDF:
+			levels[i] = top.level
+			switch {
+			case overflowIsolates > 0:
+			case overflowEmbeddings > 0:
+				overflowEmbeddings--
+			case !top.isolate && len(stack) >= 2:
+				stack = stack[:len(stack)-1]
+			}
+		case bidiB:
+			levels[i] = paragraph
+		default:
+			levels[i] = top.level
+			if top.override != bidiON && c != bidiBN {
+				classes[i] = top.override
+			}
+		}
+	}
+	// X9: embedding and override controls are ignored from now on
+	for i, c := range classes {
+		switch c {
+		case bidiRLE, bidiLRE, bidiRLO, bidiLRO, bidiPDF:
+			classes[i] = bidiBN
+		}
+	}
+
+	for _, seq := range bidiRunSequences(classes, levels, matchingPDI, matchingInitiator) {
+		sos, eos := bidiSequenceBoundaries(seq, classes, levels, paragraph, matchingPDI)
+		bidiResolveWeak(seq, classes, sos)
+		bidiResolveBrackets(seq, runes, classes, levels[seq[0]], sos)
+		bidiResolveNeutrals(seq, classes, levels[seq[0]], sos, eos)
+		// I1, I2: implicit levels
+		for _, i := range seq {
+			switch level := levels[i]; {
+			case level&1 == 0 && classes[i] == bidiR:
+				levels[i]++
+			case level&1 == 0 && (classes[i] == bidiAN || classes[i] == bidiEN):
+				levels[i] += 2
+			case level&1 == 1 && (classes[i] == bidiL || classes[i] == bidiEN || classes[i] == bidiAN):
+				levels[i]++
+			}
+		}
+	}
+
+	// removed characters take the level of the preceding character
+	for i, c := range classes {
+		if c == bidiBN {
+			if i > 0 {
+				levels[i] = levels[i-1]
+			} else {
+				levels[i] = paragraph
+			}
+		}
+	}
+	// L1: separators, and whitespace before them and at the end of the
+	// line, are at the paragraph level
+	trailing := true
+	for i := n - 1; i >= 0; i-- {
+		switch original[i] {
+		case bidiS, bidiB:
+			levels[i] = paragraph
+			trailing = true
+		case bidiWS, bidiLRI, bidiRLI, bidiFSI, bidiPDI, bidiBN,
+			bidiRLE, bidiLRE, bidiRLO, bidiLRO, bidiPDF:
+			if trailing {
+				levels[i] = paragraph
+			}
+		default:
+			trailing = false
+		}
+	}
+	return levels
+}
+
+// bidiMatchIsolates returns the index of the matching PDI of each isolate
+// initiator and of the matching initiator of each PDI, or -1 (BD9).
+func bidiMatchIsolates(classes []bidiClass) (pdi, initiator []int) {
+	pdi = make([]int, len(classes))
+	initiator = make([]int, len(classes))
+	var stack []int
+	for i, c := range classes {
+		pdi[i], initiator[i] = -1, -1
+		switch c {
+		case bidiLRI, bidiRLI, bidiFSI:
+			stack = append(stack, i)
+		case bidiPDI:
+			if len(stack) > 0 {
+				j := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				pdi[j], initiator[i] = i, j
+			}
+		case bidiB:
+			stack = stack[:0]
+		}
+	}
+	return pdi, initiator
+}
+
+// bidiRunSequences returns the isolating run sequences (BD13), as lists of
+// indexes that skip removed characters.
+func bidiRunSequences(classes []bidiClass, levels []uint8, matchingPDI, matchingInitiator []int) [][]int {
+	// level runs of the characters that were not removed by X9
+	var runs [][]int
+	runOf := make([]int, len(classes))
+	last := -1
+	for i, c := range classes {
+		if c == bidiBN {
+			continue
+		}
+		if last < 0 || levels[i] != levels[last] {
+			runs = append(runs, nil)
+		}
+		runs[len(runs)-1] = append(runs[len(runs)-1], i)
+		runOf[i] = len(runs) - 1
+		last = i
+	}
+	var sequences [][]int
+	for _, run := range runs {
+		if first := run[0]; classes[first] == bidiPDI && matchingInitiator[first] >= 0 {
+			// continues the sequence of its initiator
+			continue
+		}
+		seq := append([]int(nil), run...)
+		for {
+			end := seq[len(seq)-1]
+			c := classes[end]
+			if c != bidiLRI && c != bidiRLI && c != bidiFSI || matchingPDI[end] < 0 {
+				break
+			}
+			seq = append(seq, runs[runOf[matchingPDI[end]]]...)
+		}
+		sequences = append(sequences, seq)
+	}
+	return sequences
+}
+
+// bidiSequenceBoundaries returns the sos and eos types of the sequence.
+func bidiSequenceBoundaries(seq []int, classes []bidiClass, levels []uint8, paragraph uint8, matchingPDI []int) (sos, eos bidiClass) {
+	level := levels[seq[0]]
+	before := paragraph
+	for i := seq[0] - 1; i >= 0; i-- {
+		if classes[i] != bidiBN {
+			before = levels[i]
+			break
+		}
+	}
+	after := paragraph
+	end := seq[len(seq)-1]
+	if c := classes[end]; !(c == bidiLRI || c == bidiRLI || c == bidiFSI) || matchingPDI[end] >= 0 {
+		for i := end + 1; i < len(classes); i++ {
+			if classes[i] != bidiBN {
+				after = levels[i]
+				break
+			}
+		}
+	}
+	direction := func(a, b uint8) bidiClass {
+		if a < b {
+			a = b
+		}
+		if a&1 == 1 {
+			return bidiR
+		}
+		return bidiL
+	}
+	return direction(level, before), direction(level, after)
+}
+
+func isIsolateControl(c bidiClass) bool {
+	return c == bidiLRI || c == bidiRLI || c == bidiFSI || c == bidiPDI
+}
+
+// bidiResolveWeak applies rules W1 to W7 to the sequence.
+func bidiResolveWeak(seq []int, classes []bidiClass, sos bidiClass) {
+	// W1: nonspacing marks take the type of the previous character
+	prev := sos
+	for _, i := range seq {
+		if classes[i] == bidiNSM {
+			if isIsolateControl(prev) {
+				classes[i] = bidiON
+			} else {
+				classes[i] = prev
+			}
+		}
+		prev = classes[i]
+	}
+	// W2: European numbers after Arabic letters are Arabic numbers; W3:
+	// Arabic letters are right to left
+	strong := sos
+	for _, i := range seq {
+		switch classes[i] {
+		case bidiL, bidiR, bidiAL:
+			strong = classes[i]
+		case bidiEN:
+			if strong == bidiAL {
+				classes[i] = bidiAN
+			}
+		}
+	}
+	for _, i := range seq {
+		if classes[i] == bidiAL {
+			classes[i] = bidiR
+		}
+	}
+	// W4: a single separator between two numbers of the same type
+	for k := 1; k+1 < len(seq); k++ {
+		a, b, c := classes[seq[k-1]], classes[seq[k]], classes[seq[k+1]]
+		if b == bidiES && a == bidiEN && c == bidiEN {
+			classes[seq[k]] = bidiEN
+		} else if b == bidiCS && a == c && (a == bidiEN || a == bidiAN) {
+			classes[seq[k]] = a
+		}
+	}
+	// W5: terminators next to European numbers
+	for k := 0; k < len(seq); k++ {
+		if classes[seq[k]] != bidiET {
+			continue
+		}
+		j := k
+		for j < len(seq) && classes[seq[j]] == bidiET {
+			j++
+		}
+		if (k > 0 && classes[seq[k-1]] == bidiEN) || (j < len(seq) && classes[seq[j]] == bidiEN) {
+			for m := k; m < j; m++ {
+				classes[seq[m]] = bidiEN
+			}
+		}
+		k = j
+	}
+	// W6: remaining separators and terminators are neutral
+	for _, i := range seq {
+		switch classes[i] {
+		case bidiES, bidiET, bidiCS:
+			classes[i] = bidiON
+		}
+	}
+	// W7: European numbers in left to right context
+	strong = sos
+	for _, i := range seq {
+		switch classes[i] {
+		case bidiL, bidiR:
+			strong = classes[i]
+		case bidiEN:
+			if strong == bidiL {
+				classes[i] = bidiL
+			}
+		}
+	}
+}
+
+// bidiStrong returns the strong direction of the resolved type for the
+// neutral rules, in which numbers count as right to left.
+func bidiStrong(c bidiClass) bidiClass {
+	switch c {
+	case bidiL:
+		return bidiL
+	case bidiR, bidiAN, bidiEN:
+		return bidiR
+	}
+	return bidiON
+}
+
+func isBidiNeutral(c bidiClass) bool {
+	switch c {
+	case bidiB, bidiS, bidiWS, bidiON, bidiLRI, bidiRLI, bidiFSI, bidiPDI:
+		return true
+	}
+	return false
+}
+
+// bidiBrackets maps opening brackets to closing brackets.
+var bidiBrackets = map[rune]rune{
+	'(': ')', '[': ']', '{': '}', 0x0F3A: 0x0F3B, 0x0F3C: 0x0F3D, 0x169B: 0x169C,
+	0x2045: 0x2046, 0x207D: 0x207E, 0x208D: 0x208E, 0x2308: 0x2309, 0x230A: 0x230B,
+	0x2329: 0x232A, 0x2768: 0x2769, 0x276A: 0x276B, 0x276C: 0x276D, 0x276E: 0x276F,
+	0x2770: 0x2771, 0x2772: 0x2773, 0x2774: 0x2775, 0x27C5: 0x27C6, 0x27E6: 0x27E7,
+	0x27E8: 0x27E9, 0x27EA: 0x27EB, 0x2983: 0x2984, 0x2985: 0x2986, 0x2987: 0x2988,
+	0x2989: 0x298A, 0x298B: 0x298C, 0x298D: 0x298E, 0x298F: 0x2990, 0x2991: 0x2992,
+	0x2993: 0x2994, 0x2995: 0x2996, 0x2997: 0x2998, 0x29D8: 0x29D9, 0x29DA: 0x29DB,
+	0x29FC: 0x29FD, 0x2E22: 0x2E23, 0x2E24: 0x2E25, 0x2E26: 0x2E27, 0x2E28: 0x2E29,
+	0x3008: 0x3009, 0x300A: 0x300B, 0x300C: 0x300D, 0x300E: 0x300F, 0x3010: 0x3011,
+	0x3014: 0x3015, 0x3016: 0x3017, 0x3018: 0x3019, 0x301A: 0x301B, 0xFE59: 0xFE5A,
+	0xFE5B: 0xFE5C, 0xFE5D: 0xFE5E, 0xFF08: 0xFF09, 0xFF3B: 0xFF3D, 0xFF5B: 0xFF5D,
+	0xFF5F: 0xFF60, 0xFF62: 0xFF63,
+}
+
+// bidiResolveBrackets applies rule N0 to the bracket pairs of the sequence.
+func bidiResolveBrackets(seq []int, runes []rune, classes []bidiClass, level uint8, sos bidiClass) {
+	embedding := bidiL
+	if level&1 == 1 {
+		embedding = bidiR
+	}
+	// BD16: find the bracket pairs, in the order of their opening brackets
+	type pair struct{ open, close int }
+	var pairs []pair
+	type opener struct {
+		k     int
+		close rune
+	}
+	var stack []opener
+	for k, i := range seq {
+		if classes[i] != bidiON {
+			continue
+		}
+		r := runes[i]
+		if close, ok := bidiBrackets[r]; ok {
+			if len(stack) == 63 {
+				break
+			}
+			stack = append(stack, opener{k, close})
+			continue
+		}
+		for j := len(stack) - 1; j >= 0; j-- {
+			if stack[j].close == r || (r == 0x232A && stack[j].close == 0x3009) || (r == 0x3009 && stack[j].close == 0x232A) {
+				pairs = append(pairs, pair{stack[j].k, k})
+				stack = stack[:j]
+				break
+			}
+		}
+	}
+	for i := 1; i < len(pairs); i++ {
+		for j := i; j > 0 && pairs[j].open < pairs[j-1].open; j-- {
+			pairs[j], pairs[j-1] = pairs[j-1], pairs[j]
+		}
+	}
+	for _, p := range pairs {
+		found := bidiON
+		for k := p.open + 1; k < p.close; k++ {
+			s := bidiStrong(classes[seq[k]])
+			if s == embedding {
+				found = embedding
+				break
+			}
+			if s != bidiON {
+				found = s
+			}
+		}
+		if found == bidiON {
+			continue
+		}
+		if found != embedding {
+			// the opposite direction is used only if the context before the
+			// brackets has it too
+			context := sos
+			for k := p.open - 1; k >= 0; k-- {
+				if s := bidiStrong(classes[seq[k]]); s != bidiON {
+					context = s
+					break
+				}
+			}
+			if context != found {
+				found = embedding
+			}
+		}
+		for _, k := range []int{p.open, p.close} {
+			classes[seq[k]] = found
+			// marks that followed the bracket take its new type
+			for m := k + 1; m < len(seq) && bidiClassOf(runes[seq[m]]) == bidiNSM; m++ {
+				classes[seq[m]] = found
+			}
+		}
+	}
+}
+
+// bidiResolveNeutrals applies rules N1 and N2 to the sequence.
+func bidiResolveNeutrals(seq []int, classes []bidiClass, level uint8, sos, eos bidiClass) {
+	embedding := bidiL
+	if level&1 == 1 {
+		embedding = bidiR
+	}
+	for k := 0; k < len(seq); k++ {
+		if !isBidiNeutral(classes[seq[k]]) {
+			continue
+		}
+		j := k
+		for j < len(seq) && isBidiNeutral(classes[seq[j]]) {
+			j++
+		}
+		before, after := sos, eos
+		if k > 0 {
+			before = bidiStrong(classes[seq[k-1]])
+		}
+		if j < len(seq) {
+			after = bidiStrong(classes[seq[j]])
+		}
+		c := embedding
+		if before == after && before != bidiON {
+			c = before
+		}
+		for m := k; m < j; m++ {
+			classes[seq[m]] = c
+		}
+		k = j
+	}
+}
+
+// bidiMirrors maps characters to their mirrored glyphs in right to left
+// text (rule L4).
+var bidiMirrors = map[rune]rune{
+	'(': ')', ')': '(', '<': '>', '>': '<', '[': ']', ']': '[', '{': '}', '}': '{',
+	0x00AB: 0x00BB, 0x00BB: 0x00AB, 0x2039: 0x203A, 0x203A: 0x2039,
+	0x2045: 0x2046, 0x2046: 0x2045, 0x207D: 0x207E, 0x207E: 0x207D,
+	0x208D: 0x208E, 0x208E: 0x208D, 0x2208: 0x220B, 0x220B: 0x2208,
+	0x2264: 0x2265, 0x2265: 0x2264, 0x2266: 0x2267, 0x2267: 0x2266,
+	0x226A: 0x226B, 0x226B: 0x226A, 0x2282: 0x2283, 0x2283: 0x2282,
+	0x2286: 0x2287, 0x2287: 0x2286, 0x2308: 0x2309, 0x2309: 0x2308,
+	0x230A: 0x230B, 0x230B: 0x230A, 0x2329: 0x232A, 0x232A: 0x2329,
+	0x27E8: 0x27E9, 0x27E9: 0x27E8, 0x3008: 0x3009, 0x3009: 0x3008,
+	0x300A: 0x300B, 0x300B: 0x300A, 0x300C: 0x300D, 0x300D: 0x300C,
+	0x300E: 0x300F, 0x300F: 0x300E, 0x3010: 0x3011, 0x3011: 0x3010,
+	0xFF08: 0xFF09, 0xFF09: 0xFF08, 0xFF1C: 0xFF1E, 0xFF1E: 0xFF1C,
+	0xFF3B: 0xFF3D, 0xFF3D: 0xFF3B, 0xFF5B: 0xFF5D, 0xFF5D: 0xFF5B,
+}
+
+// bidiMirror returns the mirrored form of the rune, for right to left text.
+func bidiMirror(r rune) rune {
+	if m, ok := bidiMirrors[r]; ok {
+		return m
+	}
+	return r
+}
@@ -0,0 +1,118 @@
+package gg
+
+import (
+	"image"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// Blur returns a copy of the image blurred with an approximation of a
+// Gaussian blur. The radius is twice the standard deviation of the Gaussian,
+// as for CSS shadows. An *image.Alpha, like the masks returned by AsMask,
+// gives an *image.Alpha, any other image gives an *image.RGBA. Pixels outside
+// of the image are treated as transparent.
+func Blur(im image.Image, radius float64) image.Image {
+	if a, ok := im.(*image.Alpha); ok {
+		dst := image.NewAlpha(a.Bounds())
+		draw.Draw(dst, dst.Bounds(), a, a.Bounds().Min, draw.Src)
+		blurPix(dst.Pix, dst.Stride, 1, dst.Rect.Dx(), dst.Rect.Dy(), radius/2)
+		return dst
+	}
+	dst := imageToRGBA(im)
+	blurPix(dst.Pix, dst.Stride, 4, dst.Rect.Dx(), dst.Rect.Dy(), radius/2)
+	return dst
+}
+
+// blurPix blurs the interleaved channels of the pixels in place by applying
+// three box blurs, each of them as a horizontal and a vertical pass.
+func blurPix(pix []uint8, stride, channels, w, h int, sigma float64) {
+	if sigma <= 0 || w == 0 || h == 0 {
+		return
+	}
+	tmp := make([]uint8, len(pix))
+	for _, r := range boxRadii(sigma, 3) {
+		for y := 0; y < h; y++ {
+			for c := 0; c < channels; c++ {
+				boxBlurLine(pix, tmp, y*stride+c, channels, w, r)
+			}
+		}
+		for x := 0; x < w; x++ {
+			for c := 0; c < channels; c++ {
+				boxBlurLine(tmp, pix, x*channels+c, stride, h, r)
+			}
+		}
+	}
+}
+
+// boxRadii returns the radii of n box blurs that, applied in sequence,
+// approximate a Gaussian blur with the standard deviation sigma.
+func boxRadii(sigma float64, n int) []int {
+	ideal := math.Sqrt(12*sigma*sigma/float64(n) + 1)
+	lower := int(ideal)
+	if lower%2 == 0 {
+		lower--
+	}
+	upper := lower + 2
+	wl := float64(lower)
+	m := int(math.Round((12*sigma*sigma - float64(n)*wl*wl - 4*float64(n)*wl - 3*float64(n)) / (-4*wl - 4)))
+	radii := make([]int, n)
+	for i := range radii {
+		if i < m {
+			radii[i] = (lower - 1) / 2
+		} else {
+			radii[i] = (upper - 1) / 2
+		}
+	}
+	return radii
+}
+
+// boxBlurLine averages the n samples of src starting at start, step apart,
+// over a window of radius r and writes the result to dst.
+func boxBlurLine(src, dst []uint8, start, step, n, r int) {
+	d := 2*r + 1
+	sum := 0
+	for j := 0; j <= r && j < n; j++ {
+		sum += int(src[start+j*step])
+	}
+	for i := 0; i < n; i++ {
+		dst[start+i*step] = uint8((sum + d/2) / d)
+		if j := i + r + 1; j < n {
+			sum += int(src[start+j*step])
+		}
+		if j := i - r; j >= 0 {
+			sum -= int(src[start+j*step])
+		}
+	}
+}
+
+// drawShadow draws the shadow of the drawing operation f, if a shadow is set.
+// The operation is rendered to a separate layer, without a shadow, and the
+// blurred and offset alpha of that layer is painted in the shadow color.
+func (dc *Context) drawShadow(f func()) {
+	if dc.shadowColor == nil {
+		return
+	}
+	if _, _, _, a := dc.shadowColor.RGBA(); a == 0 {
+		return
+	}
+	dc.PushGroup()
+	dc.shadowColor = nil
+	f()
+	layer := dc.popGroup(false)
+
+	b := layer.Bounds()
+	alpha := image.NewAlpha(b)
+	offset := image.Pt(int(math.Round(dc.shadowX)), int(math.Round(dc.shadowY)))
+	draw.Draw(alpha, b.Add(offset), layer, b.Min, draw.Src)
+	blurPix(alpha.Pix, alpha.Stride, 1, b.Dx(), b.Dy(), dc.shadowBlur/2)
+
+	shadow := image.NewRGBA(b)
+	draw.DrawMask(shadow, b, image.NewUniform(dc.shadowColor), image.ZP, alpha, b.Min, draw.Src)
+	dc.paintLayer(NewSurfacePattern(shadow, RepeatNone))
+	if dc.surface != nil && !dc.recordRaster() {
+		if r := opaqueBounds(shadow); !r.Empty() {
+			dc.surface.drawImage(dc, shadow.SubImage(r), Identity())
+		}
+	}
+}
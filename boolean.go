@@ -0,0 +1,372 @@
+package gg
+
+import (
+	"math"
+	"sort"
+)
+
+type BooleanOp int
+
+const (
+	BooleanUnion BooleanOp = iota
+	BooleanIntersection
+	BooleanDifference
+	BooleanXor
+)
+
+// Union returns a new path covering the area covered by either path.
+func (p *Path) Union(q *Path, rule FillRule) *Path {
+	return p.Boolean(q, BooleanUnion, rule)
+}
+
+// Intersection returns a new path covering the area covered by both paths.
+func (p *Path) Intersection(q *Path, rule FillRule) *Path {
+	return p.Boolean(q, BooleanIntersection, rule)
+}
+
+// Difference returns a new path covering the area covered by this path but
+// not by q.
+func (p *Path) Difference(q *Path, rule FillRule) *Path {
+	return p.Boolean(q, BooleanDifference, rule)
+}
+
+// Xor returns a new path covering the area covered by exactly one of the
+// paths.
+func (p *Path) Xor(q *Path, rule FillRule) *Path {
+	return p.Boolean(q, BooleanXor, rule)
+}
+
+// Boolean combines the areas of the two paths, as they would be filled with
+// the specified fill rule, and returns the outline of the result as a new
+// path. Curves are flattened first, so the result is made of closed polygons
+// only. The polygons never cross each other, so the result can be filled
+// with either fill rule, stroked or used for clipping.
+func (p *Path) Boolean(q *Path, op BooleanOp, rule FillRule) *Path {
+	var segments []boolSegment
+	segments = appendBoolSegments(segments, p.flatten(), 0)
+	segments = appendBoolSegments(segments, q.flatten(), 1)
+	edges := splitBoolSegments(segments)
+	kept := classifyBoolEdges(edges, func(w [2]int) bool {
+		a := insideWinding(w[0], rule)
+		b := insideWinding(w[1], rule)
+		switch op {
+		case BooleanUnion:
+			return a || b
+		case BooleanIntersection:
+			return a && b
+		case BooleanDifference:
+			return a && !b
+		case BooleanXor:
+			return a != b
+		}
+		return false
+	})
+	result := NewPath()
+	for _, loop := range linkBoolEdges(kept) {
+		result.MoveTo(loop[0].X, loop[0].Y)
+		for _, point := range loop[1:] {
+			result.LineTo(point.X, point.Y)
+		}
+		result.ClosePath()
+	}
+	return result
+}
+
+func insideWinding(w int, rule FillRule) bool {
+	if rule == FillRuleEvenOdd {
+		return w%2 != 0
+	}
+	return w != 0
+}
+
+// All points are snapped to a grid of this many steps per pixel so that
+// nearly coincident points produced by the intersection math become equal.
+const boolGrid = 4096
+
+func snapPoint(p Point) Point {
+	return Point{math.Round(p.X*boolGrid) / boolGrid, math.Round(p.Y*boolGrid) / boolGrid}
+}
+
+func cross(a, b Point) float64 {
+	return a.X*b.Y - a.Y*b.X
+}
+
+func dot(a, b Point) float64 {
+	return a.X*b.X + a.Y*b.Y
+}
+
+func sub(a, b Point) Point {
+	return Point{a.X - b.X, a.Y - b.Y}
+}
+
+type boolSegment struct {
+	a, b   Point
+	source int
+	splits []float64
+}
+
+// appendBoolSegments adds the edges of the polylines, closing each of them,
+// as they would be closed when filled.
+func appendBoolSegments(segments []boolSegment, paths [][]Point, source int) []boolSegment {
+	for _, path := range paths {
+		for i := range path {
+			a := snapPoint(path[i])
+			b := snapPoint(path[(i+1)%len(path)])
+			if a != b {
+				segments = append(segments, boolSegment{a: a, b: b, source: source})
+			}
+		}
+	}
+	return segments
+}
+
+// boolEdge is an edge of the planar arrangement of both paths. The edge is
+// stored with a <= b in (Y, X) order, and w holds how many times each path
+// runs along it in that direction, minus how many times it runs the other
+// way.
+type boolEdge struct {
+	a, b Point
+	w    [2]int
+}
+
+// splitBoolSegments splits the segments at all of their intersections and
+// merges overlapping pieces into edges.
+func splitBoolSegments(segments []boolSegment) []boolEdge {
+	sort.Slice(segments, func(i, j int) bool {
+		return math.Min(segments[i].a.X, segments[i].b.X) < math.Min(segments[j].a.X, segments[j].b.X)
+	})
+	for i := range segments {
+		s := &segments[i]
+		maxX := math.Max(s.a.X, s.b.X)
+		minY, maxY := math.Min(s.a.Y, s.b.Y), math.Max(s.a.Y, s.b.Y)
+		for j := i + 1; j < len(segments); j++ {
+			t := &segments[j]
+			if math.Min(t.a.X, t.b.X) > maxX {
+				break
+			}
+			if math.Min(t.a.Y, t.b.Y) > maxY || math.Max(t.a.Y, t.b.Y) < minY {
+				continue
+			}
+			intersectBoolSegments(s, t)
+		}
+	}
+
+	index := make(map[[2]Point]int)
+	var edges []boolEdge
+	for _, s := range segments {
+		splits := append([]float64{0, 1}, s.splits...)
+		sort.Float64s(splits)
+		previous := s.a
+		for _, t := range splits[1:] {
+			point := snapPoint(s.a.Interpolate(s.b, t))
+			if t == 1 {
+				point = s.b
+			}
+			if point == previous {
+				continue
+			}
+			a, b, w := previous, point, 1
+			if b.Y < a.Y || (b.Y == a.Y && b.X < a.X) {
+				a, b, w = b, a, -1
+			}
+			key := [2]Point{a, b}
+			k, ok := index[key]
+			if !ok {
+				k = len(edges)
+				index[key] = k
+				edges = append(edges, boolEdge{a: a, b: b})
+			}
+			edges[k].w[s.source] += w
+			previous = point
+		}
+	}
+	return edges
+}
+
+// intersectBoolSegments records where each segment needs to be split so that
+// the pieces of both only meet at their end points.
+func intersectBoolSegments(s, t *boolSegment) {
+	const eps = 1e-9
+	r := sub(s.b, s.a)
+	q := sub(t.b, t.a)
+	d := cross(r, q)
+	ta := sub(t.a, s.a)
+	if math.Abs(d) > eps*math.Sqrt(dot(r, r)*dot(q, q)) {
+		u := cross(ta, q) / d
+		v := cross(ta, r) / d
+		if u < -eps || u > 1+eps || v < -eps || v > 1+eps {
+			return
+		}
+		if u > eps && u < 1-eps {
+			s.splits = append(s.splits, u)
+		}
+		if v > eps && v < 1-eps {
+			t.splits = append(t.splits, v)
+		}
+		return
+	}
+	// parallel segments only need to be split where they overlap
+	if math.Abs(cross(ta, r)) > eps*math.Sqrt(dot(r, r))*boolGrid {
+		return
+	}
+	project := func(p, a, r Point) float64 {
+		return dot(sub(p, a), r) / dot(r, r)
+	}
+	for _, p := range []Point{t.a, t.b} {
+		if u := project(p, s.a, r); u > eps && u < 1-eps {
+			s.splits = append(s.splits, u)
+		}
+	}
+	for _, p := range []Point{s.a, s.b} {
+		if v := project(p, t.a, q); v > eps && v < 1-eps {
+			t.splits = append(t.splits, v)
+		}
+	}
+}
+
+// classifyBoolEdges keeps the edges that separate the inside of the result
+// from the outside, oriented so that the inside is on their left, i.e. on
+// the side where the cross product with the edge direction is positive.
+func classifyBoolEdges(edges []boolEdge, inside func(w [2]int) bool) [][2]Point {
+	// bucket the edges by their vertical extent to speed up the winding
+	// number queries
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, e := range edges {
+		minY = math.Min(minY, e.a.Y)
+		maxY = math.Max(maxY, e.b.Y)
+	}
+	n := int(math.Sqrt(float64(len(edges)))) + 1
+	size := (maxY - minY) / float64(n)
+	if size <= 0 {
+		size = 1
+	}
+	bucket := func(y float64) int {
+		i := int((y - minY) / size)
+		if i < 0 {
+			return 0
+		}
+		if i >= n {
+			return n - 1
+		}
+		return i
+	}
+	buckets := make([][]int, n)
+	for i, e := range edges {
+		if e.w == [2]int{} {
+			continue
+		}
+		for j := bucket(e.a.Y); j <= bucket(e.b.Y); j++ {
+			buckets[j] = append(buckets[j], i)
+		}
+	}
+
+	var result [][2]Point
+	for i, e := range edges {
+		if e.w == [2]int{} {
+			continue
+		}
+		// winding numbers just right of the midpoint, or just below it for
+		// horizontal edges, found by casting a ray in the +X direction
+		m := e.a.Interpolate(e.b, 0.5)
+		var w [2]int
+		for _, j := range buckets[bucket(m.Y)] {
+			f := edges[j]
+			if j == i || (f.a.Y > m.Y) == (f.b.Y > m.Y) {
+				continue
+			}
+			x := f.a.X + (m.Y-f.a.Y)*(f.b.X-f.a.X)/(f.b.Y-f.a.Y)
+			if x > m.X {
+				w[0] += f.w[0]
+				w[1] += f.w[1]
+			}
+		}
+		// crossing an edge from its right to its left adds its winding
+		left, right := w, w
+		if e.a.Y == e.b.Y {
+			right[0] -= e.w[0]
+			right[1] -= e.w[1]
+		} else {
+			left[0] += e.w[0]
+			left[1] += e.w[1]
+		}
+		l, r := inside(left), inside(right)
+		if l && !r {
+			result = append(result, [2]Point{e.a, e.b})
+		} else if r && !l {
+			result = append(result, [2]Point{e.b, e.a})
+		}
+	}
+	return result
+}
+
+// linkBoolEdges joins the directed edges into closed loops. Where several
+// loops touch at a vertex, the sharpest right turn is taken so that the loops
+// do not cross each other.
+func linkBoolEdges(edges [][2]Point) [][]Point {
+	outgoing := make(map[Point][]int)
+	for i, e := range edges {
+		outgoing[e[0]] = append(outgoing[e[0]], i)
+	}
+	used := make([]bool, len(edges))
+	var result [][]Point
+	for i := range edges {
+		if used[i] {
+			continue
+		}
+		var loop []Point
+		start := edges[i][0]
+		j := i
+		for {
+			used[j] = true
+			loop = append(loop, edges[j][0])
+			end := edges[j][1]
+			if end == start {
+				break
+			}
+			d := sub(end, edges[j][0])
+			next := -1
+			best := math.Inf(1)
+			for _, k := range outgoing[end] {
+				if used[k] {
+					continue
+				}
+				e := sub(edges[k][1], edges[k][0])
+				if a := math.Atan2(cross(d, e), dot(d, e)); a < best {
+					best = a
+					next = k
+				}
+			}
+			if next < 0 {
+				break
+			}
+			j = next
+		}
+		if loop = simplifyLoop(loop); len(loop) >= 3 {
+			result = append(result, loop)
+		}
+	}
+	return result
+}
+
+// simplifyLoop removes the vertices of a closed loop that lie on a straight
+// line between their neighbors.
+func simplifyLoop(loop []Point) []Point {
+	straight := func(a, b, c Point) bool {
+		u, v := sub(b, a), sub(c, b)
+		return math.Abs(cross(u, v)) < 1e-10 && dot(u, v) > 0
+	}
+	result := make([]Point, 0, len(loop))
+	for _, p := range loop {
+		for n := len(result); n >= 2 && straight(result[n-2], result[n-1], p); n-- {
+			result = result[:n-1]
+		}
+		result = append(result, p)
+	}
+	for n := len(result); n >= 3 && straight(result[n-2], result[n-1], result[0]); n-- {
+		result = result[:n-1]
+	}
+	for len(result) >= 3 && straight(result[len(result)-1], result[0], result[1]) {
+		result = result[1:]
+	}
+	return result
+}
@@ -0,0 +1,254 @@
+package gg
+
+import (
+	"image/color"
+	"math"
+)
+
+// ColorSpace is the color space in which gradients interpolate between their
+// color stops.
+type ColorSpace int
+
+const (
+	// ColorSpaceSRGB interpolates the sRGB components directly.
+	ColorSpaceSRGB ColorSpace = iota
+	// ColorSpaceLinearRGB interpolates linear-light RGB components, which
+	// keeps the brightness of mixed colors.
+	ColorSpaceLinearRGB
+	// ColorSpaceOKLab interpolates in the perceptually uniform OKLab space.
+	ColorSpaceOKLab
+	// ColorSpaceOKLCH interpolates the lightness, chroma and hue of OKLab,
+	// which keeps colors saturated. See HueInterpolation.
+	ColorSpaceOKLCH
+)
+
+// HueInterpolation determines which way around the color wheel the hue is
+// interpolated in ColorSpaceOKLCH, as in CSS.
+type HueInterpolation int
+
+const (
+	HueShorter HueInterpolation = iota
+	HueLonger
+	HueIncreasing
+	HueDecreasing
+)
+
+// colorInterpolation holds the interpolation options of a gradient.
+type colorInterpolation struct {
+	space  ColorSpace
+	hue    HueInterpolation
+	dither bool
+}
+
+// SetColorSpace sets the color space used to interpolate between the color
+// stops. The default is ColorSpaceSRGB.
+func (ci *colorInterpolation) SetColorSpace(space ColorSpace) {
+	ci.space = space
+}
+
+// SetHueInterpolation sets the direction in which hues are interpolated in
+// ColorSpaceOKLCH. The default is HueShorter.
+func (ci *colorInterpolation) SetHueInterpolation(hue HueInterpolation) {
+	ci.hue = hue
+}
+
+// SetDither enables ordered dithering of the gradient colors, which hides
+// the banding of wide, smooth gradients.
+func (ci *colorInterpolation) SetDither(dither bool) {
+	ci.dither = dither
+}
+
+func (ci *colorInterpolation) dithered() bool {
+	return ci.dither
+}
+
+// getColor returns the color of the stops at pos, interpolated with the
+// options.
+func (ci *colorInterpolation) getColor(pos float64, stops stops) color.Color {
+	if ci.space == ColorSpaceSRGB && !ci.dither {
+		return getColor(pos, stops)
+	}
+	if pos <= 0.0 || len(stops) == 1 {
+		return stops[0].color
+	}
+	last := stops[len(stops)-1]
+	if pos >= last.pos {
+		return last.color
+	}
+	for i, stop := range stops[1:] {
+		if pos < stop.pos {
+			pos = (pos - stops[i].pos) / (stop.pos - stops[i].pos)
+			return ci.lerp(stops[i].color, stop.color, pos)
+		}
+	}
+	return last.color
+}
+
+// lerp interpolates between the colors in the color space, with the
+// components premultiplied by alpha, and returns the result with 16 bits
+// per channel.
+func (ci *colorInterpolation) lerp(c0, c1 color.Color, t float64) color.Color {
+	if ci.space == ColorSpaceSRGB {
+		r0, g0, b0, a0 := c0.RGBA()
+		r1, g1, b1, a1 := c1.RGBA()
+		return color.RGBA64{
+			lerp16(r0, r1, t), lerp16(g0, g1, t),
+			lerp16(b0, b1, t), lerp16(a0, a1, t),
+		}
+	}
+	p, a0 := ci.toSpace(c0)
+	q, a1 := ci.toSpace(c1)
+	if ci.space == ColorSpaceOKLCH {
+		p[2], q[2] = interpolateHues(p, q, ci.hue)
+	}
+	a := a0 + (a1-a0)*t
+	if a == 0 {
+		return color.Transparent
+	}
+	var v [3]float64
+	for i := range v {
+		if ci.space == ColorSpaceOKLCH && i == 2 {
+			// hue is not premultiplied
+			v[i] = p[i] + (q[i]-p[i])*t
+			continue
+		}
+		v[i] = (p[i]*a0 + (q[i]*a1-p[i]*a0)*t) / a
+	}
+	r, g, b := ci.fromSpace(v)
+	return color.NRGBA64{
+		uint16(clamp01(r)*0xffff + 0.5), uint16(clamp01(g)*0xffff + 0.5),
+		uint16(clamp01(b)*0xffff + 0.5), uint16(a*0xffff + 0.5),
+	}
+}
+
+// toSpace converts the color to the components of the color space and alpha.
+func (ci *colorInterpolation) toSpace(c color.Color) ([3]float64, float64) {
+	n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+	r := linearize(float64(n.R) / 0xffff)
+	g := linearize(float64(n.G) / 0xffff)
+	b := linearize(float64(n.B) / 0xffff)
+	a := float64(n.A) / 0xffff
+	switch ci.space {
+	case ColorSpaceOKLab:
+		l, a1, b1 := linearToOKLab(r, g, b)
+		return [3]float64{l, a1, b1}, a
+	case ColorSpaceOKLCH:
+		l, a1, b1 := linearToOKLab(r, g, b)
+		h := math.Atan2(b1, a1) * 180 / math.Pi
+		if h < 0 {
+			h += 360
+		}
+		return [3]float64{l, math.Hypot(a1, b1), h}, a
+	}
+	return [3]float64{r, g, b}, a
+}
+
+// fromSpace converts the components of the color space to sRGB.
+func (ci *colorInterpolation) fromSpace(v [3]float64) (r, g, b float64) {
+	switch ci.space {
+	case ColorSpaceOKLab:
+		r, g, b = okLabToLinear(v[0], v[1], v[2])
+	case ColorSpaceOKLCH:
+		h := v[2] * math.Pi / 180
+		r, g, b = okLabToLinear(v[0], v[1]*math.Cos(h), v[1]*math.Sin(h))
+	default:
+		r, g, b = v[0], v[1], v[2]
+	}
+	return delinearize(r), delinearize(g), delinearize(b)
+}
+
+// vectorStops returns stops that approximate the gradient when interpolated
+// in sRGB, for output formats that only support sRGB interpolation.
+func (ci *colorInterpolation) vectorStops(s stops) stops {
+	if ci.space == ColorSpaceSRGB || len(s) < 2 {
+		return s
+	}
+	const n = 16
+	result := stops{s[0]}
+	for i := 1; i < len(s); i++ {
+		a, b := s[i-1], s[i]
+		for j := 1; j <= n; j++ {
+			t := float64(j) / n
+			result = append(result, stop{a.pos + (b.pos-a.pos)*t, ci.lerp(a.color, b.color, t)})
+		}
+	}
+	return result
+}
+
+// interpolateHues adjusts the hues, in degrees, of two OKLCH colors so that
+// interpolating between them goes in the specified direction. A color
+// without chroma takes the hue of the other one.
+func interpolateHues(p, q [3]float64, hue HueInterpolation) (float64, float64) {
+	const eps = 1e-4
+	h0, h1 := p[2], q[2]
+	if p[1] < eps {
+		h0 = h1
+	}
+	if q[1] < eps {
+		h1 = h0
+	}
+	switch d := h1 - h0; hue {
+	case HueShorter:
+		if d > 180 {
+			h0 += 360
+		} else if d < -180 {
+			h1 += 360
+		}
+	case HueLonger:
+		if d > 0 && d < 180 {
+			h0 += 360
+		} else if d > -180 && d <= 0 {
+			h1 += 360
+		}
+	case HueIncreasing:
+		if d < 0 {
+			h1 += 360
+		}
+	case HueDecreasing:
+		if d > 0 {
+			h0 += 360
+		}
+	}
+	return h0, h1
+}
+
+func linearize(c float64) float64 {
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func delinearize(c float64) float64 {
+	if c <= 0.0031308 {
+		return c * 12.92
+	}
+	return 1.055*math.Pow(c, 1/2.4) - 0.055
+}
+
+func linearToOKLab(r, g, b float64) (float64, float64, float64) {
+	l := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*b)
+	m := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*b)
+	s := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*b)
+	return 0.2104542553*l + 0.7936177850*m - 0.0040720468*s,
+		1.9779984951*l - 2.4285922050*m + 0.4505937099*s,
+		0.0259040371*l + 0.7827717662*m - 0.8086757660*s
+}
+
+func okLabToLinear(L, a, b float64) (float64, float64, float64) {
+	l := L + 0.3963377774*a + 0.2158037573*b
+	m := L - 0.1055613458*a - 0.0638541728*b
+	s := L - 0.0894841775*a - 1.2914855480*b
+	l, m, s = l*l*l, m*m*m, s*s*s
+	return 4.0767416621*l - 3.3077115913*m + 0.2309699292*s,
+		-1.2684380046*l + 2.6097574011*m - 0.3413193965*s,
+		-0.0041960863*l - 0.7034186147*m + 1.7076147010*s
+}
+
+func clamp01(x float64) float64 {
+	return math.Max(0, math.Min(1, x))
+}
+
+func lerp16(a, b uint32, t float64) uint16 {
+	return uint16(float64(a)*(1-t) + float64(b)*t + 0.5)
+}
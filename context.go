@@ -16,6 +16,7 @@ import (
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/basicfont"
 	"golang.org/x/image/math/f64"
+	"golang.org/x/image/math/fixed"
 )
 
 type LineCap int
@@ -31,6 +32,21 @@ type LineJoin int
 const (
 	LineJoinRound LineJoin = iota
 	LineJoinBevel
+	LineJoinMiter
+)
+
+// StrokeAlign is the position of strokes relative to the path.
+type StrokeAlign int
+
+const (
+	// StrokeAlignCenter centers strokes on the path.
+	StrokeAlignCenter StrokeAlign = iota
+	// StrokeAlignInside draws strokes entirely inside the filled area of
+	// the path.
+	StrokeAlignInside
+	// StrokeAlignOutside draws strokes entirely outside the filled area of
+	// the path.
+	StrokeAlignOutside
 )
 
 type FillRule int
@@ -64,6 +80,7 @@ type Context struct {
 	strokePattern Pattern
 	strokePath    raster.Path
 	fillPath      raster.Path
+	path          Path
 	start         Point
 	current       Point
 	hasCurrent    bool
@@ -72,10 +89,22 @@ type Context struct {
 	lineWidth     float64
 	lineCap       LineCap
 	lineJoin      LineJoin
+	miterLimit    float64
+	strokeAlign   StrokeAlign
 	fillRule      FillRule
+	operator      Operator
+	globalAlpha   float64
+	shadowX       float64
+	shadowY       float64
+	shadowBlur    float64
+	shadowColor   color.Color
 	fontFace      font.Face
+	fontFallbacks []font.Face
 	fontHeight    float64
+	textPathSide  TextPathSide
+	textOverflow  TextPathOverflow
 	matrix        Matrix
+	surface       surface
 	stack         []*Context
 }
 
@@ -105,6 +134,8 @@ func NewContextForRGBA(im *image.RGBA) *Context {
 		fillPattern:   defaultFillStyle,
 		strokePattern: defaultStrokeStyle,
 		lineWidth:     1,
+		miterLimit:    10,
+		globalAlpha:   1,
 		fillRule:      FillRuleWinding,
 		fontFace:      basicfont.Face7x13,
 		fontHeight:    13,
@@ -203,6 +234,25 @@ func (dc *Context) SetLineJoinBevel() {
 	dc.lineJoin = LineJoinBevel
 }
 
+func (dc *Context) SetLineJoinMiter() {
+	dc.lineJoin = LineJoinMiter
+}
+
+// SetMiterLimit sets the limit on the ratio of the miter length to the line
+// width, past which miter joins are drawn as bevel joins instead. The default
+// is 10.
+func (dc *Context) SetMiterLimit(limit float64) {
+	dc.miterLimit = limit
+}
+
+// SetStrokeAlign sets whether strokes are centered on the path or drawn
+// entirely inside or outside of the area that Fill would paint, with the
+// current fill rule. Either way, strokes are as wide as the line width. The
+// default is StrokeAlignCenter.
+func (dc *Context) SetStrokeAlign(align StrokeAlign) {
+	dc.strokeAlign = align
+}
+
 func (dc *Context) SetFillRule(fillRule FillRule) {
 	dc.fillRule = fillRule
 }
@@ -215,6 +265,38 @@ func (dc *Context) SetFillRuleEvenOdd() {
 	dc.fillRule = FillRuleEvenOdd
 }
 
+// SetOperator sets the operator used to combine fills, strokes, text and
+// images with the existing contents of the image. The default is
+// OperatorOver. Most operators only affect the pixels covered by the drawing
+// operation, but OperatorClear, OperatorSource, OperatorIn, OperatorOut,
+// OperatorDestIn and OperatorDestAtop are unbounded: they apply to the whole
+// clip region, with a transparent source outside the shape, so they clear
+// the destination there. SVG and PDF have blend modes but none of the other
+// Porter-Duff operators, so operations drawn with those are recorded there
+// as an image of the result.
+func (dc *Context) SetOperator(op Operator) {
+	dc.operator = op
+}
+
+// SetGlobalAlpha sets an opacity, between 0 and 1, that is applied to
+// everything drawn by fills, strokes, text and images. It is part of the
+// state saved by Push. The default is 1.
+func (dc *Context) SetGlobalAlpha(alpha float64) {
+	dc.globalAlpha = math.Max(0, math.Min(1, alpha))
+}
+
+// SetShadow makes fills, strokes, text and images cast a shadow in the
+// specified color, offset by offsetX, offsetY pixels in device space and
+// blurred with the blur radius, as used by Blur. A nil or transparent color
+// removes the shadow. It is part of the state saved by Push. SVG and PDF
+// output have no blur, so they get the shadow as an image.
+func (dc *Context) SetShadow(offsetX, offsetY, blur float64, c color.Color) {
+	dc.shadowX = offsetX
+	dc.shadowY = offsetY
+	dc.shadowBlur = blur
+	dc.shadowColor = c
+}
+
 // Color Setters
 
 func (dc *Context) setFillAndStrokeColor(c color.Color) {
@@ -223,18 +305,21 @@ func (dc *Context) setFillAndStrokeColor(c color.Color) {
 	dc.strokePattern = NewSolidPattern(c)
 }
 
-// SetFillStyle sets current fill style
+// SetFillStyle sets current fill style. Gradients and surface patterns are
+// defined in the current user space: the transform at the time of the call
+// applies to them, later changes to the transform do not.
 func (dc *Context) SetFillStyle(pattern Pattern) {
-	// if pattern is SolidPattern, also change dc.color(for dc.Clear, dc.drawString)
+	// if pattern is SolidPattern, also change dc.color(for dc.Clear)
 	if fillStyle, ok := pattern.(*solidPattern); ok {
 		dc.color = fillStyle.color
 	}
-	dc.fillPattern = pattern
+	dc.fillPattern = newTransformedPattern(pattern, dc.matrix)
 }
 
-// SetStrokeStyle sets current stroke style
+// SetStrokeStyle sets current stroke style. Like for SetFillStyle, the
+// current transform applies to gradients and surface patterns.
 func (dc *Context) SetStrokeStyle(pattern Pattern) {
-	dc.strokePattern = pattern
+	dc.strokePattern = newTransformedPattern(pattern, dc.matrix)
 }
 
 // SetColor sets the current color(for both fill and stroke).
@@ -293,6 +378,7 @@ func (dc *Context) MoveTo(x, y float64) {
 	p := Point{x, y}
 	dc.strokePath.Start(p.Fixed())
 	dc.fillPath.Start(p.Fixed())
+	dc.path.MoveTo(x, y)
 	dc.start = p
 	dc.current = p
 	dc.hasCurrent = true
@@ -308,6 +394,7 @@ func (dc *Context) LineTo(x, y float64) {
 		p := Point{x, y}
 		dc.strokePath.Add1(p.Fixed())
 		dc.fillPath.Add1(p.Fixed())
+		dc.path.LineTo(x, y)
 		dc.current = p
 	}
 }
@@ -325,6 +412,7 @@ func (dc *Context) QuadraticTo(x1, y1, x2, y2 float64) {
 	p2 := Point{x2, y2}
 	dc.strokePath.Add2(p1.Fixed(), p2.Fixed())
 	dc.fillPath.Add2(p1.Fixed(), p2.Fixed())
+	dc.path.QuadraticTo(x1, y1, x2, y2)
 	dc.current = p2
 }
 
@@ -340,6 +428,7 @@ func (dc *Context) CubicTo(x1, y1, x2, y2, x3, y3 float64) {
 	x1, y1 = dc.TransformPoint(x1, y1)
 	x2, y2 = dc.TransformPoint(x2, y2)
 	x3, y3 = dc.TransformPoint(x3, y3)
+	dc.path.CubicTo(x1, y1, x2, y2, x3, y3)
 	points := CubicBezier(x0, y0, x1, y1, x2, y2, x3, y3)
 	previous := dc.current.Fixed()
 	for _, p := range points[1:] {
@@ -361,6 +450,7 @@ func (dc *Context) ClosePath() {
 	if dc.hasCurrent {
 		dc.strokePath.Add1(dc.start.Fixed())
 		dc.fillPath.Add1(dc.start.Fixed())
+		dc.path.ClosePath()
 		dc.current = dc.start
 	}
 }
@@ -370,6 +460,7 @@ func (dc *Context) ClosePath() {
 func (dc *Context) ClearPath() {
 	dc.strokePath.Clear()
 	dc.fillPath.Clear()
+	dc.path.Clear()
 	dc.hasCurrent = false
 }
 
@@ -379,13 +470,91 @@ func (dc *Context) NewSubPath() {
 	if dc.hasCurrent {
 		dc.fillPath.Add1(dc.start.Fixed())
 	}
+	dc.path.NewSubPath()
 	dc.hasCurrent = false
 }
 
+// CopyPath returns a copy of the current path in user space, i.e. with the
+// inverse of the current matrix applied to its points.
+func (dc *Context) CopyPath() *Path {
+	return dc.path.Transform(dc.matrix.Invert())
+}
+
+// AppendPath appends the specified path, which is given in user space, to the
+// current path. The points of the path are transformed by the current matrix.
+func (dc *Context) AppendPath(p *Path) {
+	for _, s := range p.segments {
+		switch s.Type {
+		case SegmentMoveTo:
+			dc.MoveTo(s.Points[0].X, s.Points[0].Y)
+		case SegmentLineTo:
+			dc.LineTo(s.Points[0].X, s.Points[0].Y)
+		case SegmentQuadraticTo:
+			dc.QuadraticTo(s.Points[0].X, s.Points[0].Y, s.Points[1].X, s.Points[1].Y)
+		case SegmentCubicTo:
+			dc.CubicTo(s.Points[0].X, s.Points[0].Y, s.Points[1].X, s.Points[1].Y, s.Points[2].X, s.Points[2].Y)
+		case SegmentClosePath:
+			dc.ClosePath()
+		}
+	}
+}
+
+func (dc *Context) hasCurrentPoint() bool {
+	return dc.hasCurrent
+}
+
 // Path Drawing
 
+// painter returns a painter that paints the pattern with the current
+// operator, global alpha and clipping mask.
+func (dc *Context) painter(pattern Pattern) raster.Painter {
+	if dc.mask == nil && dc.operator == OperatorOver && dc.globalAlpha == 1 {
+		if pattern, ok := pattern.(*solidPattern); ok {
+			// with a nil mask and a solid color pattern, we can be more efficient
+			// TODO: refactor so we don't have to do this type assertion stuff?
+			p := raster.NewRGBAPainter(dc.im)
+			p.SetColor(pattern.color)
+			return p
+		}
+	}
+	return newPatternPainter(dc.im, dc.mask, pattern, dc.operator, dc.globalAlpha)
+}
+
+// paintCoverage paints the pattern onto the image with the current operator,
+// global alpha and clipping mask, where the alpha values of coverage give the fraction of
+// each pixel that is covered by the drawing operation.
+func (dc *Context) paintCoverage(coverage *image.Alpha, p Pattern) {
+	painter := dc.painter(p)
+	b := coverage.Bounds()
+	var spans []raster.Span
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		spans = spans[:0]
+		for x := b.Min.X; x < b.Max.X; x++ {
+			a := uint32(coverage.AlphaAt(x, y).A) * 0x101
+			if a == 0 {
+				continue
+			}
+			if n := len(spans); n > 0 && spans[n-1].X1 == x && spans[n-1].Alpha == a {
+				spans[n-1].X1++
+				continue
+			}
+			spans = append(spans, raster.Span{Y: y, X0: x, X1: x + 1, Alpha: a})
+		}
+		painter.Paint(spans, false)
+	}
+	painter.Paint(nil, true)
+}
+
 func (dc *Context) capper() raster.Capper {
-	switch dc.lineCap {
+	return lineCapper(dc.lineCap)
+}
+
+func (dc *Context) joiner() raster.Joiner {
+	return lineJoiner(dc.lineJoin, dc.miterLimit)
+}
+
+func lineCapper(lineCap LineCap) raster.Capper {
+	switch lineCap {
 	case LineCapButt:
 		return raster.ButtCapper
 	case LineCapRound:
@@ -396,17 +565,51 @@ func (dc *Context) capper() raster.Capper {
 	return nil
 }
 
-func (dc *Context) joiner() raster.Joiner {
-	switch dc.lineJoin {
+func lineJoiner(lineJoin LineJoin, miterLimit float64) raster.Joiner {
+	switch lineJoin {
 	case LineJoinBevel:
 		return raster.BevelJoiner
 	case LineJoinRound:
 		return raster.RoundJoiner
+	case LineJoinMiter:
+		return miterJoiner{miterLimit}
 	}
 	return nil
 }
 
-func (dc *Context) stroke(painter raster.Painter) {
+// miterJoiner adds miter joins to a stroked path, falling back to bevel
+// joins where the miter would be longer than limit times the line width.
+type miterJoiner struct {
+	limit float64
+}
+
+func (j miterJoiner) Join(lhs, rhs raster.Adder, halfWidth fixed.Int26_6, pivot, n0, n1 fixed.Point26_6) {
+	// the miter tip lies along the sum of the normals, at a distance of
+	// halfWidth / cos(theta / 2), theta being the angle between the normals
+	sx, sy := unfix(n0.X+n1.X), unfix(n0.Y+n1.Y)
+	s2 := sx*sx + sy*sy
+	h := unfix(halfWidth)
+	if s2 == 0 || 4*h*h > j.limit*j.limit*s2 {
+		raster.BevelJoiner.Join(lhs, rhs, halfWidth, pivot, n0, n1)
+		return
+	}
+	k := 2 * h * h / s2
+	tip := fixp(sx*k, sy*k)
+	// the outer side of the turn gets the miter, as in raster.RoundJoiner
+	if unfix(n0.X)*unfix(n1.Y)-unfix(n0.Y)*unfix(n1.X) >= 0 {
+		lhs.Add1(pivot.Add(tip))
+		lhs.Add1(pivot.Add(n1))
+		rhs.Add1(pivot.Sub(n1))
+	} else {
+		lhs.Add1(pivot.Add(n1))
+		rhs.Add1(pivot.Sub(tip))
+		rhs.Add1(pivot.Sub(n1))
+	}
+}
+
+// dashedStrokePath returns the path that is actually stroked, with the dash
+// settings applied.
+func (dc *Context) dashedStrokePath() raster.Path {
 	path := dc.strokePath
 	if len(dc.dashes) > 0 {
 		path = dashed(path, dc.dashes, dc.dashOffset)
@@ -415,10 +618,18 @@ func (dc *Context) stroke(painter raster.Painter) {
 		// that result in rendering issues
 		path = rasterPath(flattenPath(path))
 	}
+	return path
+}
+
+func (dc *Context) stroke(painter raster.Painter) {
 	r := dc.rasterizer
 	r.UseNonZeroWinding = true
 	r.Clear()
-	r.AddStroke(path, fix(dc.lineWidth), dc.capper(), dc.joiner())
+	if dc.strokeAlign != StrokeAlignCenter {
+		r.AddPath(rasterPath(dc.strokeOutline().flatten()))
+	} else {
+		r.AddStroke(dc.dashedStrokePath(), fix(dc.lineWidth), dc.capper(), dc.joiner())
+	}
 	r.Rasterize(painter)
 }
 
@@ -440,20 +651,16 @@ func (dc *Context) fill(painter raster.Painter) {
 // line cap, line join and dash settings. The path is preserved after this
 // operation.
 func (dc *Context) StrokePreserve() {
-	var painter raster.Painter
-	if dc.mask == nil {
-		if pattern, ok := dc.strokePattern.(*solidPattern); ok {
-			// with a nil mask and a solid color pattern, we can be more efficient
-			// TODO: refactor so we don't have to do this type assertion stuff?
-			p := raster.NewRGBAPainter(dc.im)
-			p.SetColor(pattern.color)
-			painter = p
+	dc.drawShadow(dc.StrokePreserve)
+	dc.stroke(dc.painter(dc.strokePattern))
+	if dc.surface != nil && !dc.recordRaster() {
+		if dc.strokeAlign != StrokeAlignCenter {
+			// the vector formats only center strokes
+			dc.surface.fill(dc, dc.strokeOutline(), FillRuleWinding, dc.strokePattern)
+		} else {
+			dc.surface.stroke(dc, &dc.path, dc.strokePattern)
 		}
 	}
-	if painter == nil {
-		painter = newPatternPainter(dc.im, dc.mask, dc.strokePattern)
-	}
-	dc.stroke(painter)
 }
 
 // Stroke strokes the current path with the current color, line width,
@@ -467,20 +674,11 @@ func (dc *Context) Stroke() {
 // FillPreserve fills the current path with the current color. Open subpaths
 // are implicity closed. The path is preserved after this operation.
 func (dc *Context) FillPreserve() {
-	var painter raster.Painter
-	if dc.mask == nil {
-		if pattern, ok := dc.fillPattern.(*solidPattern); ok {
-			// with a nil mask and a solid color pattern, we can be more efficient
-			// TODO: refactor so we don't have to do this type assertion stuff?
-			p := raster.NewRGBAPainter(dc.im)
-			p.SetColor(pattern.color)
-			painter = p
-		}
+	dc.drawShadow(dc.FillPreserve)
+	dc.fill(dc.painter(dc.fillPattern))
+	if dc.surface != nil && !dc.recordRaster() {
+		dc.surface.fill(dc, &dc.path, dc.fillRule, dc.fillPattern)
 	}
-	if painter == nil {
-		painter = newPatternPainter(dc.im, dc.mask, dc.fillPattern)
-	}
-	dc.fill(painter)
 }
 
 // Fill fills the current path with the current color. Open subpaths
@@ -504,6 +702,9 @@ func (dc *Context) ClipPreserve() {
 		draw.DrawMask(mask, mask.Bounds(), clip, image.ZP, dc.mask, image.ZP, draw.Over)
 		dc.mask = mask
 	}
+	if dc.surface != nil {
+		dc.surface.clip(dc, &dc.path, dc.fillRule)
+	}
 }
 
 // SetMask allows you to directly set the *image.Alpha to be used as a clipping
@@ -514,6 +715,9 @@ func (dc *Context) SetMask(mask *image.Alpha) error {
 		return errors.New("mask size must match context size")
 	}
 	dc.mask = mask
+	if dc.surface != nil {
+		dc.surface.setMask(mask)
+	}
 	return nil
 }
 
@@ -536,6 +740,9 @@ func (dc *Context) InvertMask() {
 			dc.mask.Pix[i] = 255 - a
 		}
 	}
+	if dc.surface != nil {
+		dc.surface.setMask(dc.mask)
+	}
 }
 
 // Clip updates the clipping region by intersecting the current
@@ -549,6 +756,9 @@ func (dc *Context) Clip() {
 // ResetClip clears the clipping region.
 func (dc *Context) ResetClip() {
 	dc.mask = nil
+	if dc.surface != nil {
+		dc.surface.setMask(nil)
+	}
 }
 
 // Convenient Drawing Functions
@@ -557,11 +767,22 @@ func (dc *Context) ResetClip() {
 func (dc *Context) Clear() {
 	src := image.NewUniform(dc.color)
 	draw.Draw(dc.im, dc.im.Bounds(), src, image.ZP, draw.Src)
+	if dc.surface != nil {
+		dc.surface.clear(dc.color)
+	}
 }
 
-// SetPixel sets the color of the specified pixel using the current color.
+// SetPixel sets the color of the specified pixel using the current color. It
+// is painted like a fill, with the current operator, global alpha and clip.
 func (dc *Context) SetPixel(x, y int) {
-	dc.im.Set(x, y, dc.color)
+	coverage := image.NewAlpha(image.Rect(x, y, x+1, y+1))
+	coverage.Pix[0] = 0xff
+	dc.paintCoverage(coverage, NewSolidPattern(dc.color))
+	if dc.surface != nil && !dc.recordRaster() {
+		var path Path
+		path.DrawRectangle(float64(x), float64(y), 1, 1)
+		dc.surface.fill(dc, &path, FillRuleWinding, NewSolidPattern(dc.color))
+	}
 }
 
 // DrawPoint is like DrawCircle but ensures that a circle of the specified
@@ -576,89 +797,35 @@ func (dc *Context) DrawPoint(x, y, r float64) {
 }
 
 func (dc *Context) DrawLine(x1, y1, x2, y2 float64) {
-	dc.MoveTo(x1, y1)
-	dc.LineTo(x2, y2)
+	drawLine(dc, x1, y1, x2, y2)
 }
 
 func (dc *Context) DrawRectangle(x, y, w, h float64) {
-	dc.NewSubPath()
-	dc.MoveTo(x, y)
-	dc.LineTo(x+w, y)
-	dc.LineTo(x+w, y+h)
-	dc.LineTo(x, y+h)
-	dc.ClosePath()
+	drawRectangle(dc, x, y, w, h)
 }
 
 func (dc *Context) DrawRoundedRectangle(x, y, w, h, r float64) {
-	x0, x1, x2, x3 := x, x+r, x+w-r, x+w
-	y0, y1, y2, y3 := y, y+r, y+h-r, y+h
-	dc.NewSubPath()
-	dc.MoveTo(x1, y0)
-	dc.LineTo(x2, y0)
-	dc.DrawArc(x2, y1, r, Radians(270), Radians(360))
-	dc.LineTo(x3, y2)
-	dc.DrawArc(x2, y2, r, Radians(0), Radians(90))
-	dc.LineTo(x1, y3)
-	dc.DrawArc(x1, y2, r, Radians(90), Radians(180))
-	dc.LineTo(x0, y1)
-	dc.DrawArc(x1, y1, r, Radians(180), Radians(270))
-	dc.ClosePath()
+	drawRoundedRectangle(dc, x, y, w, h, r)
 }
 
 func (dc *Context) DrawEllipticalArc(x, y, rx, ry, angle1, angle2 float64) {
-	const n = 16
-	for i := 0; i < n; i++ {
-		p1 := float64(i+0) / n
-		p2 := float64(i+1) / n
-		a1 := angle1 + (angle2-angle1)*p1
-		a2 := angle1 + (angle2-angle1)*p2
-		x0 := x + rx*math.Cos(a1)
-		y0 := y + ry*math.Sin(a1)
-		x1 := x + rx*math.Cos((a1+a2)/2)
-		y1 := y + ry*math.Sin((a1+a2)/2)
-		x2 := x + rx*math.Cos(a2)
-		y2 := y + ry*math.Sin(a2)
-		cx := 2*x1 - x0/2 - x2/2
-		cy := 2*y1 - y0/2 - y2/2
-		if i == 0 {
-			if dc.hasCurrent {
-				dc.LineTo(x0, y0)
-			} else {
-				dc.MoveTo(x0, y0)
-			}
-		}
-		dc.QuadraticTo(cx, cy, x2, y2)
-	}
+	drawEllipticalArc(dc, x, y, rx, ry, angle1, angle2)
 }
 
 func (dc *Context) DrawEllipse(x, y, rx, ry float64) {
-	dc.NewSubPath()
-	dc.DrawEllipticalArc(x, y, rx, ry, 0, 2*math.Pi)
-	dc.ClosePath()
+	drawEllipse(dc, x, y, rx, ry)
 }
 
 func (dc *Context) DrawArc(x, y, r, angle1, angle2 float64) {
-	dc.DrawEllipticalArc(x, y, r, r, angle1, angle2)
+	drawEllipticalArc(dc, x, y, r, r, angle1, angle2)
 }
 
 func (dc *Context) DrawCircle(x, y, r float64) {
-	dc.NewSubPath()
-	dc.DrawEllipticalArc(x, y, r, r, 0, 2*math.Pi)
-	dc.ClosePath()
+	drawEllipse(dc, x, y, r, r)
 }
 
 func (dc *Context) DrawRegularPolygon(n int, x, y, r, rotation float64) {
-	angle := 2 * math.Pi / float64(n)
-	rotation -= math.Pi / 2
-	if n%2 == 0 {
-		rotation += angle / 2
-	}
-	dc.NewSubPath()
-	for i := 0; i < n; i++ {
-		a := rotation + angle*float64(i)
-		dc.LineTo(x+r*math.Cos(a), y+r*math.Sin(a))
-	}
-	dc.ClosePath()
+	drawRegularPolygon(dc, n, x, y, r, rotation)
 }
 
 // DrawImage draws the specified image at the specified point.
@@ -670,6 +837,7 @@ func (dc *Context) DrawImage(im image.Image, x, y int) {
 // The anchor point is x - w * ax, y - h * ay, where w, h is the size of the
 // image. Use ax=0.5, ay=0.5 to center the image at the specified point.
 func (dc *Context) DrawImageAnchored(im image.Image, x, y int, ax, ay float64) {
+	dc.drawShadow(func() { dc.DrawImageAnchored(im, x, y, ax, ay) })
 	s := im.Bounds().Size()
 	x -= int(ax * float64(s.X))
 	y -= int(ay * float64(s.Y))
@@ -677,7 +845,14 @@ func (dc *Context) DrawImageAnchored(im image.Image, x, y int, ax, ay float64) {
 	fx, fy := float64(x), float64(y)
 	m := dc.matrix.Translate(fx, fy)
 	s2d := f64.Aff3{m.XX, m.XY, m.X0, m.YX, m.YY, m.Y0}
-	if dc.mask == nil {
+	if dc.operator != OperatorOver || dc.globalAlpha < 1 {
+		r := image.Rect(0, 0, dc.width, dc.height)
+		src := image.NewRGBA(r)
+		transformer.Transform(src, s2d, im, im.Bounds(), draw.Src, nil)
+		coverage := image.NewAlpha(r)
+		transformer.Transform(coverage, s2d, image.Opaque, im.Bounds(), draw.Src, nil)
+		dc.paintCoverage(coverage, NewSurfacePattern(src, RepeatNone))
+	} else if dc.mask == nil {
 		transformer.Transform(dc.im, s2d, im, im.Bounds(), draw.Over, nil)
 	} else {
 		transformer.Transform(dc.im, s2d, im, im.Bounds(), draw.Over, &draw.Options{
@@ -685,6 +860,9 @@ func (dc *Context) DrawImageAnchored(im image.Image, x, y int, ax, ay float64) {
 			DstMaskP: image.ZP,
 		})
 	}
+	if dc.surface != nil && !dc.recordRaster() {
+		dc.surface.drawImage(dc, im, m)
+	}
 }
 
 // Text Functions
@@ -703,28 +881,54 @@ func (dc *Context) LoadFontFace(path string, points float64) error {
 	return err
 }
 
+// SetFontFallbacks sets the faces that text falls back to, in order, for
+// the characters that the current font face has no glyph for, such as a CJK,
+// emoji or symbol font behind a Latin one. Each cluster of characters, a
+// character with its combining marks, is drawn and measured with the first
+// of the current face and the fallbacks that has glyphs for all of it. All
+// the faces share the baseline of the line, which is as tall as the tallest
+// of the faces that it uses, see MeasureString. Call it with no faces to
+// remove the fallbacks.
+func (dc *Context) SetFontFallbacks(faces ...font.Face) {
+	dc.fontFallbacks = append([]font.Face(nil), faces...)
+}
+
+// LoadFontFallback loads the font file with the point size, as by
+// LoadFontFace, and adds it to the end of the fallback faces. See
+// SetFontFallbacks.
+func (dc *Context) LoadFontFallback(path string, points float64) error {
+	face, err := LoadFontFace(path, points)
+	if err == nil {
+		dc.SetFontFallbacks(append(dc.fontFallbacks, face)...)
+	}
+	return err
+}
+
 func (dc *Context) FontHeight() float64 {
 	return dc.fontHeight
 }
 
-func (dc *Context) drawString(im *image.RGBA, s string, x, y float64) {
-	d := &font.Drawer{
-		Dst:  im,
-		Src:  image.NewUniform(dc.color),
-		Face: dc.fontFace,
-		Dot:  fixp(x, y),
-	}
+func (dc *Context) drawString(im draw.Image, src image.Image, s string, x, y float64) {
+	glyphs, _ := dc.layoutText(s)
+	dc.drawGlyphs(im, src, glyphs, fixp(x, y))
+}
+
+// drawGlyphs draws the glyphs laid out by layoutText with the origin of the
+// line at origin.
+func (dc *Context) drawGlyphs(im draw.Image, src image.Image, glyphs []textGlyph, origin fixed.Point26_6) {
 	// based on Drawer.DrawString() in golang.org/x/image/font/font.go
-	prevC := rune(-1)
-	for _, c := range s {
-		if prevC >= 0 {
-			d.Dot.X += d.Face.Kern(prevC, c)
+	for _, g := range glyphs {
+		dot := origin.Add(g.dot)
+		var dr image.Rectangle
+		var mask image.Image
+		var maskp image.Point
+		ok := false
+		if ttf, isTTF := g.face.(*trueTypeFace); isTTF {
+			dr, mask, ok = ttf.glyphMask(dot, g.index)
+		} else {
+			dr, mask, maskp, _, ok = g.face.Glyph(dot, g.r)
 		}
-		dr, mask, maskp, advance, ok := d.Face.Glyph(d.Dot, c)
 		if !ok {
-			// TODO: is falling back on the U+FFFD glyph the responsibility of
-			// the Drawer or the Face?
-			// TODO: set prevC = '\ufffd'?
 			continue
 		}
 		sr := dr.Sub(dr.Min)
@@ -732,16 +936,15 @@ func (dc *Context) drawString(im *image.RGBA, s string, x, y float64) {
 		fx, fy := float64(dr.Min.X), float64(dr.Min.Y)
 		m := dc.matrix.Translate(fx, fy)
 		s2d := f64.Aff3{m.XX, m.XY, m.X0, m.YX, m.YY, m.Y0}
-		transformer.Transform(d.Dst, s2d, d.Src, sr, draw.Over, &draw.Options{
+		transformer.Transform(im, s2d, src, sr, draw.Over, &draw.Options{
 			SrcMask:  mask,
 			SrcMaskP: maskp,
 		})
-		d.Dot.X += advance
-		prevC = c
 	}
 }
 
-// DrawString draws the specified text at the specified point.
+// DrawString draws the specified text at the specified point with the
+// current fill style.
 func (dc *Context) DrawString(s string, x, y float64) {
 	dc.DrawStringAnchored(s, x, y, 0, 0)
 }
@@ -750,14 +953,34 @@ func (dc *Context) DrawString(s string, x, y float64) {
 // The anchor point is x - w * ax, y - h * ay, where w, h is the size of the
 // text. Use ax=0.5, ay=0.5 to center the text at the specified point.
 func (dc *Context) DrawStringAnchored(s string, x, y, ax, ay float64) {
+	dc.drawShadow(func() { dc.DrawStringAnchored(s, x, y, ax, ay) })
 	w, h := dc.MeasureString(s)
 	x -= ax * w
 	y += ay * h
-	if dc.mask == nil {
-		dc.drawString(dc.im, s, x, y)
+	dc.paintText(func(im draw.Image, src image.Image) {
+		dc.drawString(im, src, s, x, y)
+	})
+	if dc.surface != nil && !dc.recordRaster() {
+		dc.surface.drawString(dc, s, x, y)
+	}
+}
+
+// paintText paints the text that render draws into an image with the
+// specified source, using the current fill style, mask, operator and global
+// alpha.
+func (dc *Context) paintText(render func(im draw.Image, src image.Image)) {
+	solid, ok := dc.fillPattern.(*solidPattern)
+	if !ok || dc.operator != OperatorOver || dc.globalAlpha < 1 {
+		// gradients and other patterns are painted through the coverage of
+		// the glyphs
+		coverage := image.NewAlpha(image.Rect(0, 0, dc.width, dc.height))
+		render(coverage, image.Opaque)
+		dc.paintCoverage(coverage, dc.fillPattern)
+	} else if dc.mask == nil {
+		render(dc.im, image.NewUniform(solid.color))
 	} else {
 		im := image.NewRGBA(image.Rect(0, 0, dc.width, dc.height))
-		dc.drawString(im, s, x, y)
+		render(im, image.NewUniform(solid.color))
 		draw.DrawMask(dc.im, dc.im.Bounds(), im, image.ZP, dc.mask, image.ZP, draw.Over)
 	}
 }
@@ -769,8 +992,8 @@ func (dc *Context) DrawStringWrapped(s string, x, y, ax, ay, width, lineSpacing
 	lines := dc.WordWrap(s, width)
 
 	// sync h formula with MeasureMultilineString
-	h := float64(len(lines)) * dc.fontHeight * lineSpacing
-	h -= (lineSpacing - 1) * dc.fontHeight
+	heights := dc.lineHeights(lines)
+	h := linesHeight(heights, lineSpacing)
 
 	x -= ax * width
 	y -= ay * h
@@ -785,9 +1008,9 @@ func (dc *Context) DrawStringWrapped(s string, x, y, ax, ay, width, lineSpacing
 		x += width
 	}
 	ay = 1
-	for _, line := range lines {
+	for i, line := range lines {
 		dc.DrawStringAnchored(line, x, y, ax, ay)
-		y += dc.fontHeight * lineSpacing
+		y += heights[i] * lineSpacing
 	}
 }
 
@@ -795,17 +1018,11 @@ func (dc *Context) MeasureMultilineString(s string, lineSpacing float64) (width,
 	lines := strings.Split(s, "\n")
 
 	// sync h formula with DrawStringWrapped
-	height = float64(len(lines)) * dc.fontHeight * lineSpacing
-	height -= (lineSpacing - 1) * dc.fontHeight
-
-	d := &font.Drawer{
-		Face: dc.fontFace,
-	}
+	height = linesHeight(dc.lineHeights(lines), lineSpacing)
 
 	// max width from lines
 	for _, line := range lines {
-		adv := d.MeasureString(line)
-		currentWidth := float64(adv >> 6) // from gg.Context.MeasureString
+		currentWidth, _ := dc.MeasureString(line)
 		if currentWidth > width {
 			width = currentWidth
 		}
@@ -814,14 +1031,35 @@ func (dc *Context) MeasureMultilineString(s string, lineSpacing float64) (width,
 	return width, height
 }
 
+// lineHeights returns the height of each line, as by MeasureString.
+func (dc *Context) lineHeights(lines []string) []float64 {
+	heights := make([]float64, len(lines))
+	for i, line := range lines {
+		_, heights[i] = dc.MeasureString(line)
+	}
+	return heights
+}
+
+// linesHeight returns the height of lines of the heights, spaced by
+// lineSpacing times the height of each line.
+func linesHeight(heights []float64, lineSpacing float64) float64 {
+	var h float64
+	for _, x := range heights {
+		h += x * lineSpacing
+	}
+	if n := len(heights); n > 0 {
+		h -= (lineSpacing - 1) * heights[n-1]
+	}
+	return h
+}
+
 // MeasureString returns the rendered width and height of the specified text
-// given the current font face.
+// given the current font face. The text is laid out as by DrawString. The
+// height is that of the current face, or larger if the text has characters
+// from a taller fallback face, see SetFontFallbacks.
 func (dc *Context) MeasureString(s string) (w, h float64) {
-	d := &font.Drawer{
-		Face: dc.fontFace,
-	}
-	a := d.MeasureString(s)
-	return float64(a >> 6), dc.fontHeight
+	glyphs, a := dc.layoutText(s)
+	return float64(a >> 6), dc.textHeight(glyphs)
 }
 
 // WordWrap wraps the specified string to the given max width and current
@@ -916,7 +1154,69 @@ func (dc *Context) Pop() {
 	dc.mask = before.mask
 	dc.strokePath = before.strokePath
 	dc.fillPath = before.fillPath
+	dc.path = before.path
 	dc.start = before.start
 	dc.current = before.current
 	dc.hasCurrent = before.hasCurrent
 }
+
+// PushGroup saves the current state of the context, like Push, and redirects
+// all drawing to a new, transparent layer until the matching PopGroup or
+// PopGroupToSource. Drawing inside the group starts with a global alpha of 1,
+// OperatorOver and no clipping, the transform is kept. SVG and PDF output
+// record the group as a group element or a transparency group.
+func (dc *Context) PushGroup() {
+	dc.Push()
+	dc.im = image.NewRGBA(dc.im.Bounds())
+	dc.mask = nil
+	dc.globalAlpha = 1
+	dc.operator = OperatorOver
+	if dc.surface != nil {
+		dc.surface.pushGroup()
+	}
+}
+
+// PopGroup ends the group started by the last PushGroup, restores the state
+// saved by it and composites the layer onto the image as a whole, using the
+// restored global alpha, operator and clipping mask. Clipping done inside the
+// group is discarded.
+func (dc *Context) PopGroup() {
+	layer := dc.popGroup(true)
+	dc.paintLayer(NewSurfacePattern(layer, RepeatNone))
+	if dc.surface != nil {
+		dc.recordRaster()
+	}
+}
+
+// PopGroupToSource ends the group started by the last PushGroup and restores
+// the state saved by it, like PopGroup, but instead of drawing the layer it
+// returns it as a pattern that can be used as a fill or stroke style. The
+// pattern lines up with the drawing as long as the transform is the same
+// when it is set as the style. In SVG and PDF output the pattern is drawn as
+// an image.
+func (dc *Context) PopGroupToSource() Pattern {
+	p := NewSurfacePattern(dc.popGroup(false), RepeatNone)
+	p.SetMatrix(dc.matrix.Invert())
+	return p
+}
+
+// popGroup restores the state saved by the last PushGroup, including the
+// clipping mask, and returns the layer of the group. The surface draws the
+// group if paint is true.
+func (dc *Context) popGroup(paint bool) *image.RGBA {
+	layer := dc.im
+	mask := dc.stack[len(dc.stack)-1].mask
+	dc.Pop()
+	dc.mask = mask
+	if dc.surface != nil {
+		dc.surface.popGroup(dc, paint)
+	}
+	return layer
+}
+
+// paintLayer paints the pattern over the whole image.
+func (dc *Context) paintLayer(p Pattern) {
+	coverage := image.NewAlpha(image.Rect(0, 0, dc.width, dc.height))
+	draw.Draw(coverage, coverage.Bounds(), image.Opaque, image.ZP, draw.Src)
+	dc.paintCoverage(coverage, p)
+}
@@ -1,12 +1,22 @@
 package gg
 
 import (
+	"bytes"
+	"compress/zlib"
 	"crypto/md5"
 	"flag"
 	"fmt"
+	"image"
 	"image/color"
+	"io/ioutil"
+	"math"
 	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
 )
 
 var save bool
@@ -321,3 +331,970 @@ func BenchmarkCircles(b *testing.B) {
 		dc.Fill()
 	}
 }
+
+func TestHitTesting(t *testing.T) {
+	dc := NewContext(100, 100)
+	dc.Translate(50, 50)
+	dc.Scale(2, 2)
+	dc.DrawRectangle(-10, -10, 20, 20)
+	dc.DrawRectangle(-5, -5, 10, 10)
+	dc.SetLineWidth(4)
+	if !dc.InFill(0, 0) || dc.InFill(11, 0) {
+		t.Error("unexpected InFill result with winding fill rule")
+	}
+	dc.SetFillRule(FillRuleEvenOdd)
+	if dc.InFill(0, 0) || !dc.InFill(7, 0) {
+		t.Error("unexpected InFill result with even-odd fill rule")
+	}
+	if !dc.InStroke(10.5, 0) || dc.InStroke(12, 0) || dc.InStroke(7.5, 0) {
+		t.Error("unexpected InStroke result")
+	}
+	x1, y1, x2, y2 := dc.FillExtents()
+	if x1 != -10 || y1 != -10 || x2 != 10 || y2 != 10 {
+		t.Errorf("unexpected fill extents: %g, %g, %g, %g", x1, y1, x2, y2)
+	}
+	x1, y1, x2, y2 = dc.StrokeExtents()
+	if x1 != -11 || y1 != -11 || x2 != 11 || y2 != 11 {
+		t.Errorf("unexpected stroke extents: %g, %g, %g, %g", x1, y1, x2, y2)
+	}
+}
+
+func TestMiterJoin(t *testing.T) {
+	dc := NewContext(100, 100)
+	dc.MoveTo(20, 20)
+	dc.LineTo(70, 20)
+	dc.LineTo(70, 70)
+	dc.SetLineWidth(10)
+	dc.SetLineJoinBevel()
+	if dc.InStroke(74, 16) {
+		t.Error("expected no stroke at the corner with bevel join")
+	}
+	dc.SetLineJoinMiter()
+	if !dc.InStroke(74, 16) {
+		t.Error("expected stroke at the corner with miter join")
+	}
+	dc.SetMiterLimit(1.2)
+	if dc.InStroke(74, 16) {
+		t.Error("expected miter limit to fall back to bevel join")
+	}
+	dc.SetMiterLimit(10)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+	dc.SetRGB(0, 0, 0)
+	dc.Stroke()
+	saveImage(dc, "TestMiterJoin")
+	if r, _, _, _ := dc.Image().At(74, 16).RGBA(); r != 0 {
+		t.Error("expected miter join to be drawn")
+	}
+}
+
+func TestOperators(t *testing.T) {
+	check := func(dc *Context, x, y int, expected color.RGBA) {
+		t.Helper()
+		if c := dc.im.RGBAAt(x, y); c != expected {
+			t.Errorf("pixel %d, %d: expected %v, got %v", x, y, expected, c)
+		}
+	}
+	dc := NewContext(100, 100)
+	dc.SetRGB(1, 0, 0)
+	dc.DrawRectangle(0, 0, 60, 60)
+	dc.Fill()
+	dc.SetOperator(OperatorDestOut)
+	dc.DrawRectangle(40, 40, 60, 60)
+	dc.Fill()
+	check(dc, 20, 20, color.RGBA{255, 0, 0, 255})
+	check(dc, 50, 50, color.RGBA{})
+	dc.SetOperator(OperatorSource)
+	dc.SetRGBA(0, 0, 1, 0.5)
+	dc.DrawRectangle(0, 0, 10, 10)
+	dc.Fill()
+	check(dc, 5, 5, color.RGBA{0, 0, 127, 127})
+	check(dc, 15, 15, color.RGBA{})
+
+	dc = NewContext(100, 100)
+	dc.SetRGB(1, 0.5, 0)
+	dc.Clear()
+	dc.SetOperator(OperatorMultiply)
+	dc.SetRGB(0.5, 1, 1)
+	dc.DrawRectangle(0, 0, 50, 100)
+	dc.Fill()
+	check(dc, 25, 50, color.RGBA{127, 127, 0, 255})
+	check(dc, 75, 50, color.RGBA{255, 127, 0, 255})
+
+	im := NewContext(10, 10)
+	im.SetRGB(0, 1, 0)
+	im.Clear()
+	dc.SetOperator(OperatorAtop)
+	dc.DrawImage(im.Image(), 80, 80)
+	check(dc, 85, 85, color.RGBA{0, 255, 0, 255})
+	check(dc, 75, 85, color.RGBA{255, 127, 0, 255})
+	dc.SetOperator(OperatorClear)
+	dc.DrawImage(im.Image(), 80, 80)
+	check(dc, 85, 85, color.RGBA{})
+	check(dc, 75, 85, color.RGBA{})
+}
+
+func TestUnboundedOperators(t *testing.T) {
+	for op := OperatorOver; op <= OperatorLuminosity; op++ {
+		dc := NewContext(100, 100)
+		dc.SetRGB(1, 0, 0)
+		dc.Clear()
+		dc.DrawRectangle(0, 0, 50, 100)
+		dc.Clip()
+		dc.SetOperator(op)
+		dc.SetRGB(0, 0, 1)
+		dc.DrawRectangle(10, 10, 10, 10)
+		dc.Fill()
+		// outside the shape, within the clip, the destination is cleared by
+		// the unbounded operators and kept by the others
+		expected := color.RGBA{255, 0, 0, 255}
+		if op.isUnbounded() {
+			expected = color.RGBA{}
+		}
+		if c := dc.im.RGBAAt(30, 50); c != expected {
+			t.Errorf("operator %d: expected %v outside the shape, got %v", op, expected, c)
+		}
+		// and outside the clip it is always kept
+		if c := dc.im.RGBAAt(75, 50); c != (color.RGBA{255, 0, 0, 255}) {
+			t.Errorf("operator %d: expected the clip to apply, got %v", op, c)
+		}
+	}
+}
+
+func TestPDF(t *testing.T) {
+	face, err := ParseFontFace(goregular.TTF, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc := NewPDFContext(100, 100)
+	dc.SetFontFace(face)
+	dc.SetRGB(1, 0, 0)
+	dc.DrawRectangle(10, 10, 50, 50)
+	dc.Fill()
+	dc.NewPage()
+	dc.SetRGB(0, 0, 0)
+	dc.DrawString("Hello", 10, 50)
+	dc.NewPage()
+	dc.DrawCircle(50, 50, 20)
+	dc.Stroke()
+	var buf bytes.Buffer
+	if err := dc.EncodePDF(&buf); err != nil {
+		t.Fatal(err)
+	}
+	doc := buf.String()
+	if !strings.HasPrefix(doc, "%PDF-") || !strings.HasSuffix(doc, "%%EOF\n") {
+		t.Fatalf("expected a PDF document, got %q", doc)
+	}
+	if n := strings.Count(doc, "/Type /Page "); n != 3 || !strings.Contains(doc, "/Count 3 ") {
+		t.Errorf("expected 3 pages, got %d", n)
+	}
+
+	// the cross-reference table points at the objects
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindStringSubmatch(doc)
+	if m == nil {
+		t.Fatal("expected a startxref")
+	}
+	xref, _ := strconv.Atoi(m[1])
+	if !strings.HasPrefix(doc[xref:], "xref\n") {
+		t.Fatalf("expected startxref to point at the xref table, got %q", doc[xref:xref+10])
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n \n`).FindAllStringSubmatch(doc[xref:], -1)
+	if len(entries) == 0 {
+		t.Fatal("expected xref entries")
+	}
+	objects := make([]string, len(entries)+1)
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(entry[1])
+		header := fmt.Sprintf("%d 0 obj\n", i+1)
+		if !strings.HasPrefix(doc[offset:], header) {
+			t.Fatalf("expected object %d at offset %d, got %q", i+1, offset, doc[offset:offset+10])
+		}
+		end := strings.Index(doc[offset:], "\nendobj\n")
+		objects[i+1] = doc[offset+len(header) : offset+end]
+	}
+
+	// the font is embedded with a map back to the text
+	if !strings.Contains(doc, "/FontFile2 ") {
+		t.Error("expected the font to be embedded")
+	}
+	m = regexp.MustCompile(`/ToUnicode (\d+) 0 R`).FindStringSubmatch(doc)
+	if m == nil {
+		t.Fatal("expected a ToUnicode CMap")
+	}
+	n, _ := strconv.Atoi(m[1])
+	stream := objects[n]
+	stream = stream[strings.Index(stream, "stream\n")+7 : strings.LastIndex(stream, "\nendstream")]
+	r, err := zlib.NewReader(strings.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmap, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := face.(*trueTypeFace).font.Index('H')
+	if want := fmt.Sprintf("<%04x> <0048>", index); !strings.Contains(string(cmap), want) {
+		t.Errorf("expected the CMap to map H with %s, got %s", want, cmap)
+	}
+}
+
+func TestOperatorsSVG(t *testing.T) {
+	dc := NewSVGContext(100, 100)
+	dc.SetRGB(1, 0, 0)
+	dc.DrawRectangle(10, 10, 50, 50)
+	dc.Fill()
+	dc.SetOperator(OperatorMultiply)
+	dc.DrawRectangle(20, 20, 50, 50)
+	dc.Fill()
+	var buf bytes.Buffer
+	dc.EncodeSVG(&buf)
+	if s := buf.String(); strings.Count(s, "<path") != 2 || !strings.Contains(s, "mix-blend-mode:multiply") {
+		t.Errorf("expected blend modes to be recorded as paths, got %s", s)
+	}
+
+	// the other operators are recorded as the image they result in
+	dc.SetOperator(OperatorXor)
+	dc.DrawRectangle(30, 30, 50, 50)
+	dc.Fill()
+	buf.Reset()
+	dc.EncodeSVG(&buf)
+	if s := buf.String(); strings.Contains(s, "<path") || !strings.Contains(s, `<image x="10" y="10" width="70" height="70"`) {
+		t.Errorf("expected the result to be recorded as an image, got %s", s)
+	}
+}
+
+func TestSetPixelState(t *testing.T) {
+	dc := NewContext(100, 100)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+	dc.SetRGB(0, 0, 0)
+	dc.SetGlobalAlpha(0.5)
+	dc.SetPixel(10, 10)
+	dc.DrawRectangle(0, 0, 50, 100)
+	dc.Clip()
+	dc.SetPixel(60, 10)
+	dc.SetPixel(-1, 200)
+	if c := dc.im.RGBAAt(10, 10); c.R != 127 {
+		t.Errorf("expected the global alpha to apply, got %v", c)
+	}
+	if c := dc.im.RGBAAt(60, 10); c.R != 255 {
+		t.Errorf("expected the pixel to be clipped, got %v", c)
+	}
+}
+
+func TestGlobalAlpha(t *testing.T) {
+	dc := NewContext(100, 100)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+	dc.SetRGB(0, 0, 0)
+	dc.Push()
+	dc.SetGlobalAlpha(0.5)
+	dc.DrawRectangle(0, 0, 50, 50)
+	dc.Fill()
+	im := NewContext(10, 10)
+	im.SetRGB(0, 0, 1)
+	im.Clear()
+	dc.DrawImage(im.Image(), 80, 80)
+	dc.Pop()
+	dc.DrawRectangle(50, 0, 10, 10)
+	dc.Fill()
+	for _, c := range []struct {
+		x, y     int
+		expected color.RGBA
+	}{
+		{25, 25, color.RGBA{127, 127, 127, 255}},
+		{85, 85, color.RGBA{127, 127, 255, 255}},
+		{55, 5, color.RGBA{0, 0, 0, 255}},
+	} {
+		if actual := dc.im.RGBAAt(c.x, c.y); actual != c.expected {
+			t.Errorf("pixel %d, %d: expected %v, got %v", c.x, c.y, c.expected, actual)
+		}
+	}
+}
+
+func TestGroup(t *testing.T) {
+	dc := NewContext(100, 100)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+	dc.SetGlobalAlpha(0.5)
+	dc.PushGroup()
+	dc.SetRGB(0, 0, 0)
+	dc.DrawRectangle(10, 10, 50, 50)
+	dc.Fill()
+	dc.DrawRectangle(40, 40, 50, 50)
+	dc.Fill()
+	dc.PopGroup()
+	if a, b := dc.im.RGBAAt(20, 20), dc.im.RGBAAt(50, 50); a != b || a.R != 127 {
+		t.Errorf("expected the group to be composited as a whole: %v, %v", a, b)
+	}
+
+	dc.SetGlobalAlpha(1)
+	dc.PushGroup()
+	dc.SetRGB(1, 0, 0)
+	dc.DrawRectangle(0, 0, 100, 100)
+	dc.Fill()
+	pattern := dc.PopGroupToSource()
+	dc.SetFillStyle(pattern)
+	dc.DrawRectangle(0, 0, 10, 10)
+	dc.Fill()
+	if c := dc.im.RGBAAt(5, 5); c != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("expected the group to be used as a source: %v", c)
+	}
+	if c := dc.im.RGBAAt(15, 5); c != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("expected the group not to be drawn: %v", c)
+	}
+}
+
+func TestGroupSVG(t *testing.T) {
+	dc := NewSVGContext(100, 100)
+	dc.SetGlobalAlpha(0.5)
+	dc.PushGroup()
+	dc.DrawRectangle(10, 10, 50, 50)
+	dc.Fill()
+	dc.PopGroup()
+	dc.PushGroup()
+	dc.DrawRectangle(40, 40, 50, 50)
+	dc.Fill()
+	dc.PopGroupToSource()
+	var buf bytes.Buffer
+	dc.EncodeSVG(&buf)
+	s := buf.String()
+	if !strings.Contains(s, "<g opacity=\"0.5\">\n<path") || strings.Count(s, "<path") != 1 || strings.Contains(s, "<image") {
+		t.Errorf("expected one group of vector paths, got %s", s)
+	}
+}
+
+func TestShadow(t *testing.T) {
+	dc := NewContext(100, 100)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+	dc.SetShadow(10, 10, 0, color.RGBA{0, 0, 255, 255})
+	dc.SetRGB(1, 0, 0)
+	dc.DrawRectangle(10, 10, 40, 40)
+	dc.Fill()
+	for _, c := range []struct {
+		x, y     int
+		expected color.RGBA
+	}{
+		{30, 30, color.RGBA{255, 0, 0, 255}},
+		{55, 55, color.RGBA{0, 0, 255, 255}},
+		{5, 5, color.RGBA{255, 255, 255, 255}},
+	} {
+		if actual := dc.im.RGBAAt(c.x, c.y); actual != c.expected {
+			t.Errorf("pixel %d, %d: expected %v, got %v", c.x, c.y, c.expected, actual)
+		}
+	}
+}
+
+func TestBlur(t *testing.T) {
+	mask := image.NewAlpha(image.Rect(0, 0, 50, 50))
+	mask.SetAlpha(25, 25, color.Alpha{255})
+	mask.SetAlpha(26, 25, color.Alpha{255})
+	mask.SetAlpha(25, 26, color.Alpha{255})
+	mask.SetAlpha(26, 26, color.Alpha{255})
+	blurred := Blur(mask, 4).(*image.Alpha)
+	sum := 0
+	for _, a := range blurred.Pix {
+		sum += int(a)
+	}
+	if sum < 900 || sum > 1140 {
+		t.Errorf("expected blur to preserve the total alpha: %d", sum)
+	}
+	if blurred.AlphaAt(25, 25).A >= 255 || blurred.AlphaAt(22, 25).A == 0 {
+		t.Error("expected blur to spread the alpha")
+	}
+	if _, ok := Blur(NewContext(10, 10).Image(), 4).(*image.RGBA); !ok {
+		t.Error("expected blur of an RGBA image to be an RGBA image")
+	}
+}
+
+func TestGradientExtend(t *testing.T) {
+	cases := []struct {
+		extend   Extend
+		gradient Gradient
+		x, y     int
+		x0, y0   int
+	}{
+		{ExtendRepeat, NewLinearGradient(0, 0, 10, 0), 12, 0, 2, 0},
+		{ExtendReflect, NewLinearGradient(0, 0, 10, 0), 12, 0, 8, 0},
+		{ExtendRepeat, NewLinearGradient(0, 0, 10, 10), -2, -2, 8, 8},
+		{ExtendReflect, NewLinearGradient(0, 0, 10, 10), -2, -2, 2, 2},
+		{ExtendRepeat, NewRadialGradient(0.5, 0.5, 0, 0.5, 0.5, 10), 13, 0, 3, 0},
+		{ExtendReflect, NewRadialGradient(0.5, 0.5, 0, 0.5, 0.5, 10), 13, 0, 7, 0},
+	}
+	for i, c := range cases {
+		c.gradient.AddColorStop(0, color.Black)
+		c.gradient.AddColorStop(1, color.White)
+		if c.gradient.ColorAt(c.x, c.y) == c.gradient.ColorAt(c.x0, c.y0) {
+			t.Errorf("case %d: expected padding before SetExtend", i)
+		}
+		c.gradient.SetExtend(c.extend)
+		if a, b := c.gradient.ColorAt(c.x, c.y), c.gradient.ColorAt(c.x0, c.y0); a != b {
+			t.Errorf("case %d: expected %v, got %v", i, b, a)
+		}
+	}
+}
+
+func TestPatternTransform(t *testing.T) {
+	g := NewLinearGradient(0, 0, 10, 0)
+	g.AddColorStop(0, color.Black)
+	g.AddColorStop(1, color.White)
+	dc := NewContext(100, 100)
+	dc.Translate(50, 0)
+	dc.Scale(3, 3)
+	dc.SetFillStyle(g)
+	dc.Identity()
+	dc.DrawRectangle(0, 0, 100, 100)
+	dc.Fill()
+	expected := color.RGBAModel.Convert(g.ColorAt(5, 0))
+	if c := dc.im.At(66, 0); c != expected {
+		t.Errorf("expected the gradient to follow the transform: %v != %v", c, expected)
+	}
+
+	g.SetMatrix(Translate(10, 0))
+	if a, b := g.ColorAt(15, 0), g.ColorAt(10, 0); a == b {
+		t.Error("expected SetMatrix to move the gradient")
+	}
+
+	im := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	im.Set(0, 0, color.White)
+	p := NewSurfacePattern(im, RepeatBoth)
+	p.SetMatrix(Scale(5, 5))
+	if p.ColorAt(4, 4) != color.RGBAModel.Convert(color.White) || p.ColorAt(5, 5) == p.ColorAt(4, 4) {
+		t.Error("expected SetMatrix to scale the surface pattern")
+	}
+}
+
+func TestGradientColorSpace(t *testing.T) {
+	midpoint := func(space ColorSpace, hue HueInterpolation) color.NRGBA {
+		g := NewLinearGradient(0, 0, 10, 0)
+		g.AddColorStop(0, color.RGBA{255, 0, 0, 255})
+		g.AddColorStop(1, color.RGBA{0, 255, 0, 255})
+		g.SetColorSpace(space)
+		g.SetHueInterpolation(hue)
+		return color.NRGBAModel.Convert(g.ColorAt(5, 0)).(color.NRGBA)
+	}
+	if c := midpoint(ColorSpaceSRGB, HueShorter); c != (color.NRGBA{127, 127, 0, 255}) {
+		t.Errorf("unexpected sRGB midpoint: %v", c)
+	}
+	if c := midpoint(ColorSpaceLinearRGB, HueShorter); c != (color.NRGBA{188, 188, 0, 255}) {
+		t.Errorf("unexpected linear RGB midpoint: %v", c)
+	}
+	if c := midpoint(ColorSpaceOKLab, HueShorter); c.R < 140 || c.G < 140 || c.B > 10 {
+		t.Errorf("unexpected OKLab midpoint: %v", c)
+	}
+	// the shorter way from red to green passes through yellow, the longer
+	// way through blue
+	if c := midpoint(ColorSpaceOKLCH, HueShorter); c.B > c.R || c.B > c.G {
+		t.Errorf("unexpected OKLCH shorter hue midpoint: %v", c)
+	}
+	if c := midpoint(ColorSpaceOKLCH, HueLonger); c.B < c.R || c.B < c.G {
+		t.Errorf("unexpected OKLCH longer hue midpoint: %v", c)
+	}
+}
+
+func TestGradientDither(t *testing.T) {
+	render := func(dither bool) *Context {
+		g := NewLinearGradient(0, 0, 1000, 0)
+		g.AddColorStop(0, color.Gray{100})
+		g.AddColorStop(1, color.Gray{101})
+		g.SetDither(dither)
+		dc := NewContext(1000, 8)
+		dc.SetFillStyle(g)
+		dc.DrawRectangle(0, 0, 1000, 8)
+		dc.Fill()
+		return dc
+	}
+	levels := func(dc *Context) map[uint8]bool {
+		result := make(map[uint8]bool)
+		for y := 0; y < 8; y++ {
+			for x := 496; x < 504; x++ {
+				result[dc.im.RGBAAt(x, y).R] = true
+			}
+		}
+		return result
+	}
+	if n := len(levels(render(false))); n != 1 {
+		t.Errorf("expected a single level without dithering, got %d", n)
+	}
+	if n := len(levels(render(true))); n != 2 {
+		t.Errorf("expected two levels with dithering, got %d", n)
+	}
+}
+
+func TestMeshGradient(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+
+	dc := NewContext(100, 100)
+	dc.DrawRectangle(0, 0, 50, 50)
+	dc.Clip()
+	dc.MoveTo(10, 10)
+	dc.DrawTriangles([]Point{{0, 0}, {100, 0}, {0, 100}}, []color.Color{red, red, blue})
+	if !dc.hasCurrentPoint() {
+		t.Error("expected DrawTriangles to leave the path alone")
+	}
+	if c := dc.im.RGBAAt(1, 1); c.R < 250 || c.A != 255 {
+		t.Errorf("expected red near the red vertices, got %v", c)
+	}
+	if c := dc.im.RGBAAt(10, 40); c.B < 90 || c.B > 110 || c.R < 145 || c.R > 165 {
+		t.Errorf("expected interpolated color, got %v", c)
+	}
+	if c := dc.im.RGBAAt(60, 20); c.A != 0 {
+		t.Errorf("expected nothing outside the clip, got %v", c)
+	}
+	if c := dc.im.RGBAAt(40, 40); c.A != 255 {
+		t.Errorf("expected the triangle to cover, got %v", c)
+	}
+
+	// a square coons patch with straight sides is a bilinear gradient
+	var points [12]Point
+	for i := 0; i < 4; i++ {
+		points[i] = Point{float64(i) * 100 / 3, 0}
+		points[3+i] = Point{100, float64(i) * 100 / 3}
+		points[6+i] = Point{100 - float64(i)*100/3, 100}
+		points[(9+i)%12] = Point{0, 100 - float64(i)*100/3}
+	}
+	mesh := NewMeshGradient()
+	mesh.AddCoonsPatch(points, [4]color.Color{red, red, blue, blue})
+	mesh.SetMatrix(Scale(0.5, 0.5))
+	for _, x := range []int{0, 25, 49} {
+		c := color.RGBAModel.Convert(mesh.ColorAt(x, 25)).(color.RGBA)
+		if c.R < 120 || c.R > 135 || c.B < 120 || c.B > 135 {
+			t.Errorf("expected a vertical gradient, got %v at %d", c, x)
+		}
+	}
+	if c := mesh.ColorAt(60, 25); c != color.Transparent {
+		t.Errorf("expected transparent outside the mesh, got %v", c)
+	}
+
+	// triangles added after sampling, inside and outside the mesh, are
+	// sampled too
+	mesh = NewMeshGradient()
+	mesh.AddTriangle(Point{0, 0}, Point{10, 0}, Point{0, 10}, red, red, red)
+	mesh.ColorAt(1, 1)
+	mesh.AddTriangle(Point{10, 10}, Point{10, 0}, Point{0, 10}, blue, blue, blue)
+	mesh.AddTriangle(Point{50, 50}, Point{60, 50}, Point{50, 60}, blue, blue, blue)
+	for _, p := range []image.Point{{7, 7}, {51, 51}} {
+		if c := color.RGBAModel.Convert(mesh.ColorAt(p.X, p.Y)).(color.RGBA); c != blue {
+			t.Errorf("expected the added triangle at %v, got %v", p, c)
+		}
+	}
+}
+
+func TestSurfacePattern(t *testing.T) {
+	im := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	im.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	im.Set(1, 0, color.RGBA{0, 0, 255, 255})
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	at := func(p Pattern, x, y int) color.RGBA {
+		return color.RGBAModel.Convert(p.ColorAt(x, y)).(color.RGBA)
+	}
+
+	p := NewSurfacePattern(im, RepeatBoth)
+	for x, want := range map[int]color.RGBA{-3: blue, -2: red, -1: blue, 0: red, 3: blue} {
+		if c := at(p, x, -5); c != want {
+			t.Errorf("RepeatBoth: expected %v at %d, got %v", want, x, c)
+		}
+	}
+	p = NewSurfacePattern(im, RepeatMirrorX)
+	for x, want := range map[int]color.RGBA{-2: blue, -1: red, 0: red, 2: blue, 3: red, 4: red} {
+		if c := at(p, x, 0); c != want {
+			t.Errorf("RepeatMirrorX: expected %v at %d, got %v", want, x, c)
+		}
+	}
+	if c := at(p, 0, -1); c.A != 0 {
+		t.Errorf("RepeatMirrorX: expected transparent above, got %v", c)
+	}
+	p = NewSurfacePattern(im, RepeatNone)
+	if c := at(p, -1, 0); c.A != 0 {
+		t.Errorf("RepeatNone: expected transparent left of the image, got %v", c)
+	}
+
+	// scaled up 10 times, with pixel 0 at the center of the first pixel of
+	// the image and pixel 5 half way to the next one
+	p = NewSurfacePattern(im, RepeatBoth)
+	p.SetMatrix(Scale(10, 10).Multiply(Translate(-4.5, -4.5)))
+	for _, filter := range []Filter{FilterBilinear, FilterBicubic} {
+		p.SetFilter(filter)
+		if c := at(p, 0, 0); c != red {
+			t.Errorf("filter %d: expected red at a pixel center, got %v", filter, c)
+		}
+		if c := at(p, 5, 0); c.R < 120 || c.R > 135 || c.B < 120 || c.B > 135 || c.A != 255 {
+			t.Errorf("filter %d: expected an even mix, got %v", filter, c)
+		}
+	}
+}
+
+func TestHatchPatterns(t *testing.T) {
+	black := color.RGBA{0, 0, 0, 255}
+	white := color.RGBA{255, 255, 255, 255}
+	at := func(p Pattern, x, y int) color.RGBA {
+		return color.RGBAModel.Convert(p.ColorAt(x, y)).(color.RGBA)
+	}
+
+	// horizontal lines 2 pixels wide, centered on y = 0, 10, 20...
+	p := NewHatchPattern(0, 10, 2, black, white)
+	for y, want := range map[int]color.RGBA{0: black, -1: black, 5: white, 9: black, 10: black, 15: white} {
+		if c := at(p, 3, y); c != want {
+			t.Errorf("hatch: expected %v at y = %d, got %v", want, y, c)
+		}
+	}
+	// a line 1 pixel wide centered between pixels covers half of each
+	p = NewHatchPattern(0, 10, 1, black, white)
+	if c := at(p, 3, 0); c.R < 126 || c.R > 129 {
+		t.Errorf("hatch: expected an antialiased line, got %v", c)
+	}
+	// the same line scaled up by the context is sharp
+	dc := NewContext(40, 40)
+	dc.Scale(4, 4)
+	dc.SetFillStyle(p)
+	dc.DrawRectangle(0, 0, 10, 10)
+	dc.Fill()
+	if c := dc.im.RGBAAt(5, 1); c != black {
+		t.Errorf("hatch: expected a sharp scaled line, got %v", c)
+	}
+	if c := dc.im.RGBAAt(5, 2); c != white {
+		t.Errorf("hatch: expected a sharp scaled line, got %v", c)
+	}
+
+	p = NewCheckerboardPattern(4, black, white)
+	for _, tc := range []struct {
+		x, y int
+		want color.RGBA
+	}{{1, 1, black}, {5, 1, white}, {5, 5, black}, {-3, 1, white}, {-3, -3, black}} {
+		if c := at(p, tc.x, tc.y); c != tc.want {
+			t.Errorf("checkerboard: expected %v at %d, %d, got %v", tc.want, tc.x, tc.y, c)
+		}
+	}
+
+	p = NewDotPattern(10, 3, black, nil)
+	if c := at(p, 4, 4); c != black {
+		t.Errorf("dots: expected a dot, got %v", c)
+	}
+	if c := at(p, 0, 0); c.A != 0 {
+		t.Errorf("dots: expected a transparent background, got %v", c)
+	}
+
+	p = NewStripePattern(90, 5, black, white)
+	if c, d := at(p, 2, 0), at(p, 7, 0); c == d {
+		t.Errorf("stripes: expected vertical stripes, got %v and %v", c, d)
+	}
+
+	var buf bytes.Buffer
+	dc = NewSVGContext(40, 40)
+	dc.SetFillStyle(NewCrossHatchPattern(45, 10, 2, black, white))
+	dc.DrawRectangle(0, 0, 40, 40)
+	dc.Fill()
+	dc.EncodeSVG(&buf)
+	if s := buf.String(); !strings.Contains(s, `patternTransform="matrix(`) || strings.Contains(s, "<image") {
+		t.Errorf("expected a native SVG pattern:\n%s", s)
+	}
+}
+
+func TestNoise(t *testing.T) {
+	noises := map[string]Noise{
+		"perlin":  NewPerlinNoise(1, 10),
+		"simplex": NewSimplexNoise(1, 10),
+		"value":   NewValueNoise(1, 10),
+		"worley":  NewWorleyNoise(1, 10),
+		"fractal": NewFractalNoise(NewPerlinNoise(1, 10), 4, 2, 0.5),
+	}
+	for name, n := range noises {
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for y := 0.0; y < 100; y += 1.3 {
+			for x := 0.0; x < 100; x += 1.3 {
+				v := n.At(x, y)
+				lo, hi = math.Min(lo, v), math.Max(hi, v)
+				// smooth: nearby points have nearby values
+				if d := math.Abs(n.At(x+0.01, y) - v); d > 0.05 {
+					t.Errorf("%s: expected smooth noise, jumped by %g at %g, %g", name, d, x, y)
+				}
+			}
+		}
+		if lo < -1 || hi > 1 || hi-lo < 0.5 {
+			t.Errorf("%s: expected values spread over [-1, 1], got [%g, %g]", name, lo, hi)
+		}
+	}
+	if NewPerlinNoise(1, 10).At(3.3, 4.4) != NewPerlinNoise(1, 10).At(3.3, 4.4) {
+		t.Error("expected the same noise for the same seed")
+	}
+	if NewPerlinNoise(1, 10).At(3.3, 4.4) == NewPerlinNoise(2, 10).At(3.3, 4.4) {
+		t.Error("expected different noise for different seeds")
+	}
+
+	p := NewNoisePattern(NewValueNoise(1, 10), NewColormap(color.Black, color.White))
+	c := color.GrayModel.Convert(p.ColorAt(5, 5)).(color.Gray)
+	want := uint8((NewValueNoise(1, 10).At(5.5, 5.5) + 1) / 2 * 255)
+	if d := int(c.Y) - int(want); d < -2 || d > 2 {
+		t.Errorf("expected the noise mapped to gray %d, got %d", want, c.Y)
+	}
+
+	path := NewPath()
+	path.DrawRectangle(0, 0, 100, 100)
+	displaced := path.Displace(NewPerlinNoise(1, 20), 5, 10)
+	segments := displaced.Segments()
+	if n := len(segments); n != 41 {
+		t.Errorf("expected 40 displaced points and a close, got %d segments", n)
+	}
+	for _, s := range segments {
+		for _, q := range s.Points {
+			if q.X < -5 || q.X > 105 || q.Y < -5 || q.Y > 105 {
+				t.Errorf("expected points moved by at most 5, got %v", q)
+			}
+		}
+	}
+	if segments[len(segments)-1].Type != SegmentClosePath {
+		t.Error("expected the displaced path to stay closed")
+	}
+}
+
+func TestStrokeToPath(t *testing.T) {
+	draw := func(toPath bool) *Context {
+		dc := NewContext(100, 100)
+		dc.SetRGB(0, 0, 0)
+		dc.SetLineWidth(8)
+		dc.SetLineJoin(LineJoinRound)
+		dc.SetDash(30, 10)
+		dc.MoveTo(10, 10)
+		dc.LineTo(90, 30)
+		dc.QuadraticTo(10, 50, 80, 90)
+		if toPath {
+			dc.StrokeToPath()
+			dc.SetDash()
+			dc.Fill()
+		} else {
+			dc.Stroke()
+		}
+		return dc
+	}
+	// curves are flattened along a different route, so the edges may differ
+	// slightly
+	a, b := draw(false), draw(true)
+	for i := range a.im.Pix {
+		if d := int(a.im.Pix[i]) - int(b.im.Pix[i]); d < -32 || d > 32 {
+			t.Fatalf("expected filling the stroke outline to match stroking, differs at %d by %d", i/4, d)
+		}
+	}
+
+	dc := NewContext(100, 100)
+	dc.SetLineWidth(10)
+	dc.DrawLine(10, 50, 90, 50)
+	dc.StrokeToPath()
+	if !dc.InFill(50, 54) || dc.InFill(50, 56) {
+		t.Error("expected the path to be the outline of the stroke")
+	}
+}
+
+func TestStrokeAlign(t *testing.T) {
+	cases := []struct {
+		align           StrokeAlign
+		inside, outside uint8
+	}{
+		{StrokeAlignCenter, 255, 255},
+		{StrokeAlignInside, 255, 0},
+		{StrokeAlignOutside, 0, 255},
+	}
+	for _, c := range cases {
+		dc := NewContext(100, 100)
+		dc.SetRGB(0, 0, 0)
+		dc.SetLineWidth(4)
+		dc.SetLineJoinMiter()
+		dc.SetStrokeAlign(c.align)
+		dc.DrawRectangle(10, 10, 80, 80)
+		dc.Stroke()
+		// the pixels just inside and outside of the left and top edges
+		for _, p := range [][2]int{{11, 50}, {50, 11}} {
+			if a := dc.im.RGBAAt(p[0], p[1]).A; a != c.inside {
+				t.Errorf("align %d: expected alpha %d inside at %v, got %d", c.align, c.inside, p, a)
+			}
+		}
+		for _, p := range [][2]int{{8, 50}, {50, 8}} {
+			if a := dc.im.RGBAAt(p[0], p[1]).A; a != c.outside {
+				t.Errorf("align %d: expected alpha %d outside at %v, got %d", c.align, c.outside, p, a)
+			}
+		}
+		if a := dc.im.RGBAAt(50, 50).A; a != 0 {
+			t.Errorf("align %d: expected the middle to be empty, got %d", c.align, a)
+		}
+	}
+}
+
+func TestDrawStringOnPath(t *testing.T) {
+	inkBounds := func(dc *Context) image.Rectangle {
+		var r image.Rectangle
+		b := dc.im.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if dc.im.RGBAAt(x, y).A > 0 {
+					r = r.Union(image.Rect(x, y, x+1, y+1))
+				}
+			}
+		}
+		return r
+	}
+	line := NewPath()
+	line.DrawLine(10, 50, 190, 50)
+
+	// along a horizontal line, the text is drawn as by DrawString
+	a := NewContext(200, 100)
+	a.SetRGB(0, 0, 0)
+	a.DrawString("Hello, path!", 10, 50)
+	b := NewContext(200, 100)
+	b.SetRGB(0, 0, 0)
+	b.DrawStringOnPath("Hello, path!", line, 0, AlignLeft)
+	if hash(a) != hash(b) {
+		t.Error("expected the same text as DrawString along a horizontal line")
+	}
+
+	// along a vertical line going down, the text is rotated with its top
+	// towards positive x
+	dc := NewContext(100, 200)
+	dc.SetRGB(0, 0, 0)
+	dc.MoveTo(50, 10)
+	dc.LineTo(50, 190)
+	dc.DrawStringOnPath("Hello", nil, 0, AlignLeft)
+	if r := inkBounds(dc); r.Min.X < 50 || r.Max.X > 65 || r.Dy() < 25 {
+		t.Errorf("expected a vertical column of text right of the path, got %v", r)
+	}
+
+	short := NewPath()
+	short.DrawLine(10, 50, 30, 50)
+	for _, c := range []struct {
+		overflow TextPathOverflow
+		maxX     int
+	}{{TextPathClip, 24}, {TextPathFit, 30}, {TextPathExtend, 45}} {
+		dc := NewContext(100, 100)
+		dc.SetRGB(0, 0, 0)
+		dc.SetTextPathOverflow(c.overflow)
+		dc.DrawStringOnPath("HELLO", short, 0, AlignLeft)
+		if r := inkBounds(dc); r.Max.X > c.maxX || r.Max.X < c.maxX-8 {
+			t.Errorf("overflow %d: expected text up to x = %d, got %v", c.overflow, c.maxX, r)
+		}
+	}
+
+	dc = NewContext(200, 100)
+	dc.SetRGB(0, 0, 0)
+	dc.SetTextPathSide(TextPathBelow)
+	dc.DrawStringOnPath("HELLO", line, 90, AlignCenter)
+	if r := inkBounds(dc); r.Min.Y < 50 || r.Min.X < 70 || r.Max.X > 120 {
+		t.Errorf("expected centered text below the path, got %v", r)
+	}
+}
+
+func TestTextPath(t *testing.T) {
+	// bitmap faces are traced pixel by pixel, which fills the same pixels
+	a := NewContext(100, 40)
+	a.SetRGB(0, 0, 0)
+	a.DrawString("Hello", 10, 20)
+	b := NewContext(100, 40)
+	b.SetRGB(0, 0, 0)
+	b.TextPath("Hello", 10, 20)
+	b.Fill()
+	if hash(a) != hash(b) {
+		t.Error("expected filling the text path of a bitmap face to match DrawString")
+	}
+
+	face, err := ParseFontFace(goregular.TTF, 48)
+	if err != nil {
+		t.Fatal(err)
+	}
+	draw := func(outline bool) *Context {
+		dc := NewContext(200, 80)
+		dc.SetFontFace(face)
+		dc.SetRGB(0, 0, 0)
+		if outline {
+			dc.TextPath("Go!", 10, 60)
+			dc.Fill()
+		} else {
+			dc.DrawString("Go!", 10, 60)
+		}
+		return dc
+	}
+	// the glyph images are antialiased differently, but cover the same area
+	a, b = draw(false), draw(true)
+	var coverageA, coverageB float64
+	for i := 3; i < len(a.im.Pix); i += 4 {
+		coverageA += float64(a.im.Pix[i])
+		coverageB += float64(b.im.Pix[i])
+	}
+	if coverageA == 0 || math.Abs(coverageA-coverageB)/coverageA > 0.05 {
+		t.Errorf("expected the outlines to cover the glyphs, got %g for %g", coverageB, coverageA)
+	}
+
+	dc := NewContext(200, 80)
+	dc.SetFontFace(face)
+	dc.TextPath("O", 10, 60)
+	var curves int
+	for _, s := range dc.CopyPath().Segments() {
+		if s.Type == SegmentQuadraticTo {
+			curves++
+		}
+	}
+	if curves == 0 {
+		t.Error("expected quadratic curves in the outline")
+	}
+	// the counter of the O is a hole
+	w, _ := dc.MeasureString("O")
+	if !dc.InFill(10+w/2, 60-2) || dc.InFill(10+w/2, 60-17) {
+		t.Error("expected the outline of an O with a hole")
+	}
+}
+
+func TestTextFillStyle(t *testing.T) {
+	face, err := ParseFontFace(goregular.TTF, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc := NewContext(200, 60)
+	dc.SetFontFace(face)
+	g := NewLinearGradient(0, 0, 200, 0)
+	g.AddColorStop(0, color.RGBA{255, 0, 0, 255})
+	g.AddColorStop(1, color.RGBA{0, 0, 255, 255})
+	dc.SetFillStyle(g)
+	dc.DrawString("MMMMMM", 10, 45)
+	var left, right color.RGBA
+	for y := 0; y < 60; y++ {
+		for x := 0; x < 200; x++ {
+			c := dc.im.RGBAAt(x, y)
+			if c.A < 255 {
+				continue
+			}
+			if x < 60 && left.A == 0 {
+				left = c
+			}
+			if x > 140 {
+				right = c
+			}
+		}
+	}
+	if left.A == 0 || right.A == 0 || left.R < left.B || right.B < right.R {
+		t.Errorf("expected the text to be filled with the gradient, got %v on the left and %v on the right", left, right)
+	}
+
+	// the stroke is drawn around the outlines and the path is kept
+	dc = NewContext(200, 60)
+	dc.SetFontFace(face)
+	dc.SetRGB(0, 0, 0)
+	dc.SetLineWidth(2)
+	dc.MoveTo(0, 0)
+	dc.LineTo(10, 10)
+	dc.StrokeString("O", 10, 45)
+	if n := len(dc.CopyPath().Segments()); n != 2 {
+		t.Errorf("expected the current path to be kept, got %d segments", n)
+	}
+	w, _ := dc.MeasureString("O")
+	if c := dc.im.RGBAAt(int(10+w/2), 45-15); c.A != 0 {
+		t.Errorf("expected the inside of the O to be empty, got %v", c)
+	}
+	var ink int
+	for i := 3; i < len(dc.im.Pix); i += 4 {
+		if dc.im.Pix[i] > 0 {
+			ink++
+		}
+	}
+	if ink == 0 {
+		t.Error("expected the outline of the text to be stroked")
+	}
+}
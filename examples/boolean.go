@@ -0,0 +1,22 @@
+package main
+
+import "github.com/fogleman/gg"
+
+func main() {
+	const S = 1024
+	a := gg.NewPath()
+	a.DrawCircle(S*3/8, S/2, S/4)
+	b := gg.NewPath()
+	b.DrawCircle(S*5/8, S/2, S/4)
+
+	dc := gg.NewContext(S, S)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+	dc.AppendPath(a.Xor(b, gg.FillRuleWinding))
+	dc.SetRGB(0.2, 0.4, 0.8)
+	dc.FillPreserve()
+	dc.SetRGB(0, 0, 0)
+	dc.SetLineWidth(4)
+	dc.Stroke()
+	dc.SavePNG("out.png")
+}
@@ -0,0 +1,24 @@
+package main
+
+import "github.com/fogleman/gg"
+
+func main() {
+	const W = 1024
+	const H = 256
+	dc := gg.NewContext(W, H)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+	dc.SetRGB(0, 0, 0)
+	if err := dc.LoadFontFace("/Library/Fonts/Arial.ttf", 48); err != nil {
+		panic(err)
+	}
+	// CJK and symbols that Arial has no glyphs for come from the fallbacks
+	if err := dc.LoadFontFallback("/Library/Fonts/Arial Unicode.ttf", 48); err != nil {
+		panic(err)
+	}
+	if err := dc.LoadFontFallback("/System/Library/Fonts/Apple Symbols.ttf", 48); err != nil {
+		panic(err)
+	}
+	dc.DrawStringAnchored("Hello, 世界! ☀ ☂ ★", W/2, H/2, 0.5, 0.5)
+	dc.SavePNG("out.png")
+}
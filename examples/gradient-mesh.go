@@ -0,0 +1,39 @@
+package main
+
+import (
+	"image/color"
+
+	"github.com/fogleman/gg"
+)
+
+func main() {
+	dc := gg.NewContext(400, 400)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+
+	mesh := gg.NewMeshGradient()
+	mesh.AddCoonsPatch([12]gg.Point{
+		{20, 20}, {80, 0}, {120, 40}, {180, 20},
+		{200, 80}, {160, 120}, {180, 180},
+		{120, 200}, {80, 160}, {20, 180},
+		{40, 120}, {0, 80},
+	}, [4]color.Color{
+		color.RGBA{255, 0, 0, 255},
+		color.RGBA{255, 255, 0, 255},
+		color.RGBA{0, 0, 255, 255},
+		color.RGBA{0, 255, 0, 255},
+	})
+	dc.SetFillStyle(mesh)
+	dc.DrawRectangle(0, 0, 200, 200)
+	dc.Fill()
+
+	dc.DrawTriangles([]gg.Point{
+		{300, 20}, {380, 180}, {220, 180},
+		{220, 220}, {380, 220}, {300, 380},
+	}, []color.Color{
+		color.RGBA{255, 0, 0, 255}, color.RGBA{0, 255, 0, 255}, color.RGBA{0, 0, 255, 255},
+		color.RGBA{0, 255, 255, 255}, color.RGBA{255, 0, 255, 255}, color.RGBA{255, 255, 0, 255},
+	})
+
+	dc.SavePNG("gradient-mesh.png")
+}
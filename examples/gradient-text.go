@@ -13,18 +13,9 @@ const (
 
 func main() {
 	dc := gg.NewContext(W, H)
-
-	// draw text
-	dc.SetRGB(0, 0, 0)
-	dc.LoadFontFace("/Library/Fonts/Impact.ttf", 128)
-	dc.DrawStringAnchored("Gradient Text", W/2, H/2, 0.5, 0.5)
-
-	// get the context as an alpha mask
-	mask := dc.AsMask()
-
-	// clear the context
 	dc.SetRGB(1, 1, 1)
 	dc.Clear()
+	dc.LoadFontFace("/Library/Fonts/Impact.ttf", 128)
 
 	// set a gradient
 	g := gg.NewLinearGradient(0, 0, W, H)
@@ -32,10 +23,14 @@ func main() {
 	g.AddColorStop(1, color.RGBA{0, 0, 255, 255})
 	dc.SetFillStyle(g)
 
-	// using the mask, fill the context with the gradient
-	dc.SetMask(mask)
-	dc.DrawRectangle(0, 0, W, H)
-	dc.Fill()
+	// text is filled with the fill style
+	dc.DrawStringAnchored("Gradient Text", W/2, H/2, 0.5, 0.5)
+
+	// and outlined with the stroke style
+	w, h := dc.MeasureString("Gradient Text")
+	dc.SetStrokeStyle(gg.NewSolidPattern(color.Black))
+	dc.SetLineWidth(3)
+	dc.StrokeString("Gradient Text", W/2-w/2, H/2+h/2)
 
 	dc.SavePNG("out.png")
 }
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"image/color"
+
+	"github.com/fogleman/gg"
+)
+
+func main() {
+	const S = 120
+	black := color.Black
+	white := color.White
+	patterns := []gg.Pattern{
+		gg.NewHatchPattern(45, 10, 2, black, white),
+		gg.NewCrossHatchPattern(30, 12, 1.5, black, white),
+		gg.NewDotPattern(10, 3, black, white),
+		gg.NewStripePattern(-30, 6, color.RGBA{0, 90, 180, 255}, white),
+		gg.NewCheckerboardPattern(10, black, white),
+		gg.NewHatchPattern(0, 8, 1, color.RGBA{200, 0, 0, 255}, nil),
+	}
+	dc := gg.NewContext(3*S, 2*S)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+	for i, p := range patterns {
+		x := float64(i%3)*S + S/2
+		y := float64(i/3)*S + S/2
+		dc.SetFillStyle(p)
+		dc.DrawCircle(x, y, S/2-10)
+		dc.FillPreserve()
+		dc.SetRGB(0, 0, 0)
+		dc.SetLineWidth(2)
+		dc.Stroke()
+	}
+	dc.SavePNG("hatch.png")
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"image/color"
+
+	"github.com/fogleman/gg"
+)
+
+func main() {
+	const S = 512
+	dc := gg.NewContext(S, S)
+
+	noise := gg.NewFractalNoise(gg.NewSimplexNoise(1, 200), 6, 2, 0.5)
+	colormap := gg.NewColormap(
+		color.RGBA{10, 20, 80, 255},
+		color.RGBA{30, 110, 180, 255},
+		color.RGBA{230, 220, 160, 255},
+		color.RGBA{60, 140, 60, 255},
+		color.RGBA{250, 250, 250, 255},
+	)
+	dc.SetFillStyle(gg.NewNoisePattern(noise, colormap))
+	dc.DrawRectangle(0, 0, S, S)
+	dc.Fill()
+
+	wobble := gg.NewPerlinNoise(2, 60)
+	dc.SetRGBA(0, 0, 0, 0.8)
+	dc.SetLineWidth(3)
+	for r := 40.0; r < S/2; r += 40 {
+		dc.DrawCircle(S/2, S/2, r)
+		dc.DisplacePath(wobble, 12, 4)
+		dc.Stroke()
+	}
+
+	dc.SavePNG("noise.png")
+}
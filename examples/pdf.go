@@ -0,0 +1,34 @@
+package main
+
+import (
+	"image/color"
+
+	"github.com/fogleman/gg"
+)
+
+func main() {
+	const W = 612
+	const H = 792
+	dc := gg.NewPDFContext(W, H)
+	if err := dc.LoadFontFace("/Library/Fonts/Arial.ttf", 36); err != nil {
+		panic(err)
+	}
+	for page := 1; page <= 3; page++ {
+		if page > 1 {
+			dc.NewPage()
+		}
+		g := gg.NewRadialGradient(W/2, H/2, 0, W/2, H/2, 300)
+		g.AddColorStop(0, color.RGBA{255, 255, 255, 255})
+		g.AddColorStop(1, color.RGBA{0, 128, 255, 255})
+		dc.SetFillStyle(g)
+		dc.DrawCircle(W/2, H/2, 250)
+		dc.Fill()
+		dc.SetRGB(0, 0, 0)
+		dc.SetLineWidth(4)
+		dc.DrawRegularPolygon(page+2, W/2, H/2, 200, 0)
+		dc.Stroke()
+		dc.DrawStringAnchored("Page", W/2, 100, 0.5, 0.5)
+		dc.DrawStringAnchored(string(rune('0'+page)), W/2, H-100, 0.5, 0.5)
+	}
+	dc.SavePDF("out.pdf")
+}
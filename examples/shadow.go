@@ -0,0 +1,27 @@
+package main
+
+import (
+	"image/color"
+
+	"github.com/fogleman/gg"
+)
+
+func main() {
+	const S = 1024
+	dc := gg.NewContext(S, S)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+	dc.SetShadow(8, 12, 24, color.RGBA{0, 0, 0, 128})
+	dc.DrawRoundedRectangle(192, 192, 640, 400, 32)
+	dc.SetRGB(1, 1, 1)
+	dc.Fill()
+	dc.SetShadow(0, 0, 16, color.RGBA{255, 160, 0, 255})
+	dc.SetRGB(0.2, 0.2, 0.2)
+	dc.DrawStringAnchored("Hello, Shadow!", S/2, 392, 0.5, 0.5)
+	dc.SetShadow(4, 4, 4, color.RGBA{0, 0, 0, 96})
+	dc.SetRGB(0.9, 0.3, 0.2)
+	dc.SetLineWidth(12)
+	dc.DrawCircle(S/2, 800, 80)
+	dc.Stroke()
+	dc.SavePNG("out.png")
+}
@@ -0,0 +1,30 @@
+package main
+
+import "github.com/fogleman/gg"
+
+var lines = []string{
+	"Hello, world!",
+	"שלום עולם! (Hello, world!)",
+	"مرحبا بالعالم 2024",
+	"नमस्ते दुनिया, कर्म और क्षत्रिय",
+	"สวัสดีชาวโลก น้ำ",
+	"The word עברית means Hebrew.",
+}
+
+func main() {
+	const W = 1024
+	const H = 512
+	dc := gg.NewContext(W, H)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+	dc.SetRGB(0, 0, 0)
+	// a font with glyphs for Arabic, Hebrew, Devanagari and Thai
+	if err := dc.LoadFontFace("/Library/Fonts/Arial Unicode.ttf", 36); err != nil {
+		panic(err)
+	}
+	for i, line := range lines {
+		y := 64 + float64(i)*72
+		dc.DrawStringAnchored(line, W/2, y, 0.5, 0.5)
+	}
+	dc.SavePNG("out.png")
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"image/color"
+
+	"github.com/fogleman/gg"
+)
+
+func main() {
+	dc := gg.NewSVGContext(1000, 1000)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+
+	g := gg.NewLinearGradient(100, 100, 900, 900)
+	g.AddColorStop(0, color.RGBA{255, 0, 0, 255})
+	g.AddColorStop(1, color.RGBA{0, 0, 255, 255})
+	dc.SetFillStyle(g)
+	dc.DrawRoundedRectangle(100, 100, 800, 800, 64)
+	dc.Fill()
+
+	dc.DrawCircle(500, 500, 300)
+	dc.Clip()
+	dc.SetRGBA(1, 1, 1, 0.5)
+	dc.SetLineWidth(16)
+	dc.SetDash(32, 16)
+	for i := 0; i < 10; i++ {
+		y := 200 + float64(i)*64
+		dc.DrawLine(100, y, 900, y)
+	}
+	dc.Stroke()
+	dc.ResetClip()
+
+	dc.SetRGB(0, 0, 0)
+	dc.DrawStringAnchored("Hello, SVG!", 500, 950, 0.5, 0.5)
+
+	dc.SaveSVG("out.svg")
+	dc.SavePNG("out.png")
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"math"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font/gofont/gobold"
+)
+
+func main() {
+	const S = 400
+	dc := gg.NewContext(S, S)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+
+	font, err := truetype.Parse(gobold.TTF)
+	if err != nil {
+		panic(err)
+	}
+	dc.SetFontFace(truetype.NewFace(font, &truetype.Options{Size: 28}))
+
+	dc.SetRGB(0.2, 0.3, 0.6)
+	dc.DrawCircle(S/2, S/2, 160)
+	dc.SetLineWidth(4)
+	dc.Stroke()
+
+	// clockwise along the top of a circle, centered at its top
+	top := gg.NewPath()
+	top.DrawArc(S/2, S/2, 120, math.Pi, 2*math.Pi)
+	dc.DrawStringOnPath("GO GRAPHICS", top, top.Length()/2, gg.AlignCenter)
+
+	// counterclockwise along the bottom, hanging so that it reads upright
+	bottom := gg.NewPath()
+	bottom.DrawEllipticalArc(S/2, S/2, 120, 120, math.Pi, 0)
+	dc.SetTextPathSide(gg.TextPathBelow)
+	dc.DrawStringOnPath("TEXT ON A PATH", bottom, bottom.Length()/2, gg.AlignCenter)
+
+	dc.SavePNG("text-on-path.png")
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"image/color"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font/gofont/gobold"
+)
+
+const (
+	W = 1024
+	H = 300
+)
+
+func main() {
+	dc := gg.NewContext(W, H)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+
+	face, err := gg.ParseFontFace(gobold.TTF, 160)
+	if err != nil {
+		panic(err)
+	}
+	dc.SetFontFace(face)
+
+	// the text as a path, slanted and filled with a gradient
+	dc.Shear(-0.25, 0)
+	w, _ := dc.MeasureString("Outlines")
+	dc.TextPath("Outlines", (W-w)/2+40, H/2+55)
+
+	g := gg.NewLinearGradient(0, 0, W, H)
+	g.AddColorStop(0, color.RGBA{255, 0, 0, 255})
+	g.AddColorStop(1, color.RGBA{0, 0, 255, 255})
+	dc.SetFillStyle(g)
+	dc.FillPreserve()
+
+	dc.SetRGB(0, 0, 0)
+	dc.SetLineWidth(4)
+	dc.Stroke()
+
+	dc.SavePNG("text-outline.png")
+}
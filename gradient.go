@@ -28,39 +28,94 @@ func (s stops) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 }
 
+type Extend int
+
+const (
+	ExtendPad Extend = iota
+	ExtendRepeat
+	ExtendReflect
+)
+
+// apply maps the gradient position according to the extend mode. Positions
+// outside [0, 1] are left as is by ExtendPad, wrapped around by ExtendRepeat
+// and mirrored back and forth by ExtendReflect.
+func (e Extend) apply(t float64) float64 {
+	switch e {
+	case ExtendRepeat:
+		return t - math.Floor(t)
+	case ExtendReflect:
+		t = math.Mod(math.Abs(t), 2)
+		if t > 1 {
+			t = 2 - t
+		}
+	}
+	return t
+}
+
 type Gradient interface {
 	Pattern
 	AddColorStop(offset float64, color color.Color)
+
+	// SetExtend sets how the gradient is continued before its start and
+	// past its end. The default is ExtendPad, which uses the colors of the
+	// first and last stops.
+	SetExtend(extend Extend)
+
+	// SetMatrix sets the matrix that maps the coordinates the gradient was
+	// defined with to the space in which it is used, which is the user
+	// space of the context when the gradient is set as its fill or stroke
+	// style. The default is the identity matrix.
+	SetMatrix(m Matrix)
+
+	// SetColorSpace sets the color space used to interpolate between the
+	// color stops. The default is ColorSpaceSRGB.
+	SetColorSpace(space ColorSpace)
+
+	// SetHueInterpolation sets the direction in which hues are interpolated
+	// in ColorSpaceOKLCH. The default is HueShorter.
+	SetHueInterpolation(hue HueInterpolation)
+
+	// SetDither enables ordered dithering of the gradient colors, which
+	// hides the banding of wide, smooth gradients.
+	SetDither(dither bool)
 }
 
 // Linear Gradient
 type linearGradient struct {
 	x0, y0, x1, y1 float64
 	stops          stops
+	extend         Extend
+	matrix         Matrix
+	inverse        Matrix
+	colorInterpolation
 }
 
 func (g *linearGradient) ColorAt(x, y int) color.Color {
+	return g.sample(float64(x), float64(y))
+}
+
+func (g *linearGradient) sample(fx, fy float64) color.Color {
 	if len(g.stops) == 0 {
 		return color.Transparent
 	}
 
-	fx, fy := float64(x), float64(y)
+	fx, fy = transformPixel(g.inverse, fx, fy)
 	x0, y0, x1, y1 := g.x0, g.y0, g.x1, g.y1
 	dx, dy := x1-x0, y1-y0
 
 	// Horizontal
 	if dy == 0 && dx != 0 {
-		return getColor((fx-x0)/dx, g.stops)
+		return g.getColor(g.extend.apply((fx-x0)/dx), g.stops)
 	}
 
 	// Vertical
 	if dx == 0 && dy != 0 {
-		return getColor((fy-y0)/dy, g.stops)
+		return g.getColor(g.extend.apply((fy-y0)/dy), g.stops)
 	}
 
 	// Dot product
 	s0 := dx*(fx-x0) + dy*(fy-y0)
-	if s0 < 0 {
+	if s0 < 0 && g.extend == ExtendPad {
 		return g.stops[0].color
 	}
 	// Calculate distance to (x0,y0) alone (x0,y0)->(x1,y1)
@@ -68,7 +123,10 @@ func (g *linearGradient) ColorAt(x, y int) color.Color {
 	u := ((fx-x0)*-dy + (fy-y0)*dx) / (mag * mag)
 	x2, y2 := x0+u*-dy, y0+u*dx
 	d := math.Hypot(fx-x2, fy-y2) / mag
-	return getColor(d, g.stops)
+	if s0 < 0 {
+		d = -d
+	}
+	return g.getColor(g.extend.apply(d), g.stops)
 }
 
 func (g *linearGradient) AddColorStop(offset float64, color color.Color) {
@@ -76,10 +134,21 @@ func (g *linearGradient) AddColorStop(offset float64, color color.Color) {
 	sort.Sort(g.stops)
 }
 
+func (g *linearGradient) SetExtend(extend Extend) {
+	g.extend = extend
+}
+
+func (g *linearGradient) SetMatrix(m Matrix) {
+	g.matrix = m
+	g.inverse = m.Invert()
+}
+
 func NewLinearGradient(x0, y0, x1, y1 float64) Gradient {
 	g := &linearGradient{
 		x0: x0, y0: y0,
 		x1: x1, y1: y1,
+		matrix:  Identity(),
+		inverse: Identity(),
 	}
 	return g
 }
@@ -94,6 +163,10 @@ type radialGradient struct {
 	a, inva    float64
 	mindr      float64
 	stops      stops
+	extend     Extend
+	matrix     Matrix
+	inverse    Matrix
+	colorInterpolation
 }
 
 func dot3(x0, y0, z0, x1, y1, z1 float64) float64 {
@@ -101,13 +174,18 @@ func dot3(x0, y0, z0, x1, y1, z1 float64) float64 {
 }
 
 func (g *radialGradient) ColorAt(x, y int) color.Color {
+	return g.sample(float64(x), float64(y))
+}
+
+func (g *radialGradient) sample(x, y float64) color.Color {
 	if len(g.stops) == 0 {
 		return color.Transparent
 	}
 
 	// copy from pixman's pixman-radial-gradient.c
 
-	dx, dy := float64(x)+0.5-g.c0.x, float64(y)+0.5-g.c0.y
+	x, y = transformPixel(g.inverse, x, y)
+	dx, dy := x+0.5-g.c0.x, y+0.5-g.c0.y
 	b := dot3(dx, dy, g.c0.r, g.cd.x, g.cd.y, g.cd.r)
 	c := dot3(dx, dy, -g.c0.r, dx, dy, g.c0.r)
 
@@ -117,7 +195,7 @@ func (g *radialGradient) ColorAt(x, y int) color.Color {
 		}
 		t := 0.5 * c / b
 		if t*g.cd.r >= g.mindr {
-			return getColor(t, g.stops)
+			return g.getColor(g.extend.apply(t), g.stops)
 		}
 		return color.Transparent
 	}
@@ -129,9 +207,9 @@ func (g *radialGradient) ColorAt(x, y int) color.Color {
 		t1 := (b - sqrtdiscr) * g.inva
 
 		if t0*g.cd.r >= g.mindr {
-			return getColor(t0, g.stops)
+			return g.getColor(g.extend.apply(t0), g.stops)
 		} else if t1*g.cd.r >= g.mindr {
-			return getColor(t1, g.stops)
+			return g.getColor(g.extend.apply(t1), g.stops)
 		}
 	}
 
@@ -143,6 +221,15 @@ func (g *radialGradient) AddColorStop(offset float64, color color.Color) {
 	sort.Sort(g.stops)
 }
 
+func (g *radialGradient) SetExtend(extend Extend) {
+	g.extend = extend
+}
+
+func (g *radialGradient) SetMatrix(m Matrix) {
+	g.matrix = m
+	g.inverse = m.Invert()
+}
+
 func NewRadialGradient(x0, y0, r0, x1, y1, r1 float64) Gradient {
 	c0 := circle{x0, y0, r0}
 	c1 := circle{x1, y1, r1}
@@ -154,12 +241,14 @@ func NewRadialGradient(x0, y0, r0, x1, y1, r1 float64) Gradient {
 	}
 	mindr := -c0.r
 	g := &radialGradient{
-		c0:    c0,
-		c1:    c1,
-		cd:    cd,
-		a:     a,
-		inva:  inva,
-		mindr: mindr,
+		c0:      c0,
+		c1:      c1,
+		cd:      cd,
+		a:       a,
+		inva:    inva,
+		mindr:   mindr,
+		matrix:  Identity(),
+		inverse: Identity(),
 	}
 	return g
 }
@@ -169,18 +258,25 @@ type conicGradient struct {
 	cx, cy   float64
 	rotation float64
 	stops    stops
+	inverse  Matrix
+	colorInterpolation
 }
 
 func (g *conicGradient) ColorAt(x, y int) color.Color {
+	return g.sample(float64(x), float64(y))
+}
+
+func (g *conicGradient) sample(x, y float64) color.Color {
 	if len(g.stops) == 0 {
 		return color.Transparent
 	}
-	a := math.Atan2(float64(y)-g.cy, float64(x)-g.cx)
+	x, y = transformPixel(g.inverse, x, y)
+	a := math.Atan2(y-g.cy, x-g.cx)
 	t := norm(a, -math.Pi, math.Pi) - g.rotation
 	if t < 0 {
 		t += 1
 	}
-	return getColor(t, g.stops)
+	return g.getColor(t, g.stops)
 }
 
 func (g *conicGradient) AddColorStop(offset float64, color color.Color) {
@@ -188,11 +284,20 @@ func (g *conicGradient) AddColorStop(offset float64, color color.Color) {
 	sort.Sort(g.stops)
 }
 
+// SetExtend does nothing, as a conic gradient always spans exactly one turn.
+func (g *conicGradient) SetExtend(extend Extend) {
+}
+
+func (g *conicGradient) SetMatrix(m Matrix) {
+	g.inverse = m.Invert()
+}
+
 func NewConicGradient(cx, cy, deg float64) Gradient {
 	g := &conicGradient{
 		cx:       cx,
 		cy:       cy,
 		rotation: normalizeAngle(deg) / 360,
+		inverse:  Identity(),
 	}
 	return g
 }
@@ -0,0 +1,168 @@
+package gg
+
+import (
+	"image/color"
+	"math"
+)
+
+type tileKind int
+
+const (
+	tileHatch tileKind = iota
+	tileCrossHatch
+	tileDots
+	tileStripes
+	tileCheckerboard
+)
+
+// tilePattern is a procedural pattern that repeats a tile with shapes in the
+// foreground color on the background color. It is rendered analytically, so
+// that it stays sharp and antialiased at any scale.
+type tilePattern struct {
+	kind   tileKind
+	angle  float64
+	size   float64
+	width  float64
+	fg, bg [4]float64
+
+	// the colors as given, for the vector backends
+	fgColor, bgColor color.Color
+}
+
+// NewHatchPattern returns a pattern of parallel lines, spacing apart and
+// lineWidth wide, in the color fg on the color bg. The lines run at the
+// specified angle, in degrees, from the x axis. A nil bg is transparent.
+func NewHatchPattern(angle, spacing, lineWidth float64, fg, bg color.Color) Pattern {
+	return newTilePattern(tileHatch, angle, spacing, lineWidth, fg, bg)
+}
+
+// NewCrossHatchPattern returns a pattern like NewHatchPattern with a second
+// set of lines perpendicular to the first.
+func NewCrossHatchPattern(angle, spacing, lineWidth float64, fg, bg color.Color) Pattern {
+	return newTilePattern(tileCrossHatch, angle, spacing, lineWidth, fg, bg)
+}
+
+// NewDotPattern returns a square grid of dots, spacing apart and with the
+// specified radius, in the color fg on the color bg. A nil bg is transparent.
+func NewDotPattern(spacing, radius float64, fg, bg color.Color) Pattern {
+	return newTilePattern(tileDots, 0, spacing, radius, fg, bg)
+}
+
+// NewStripePattern returns a pattern of alternating stripes in the colors fg
+// and bg, each of them width wide. The stripes run at the specified angle,
+// in degrees, from the x axis.
+func NewStripePattern(angle, width float64, fg, bg color.Color) Pattern {
+	return newTilePattern(tileStripes, angle, 2*width, width, fg, bg)
+}
+
+// NewCheckerboardPattern returns a checkerboard of squares of the specified
+// size in the colors fg and bg, with an fg square at the origin.
+func NewCheckerboardPattern(size float64, fg, bg color.Color) Pattern {
+	return newTilePattern(tileCheckerboard, 0, 2*size, size, fg, bg)
+}
+
+func newTilePattern(kind tileKind, angle, size, width float64, fg, bg color.Color) *tilePattern {
+	if fg == nil {
+		fg = color.Transparent
+	}
+	if bg == nil {
+		bg = color.Transparent
+	}
+	return &tilePattern{
+		kind: kind, angle: angle, size: size, width: width,
+		fg: premultipliedColor(fg), bg: premultipliedColor(bg),
+		fgColor: fg, bgColor: bg,
+	}
+}
+
+func (p *tilePattern) ColorAt(x, y int) color.Color {
+	return p.sample(float64(x), float64(y))
+}
+
+func (p *tilePattern) sample(x, y float64) color.Color {
+	return p.sampleArea(x, y, 1)
+}
+
+// sampleArea returns the color of the pixel at x, y whose size, in the
+// coordinates of the pattern, is pixel.
+func (p *tilePattern) sampleArea(x, y, pixel float64) color.Color {
+	if p.size <= 0 {
+		return premultipliedToRGBA64(p.bg)
+	}
+	// the coordinates of the pixel center in the tile frame
+	u, v := Rotate(-Radians(p.angle)).TransformPoint(x+0.5, y+0.5)
+	k := p.coverage(u, v, pixel)
+	var c [4]float64
+	for i := range c {
+		c[i] = p.fg[i]*k + p.bg[i]*(1-p.fg[3]*k)
+	}
+	return premultipliedToRGBA64(c)
+}
+
+// coverage returns how much of the pixel centered at u, v in the tile frame
+// is covered by the foreground. The pixel is treated as a box, which makes
+// the bands exact and the dots a close approximation.
+func (p *tilePattern) coverage(u, v, pixel float64) float64 {
+	s, w := p.size, p.width
+	switch p.kind {
+	case tileHatch:
+		return bandCoverage(v, pixel, s, -w/2, w/2)
+	case tileCrossHatch:
+		a := bandCoverage(v, pixel, s, -w/2, w/2)
+		b := bandCoverage(u, pixel, s, -w/2, w/2)
+		return 1 - (1-a)*(1-b)
+	case tileStripes:
+		return bandCoverage(v, pixel, s, 0, w)
+	case tileCheckerboard:
+		a := 2*bandCoverage(u, pixel, s, 0, w) - 1
+		b := 2*bandCoverage(v, pixel, s, 0, w) - 1
+		return (1 + a*b) / 2
+	case tileDots:
+		cu := (math.Floor(u/s) + 0.5) * s
+		cv := (math.Floor(v/s) + 0.5) * s
+		d := math.Hypot(u-cu, v-cv)
+		k := clamp01((w-d)/pixel + 0.5)
+		return math.Min(k, math.Pi*w*w/(pixel*pixel))
+	}
+	return 0
+}
+
+// bandCoverage returns the fraction of [t-pixel/2, t+pixel/2] covered by the
+// bands [a+k*period, b+k*period].
+func bandCoverage(t, pixel, period, a, b float64) float64 {
+	if pixel <= 0 {
+		pixel = 1e-9
+	}
+	// measure of the bands in [a, x]
+	measure := func(x float64) float64 {
+		x -= a
+		n := math.Floor(x / period)
+		return n*(b-a) + math.Min(x-n*period, b-a)
+	}
+	return clamp01((measure(t+pixel/2) - measure(t-pixel/2)) / pixel)
+}
+
+// tile returns the size of the tile of the pattern and the path of the
+// foreground shapes in it, for the vector backends. The tile is rotated by
+// the angle of the pattern.
+func (p *tilePattern) tile() (float64, *Path) {
+	s, w := p.size, p.width
+	path := NewPath()
+	switch p.kind {
+	case tileHatch, tileCrossHatch:
+		path.DrawRectangle(0, 0, s, w/2)
+		path.DrawRectangle(0, s-w/2, s, w/2)
+		if p.kind == tileCrossHatch {
+			path.DrawRectangle(0, 0, w/2, s)
+			path.DrawRectangle(s-w/2, 0, w/2, s)
+		}
+	case tileStripes:
+		path.DrawRectangle(0, 0, s, w)
+	case tileCheckerboard:
+		path.DrawRectangle(0, 0, w, w)
+		path.DrawRectangle(w, w, w, w)
+	case tileDots:
+		path.DrawCircle(s/2, s/2, w)
+	}
+	return s, path
+}
@@ -0,0 +1,127 @@
+package gg
+
+import (
+	"math"
+
+	"github.com/golang/freetype/raster"
+	"golang.org/x/image/math/fixed"
+)
+
+// InFill reports whether the point, in user space, is inside the area that
+// would be painted by Fill, given the current path and fill rule.
+func (dc *Context) InFill(x, y float64) bool {
+	x, y = dc.TransformPoint(x, y)
+	w := windingNumber(dc.path.flatten(), Point{x, y})
+	return insideWinding(w, dc.fillRule)
+}
+
+// InStroke reports whether the point, in user space, is inside the area that
+// would be painted by Stroke, given the current path, line width, line cap,
+// line join and dash settings.
+func (dc *Context) InStroke(x, y float64) bool {
+	x, y = dc.TransformPoint(x, y)
+	w := windingNumber(dc.strokeOutline().flatten(), Point{x, y})
+	return w != 0
+}
+
+// FillExtents returns the bounding box, in user space, of the area that
+// would be painted by Fill. All zeros are returned if the path is empty.
+func (dc *Context) FillExtents() (x1, y1, x2, y2 float64) {
+	return dc.userExtents(dc.path.flatten())
+}
+
+// StrokeExtents returns the bounding box, in user space, of the area that
+// would be painted by Stroke. All zeros are returned if the path is empty.
+func (dc *Context) StrokeExtents() (x1, y1, x2, y2 float64) {
+	return dc.userExtents(dc.strokeOutline().flatten())
+}
+
+// strokeOutline returns the outline of the area covered by the stroke, in
+// device space. The outline must be filled with the nonzero winding rule.
+// Inside and outside strokes are the halves of a stroke twice as wide that
+// are inside or outside of the filled area.
+func (dc *Context) strokeOutline() *Path {
+	width := dc.lineWidth
+	if dc.strokeAlign != StrokeAlignCenter {
+		width *= 2
+	}
+	adder := pathAdder{NewPath()}
+	raster.Stroke(adder, dc.dashedStrokePath(), fix(width), dc.capper(), dc.joiner())
+	switch dc.strokeAlign {
+	case StrokeAlignInside:
+		return adder.path.Intersection(dc.path.Union(NewPath(), dc.fillRule), FillRuleWinding)
+	case StrokeAlignOutside:
+		return adder.path.Difference(dc.path.Union(NewPath(), dc.fillRule), FillRuleWinding)
+	}
+	return adder.path
+}
+
+// userExtents returns the user space bounding box of the device space
+// polylines.
+func (dc *Context) userExtents(paths [][]Point) (x1, y1, x2, y2 float64) {
+	x1, y1 = math.Inf(1), math.Inf(1)
+	x2, y2 = math.Inf(-1), math.Inf(-1)
+	for _, points := range paths {
+		for _, p := range points {
+			x1 = math.Min(x1, p.X)
+			y1 = math.Min(y1, p.Y)
+			x2 = math.Max(x2, p.X)
+			y2 = math.Max(y2, p.Y)
+		}
+	}
+	if x1 > x2 {
+		return 0, 0, 0, 0
+	}
+	m := dc.matrix.Invert()
+	corners := [4]Point{{x1, y1}, {x2, y1}, {x1, y2}, {x2, y2}}
+	x1, y1 = math.Inf(1), math.Inf(1)
+	x2, y2 = math.Inf(-1), math.Inf(-1)
+	for _, c := range corners {
+		x, y := m.TransformPoint(c.X, c.Y)
+		x1 = math.Min(x1, x)
+		y1 = math.Min(y1, y)
+		x2 = math.Max(x2, x)
+		y2 = math.Max(y2, y)
+	}
+	return
+}
+
+// windingNumber returns the winding number of the polylines, each of them
+// implicitly closed, around the point.
+func windingNumber(paths [][]Point, p Point) int {
+	var w int
+	for _, points := range paths {
+		for i, a := range points {
+			b := points[(i+1)%len(points)]
+			if a.Y <= p.Y {
+				if b.Y > p.Y && cross(sub(b, a), sub(p, a)) > 0 {
+					w++
+				}
+			} else if b.Y <= p.Y && cross(sub(b, a), sub(p, a)) < 0 {
+				w--
+			}
+		}
+	}
+	return w
+}
+
+// pathAdder implements raster.Adder by appending to a Path.
+type pathAdder struct {
+	path *Path
+}
+
+func (a pathAdder) Start(p fixed.Point26_6) {
+	a.path.MoveTo(unfix(p.X), unfix(p.Y))
+}
+
+func (a pathAdder) Add1(p fixed.Point26_6) {
+	a.path.LineTo(unfix(p.X), unfix(p.Y))
+}
+
+func (a pathAdder) Add2(p, q fixed.Point26_6) {
+	a.path.QuadraticTo(unfix(p.X), unfix(p.Y), unfix(q.X), unfix(q.Y))
+}
+
+func (a pathAdder) Add3(p, q, r fixed.Point26_6) {
+	a.path.CubicTo(unfix(p.X), unfix(p.Y), unfix(q.X), unfix(q.Y), unfix(r.X), unfix(r.Y))
+}
@@ -59,6 +59,21 @@ func (a Matrix) Multiply(b Matrix) Matrix {
 	}
 }
 
+// Invert returns the inverse of the matrix. The zero matrix is returned if
+// the matrix is not invertible.
+func (a Matrix) Invert() Matrix {
+	d := a.XX*a.YY - a.XY*a.YX
+	if d == 0 {
+		return Matrix{}
+	}
+	return Matrix{
+		a.YY / d, -a.YX / d,
+		-a.XY / d, a.XX / d,
+		(a.XY*a.Y0 - a.YY*a.X0) / d,
+		(a.YX*a.X0 - a.XX*a.Y0) / d,
+	}
+}
+
 func (a Matrix) TransformVector(x, y float64) (tx, ty float64) {
 	tx = a.XX*x + a.XY*y
 	ty = a.YX*x + a.YY*y
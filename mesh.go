@@ -0,0 +1,366 @@
+package gg
+
+import (
+	"image/color"
+	"math"
+)
+
+// MeshGradient is a pattern made of triangles and patches whose colors are
+// smoothly interpolated between the colors of their vertices or corners, like
+// the free-form and patch mesh shadings of PDF. Where they overlap, the ones
+// added later are on top. The pattern is transparent outside of them.
+type MeshGradient interface {
+	Pattern
+
+	// AddTriangle adds a triangle with a color at each vertex. The colors are
+	// interpolated linearly over the triangle, i.e. with Gouraud shading.
+	AddTriangle(p0, p1, p2 Point, c0, c1, c2 color.Color)
+
+	// AddCoonsPatch adds a Coons patch bounded by four cubic bezier curves.
+	// The points go around the boundary: each of the four curves starts at
+	// points[3*i], has its control points at points[3*i+1] and
+	// points[3*i+2] and ends where the next one starts. The colors are those
+	// of the corners points[0], points[3], points[6] and points[9].
+	AddCoonsPatch(points [12]Point, colors [4]color.Color)
+
+	// AddTensorPatch adds a tensor-product patch defined by a 4x4 grid of
+	// bezier control points in row major order. The colors are those of the
+	// corners points[0], points[3], points[15] and points[12], in that
+	// order, as for AddCoonsPatch.
+	AddTensorPatch(points [16]Point, colors [4]color.Color)
+
+	// SetMatrix sets the matrix that maps the coordinates of the mesh to the
+	// space in which it is used, as for gradients.
+	SetMatrix(m Matrix)
+}
+
+type meshTriangle struct {
+	p      [3]Point
+	c      [3][4]float64
+	bounds [4]float64
+}
+
+type meshGradient struct {
+	triangles []meshTriangle
+	inverse   Matrix
+
+	// the triangles are bucketed on a grid, which is kept up to date as
+	// they are added so that sampling doesn't modify the gradient
+	grid       [][]int
+	gridSize   int
+	x0, y0     float64
+	cellW      float64
+	cellH      float64
+	gridBounds [4]float64
+}
+
+// NewMeshGradient returns an empty mesh gradient.
+func NewMeshGradient() MeshGradient {
+	return &meshGradient{inverse: Identity()}
+}
+
+func (g *meshGradient) SetMatrix(m Matrix) {
+	g.inverse = m.Invert()
+}
+
+func premultipliedColor(c color.Color) [4]float64 {
+	r, g, b, a := c.RGBA()
+	return [4]float64{float64(r) / 0xffff, float64(g) / 0xffff, float64(b) / 0xffff, float64(a) / 0xffff}
+}
+
+func premultipliedToRGBA64(c [4]float64) color.RGBA64 {
+	return color.RGBA64{
+		uint16(clamp01(c[0])*0xffff + 0.5), uint16(clamp01(c[1])*0xffff + 0.5),
+		uint16(clamp01(c[2])*0xffff + 0.5), uint16(clamp01(c[3])*0xffff + 0.5),
+	}
+}
+
+func (g *meshGradient) AddTriangle(p0, p1, p2 Point, c0, c1, c2 color.Color) {
+	g.addTriangle([3]Point{p0, p1, p2}, [3][4]float64{
+		premultipliedColor(c0), premultipliedColor(c1), premultipliedColor(c2),
+	})
+	g.insertTriangle(len(g.triangles) - 1)
+}
+
+func (g *meshGradient) addTriangle(p [3]Point, c [3][4]float64) {
+	t := meshTriangle{p: p, c: c}
+	t.bounds = [4]float64{
+		math.Min(p[0].X, math.Min(p[1].X, p[2].X)),
+		math.Min(p[0].Y, math.Min(p[1].Y, p[2].Y)),
+		math.Max(p[0].X, math.Max(p[1].X, p[2].X)),
+		math.Max(p[0].Y, math.Max(p[1].Y, p[2].Y)),
+	}
+	g.triangles = append(g.triangles, t)
+}
+
+func (g *meshGradient) AddCoonsPatch(points [12]Point, colors [4]color.Color) {
+	// the boundary curves, as rows and columns of the tensor grid
+	var p [4][4]Point
+	p[0][0], p[0][1], p[0][2], p[0][3] = points[0], points[1], points[2], points[3]
+	p[1][3], p[2][3], p[3][3] = points[4], points[5], points[6]
+	p[3][2], p[3][1], p[3][0] = points[7], points[8], points[9]
+	p[2][0], p[1][0] = points[10], points[11]
+
+	// the interior control points that make the tensor patch equivalent to
+	// the Coons patch, as given in the PDF specification
+	interior := func(a, b, c, d, e, f, h, i Point) Point {
+		return Point{
+			(-4*a.X + 6*(b.X+c.X) - 2*(d.X+e.X) + 3*(f.X+h.X) - i.X) / 9,
+			(-4*a.Y + 6*(b.Y+c.Y) - 2*(d.Y+e.Y) + 3*(f.Y+h.Y) - i.Y) / 9,
+		}
+	}
+	p[1][1] = interior(p[0][0], p[0][1], p[1][0], p[0][3], p[3][0], p[3][1], p[1][3], p[3][3])
+	p[1][2] = interior(p[0][3], p[0][2], p[1][3], p[0][0], p[3][3], p[3][2], p[1][0], p[3][0])
+	p[2][1] = interior(p[3][0], p[3][1], p[2][0], p[3][3], p[0][0], p[0][1], p[2][3], p[0][3])
+	p[2][2] = interior(p[3][3], p[3][2], p[2][3], p[3][0], p[0][3], p[0][2], p[2][0], p[0][0])
+	g.addPatch(p, colors)
+	g.buildGrid()
+}
+
+func (g *meshGradient) AddTensorPatch(points [16]Point, colors [4]color.Color) {
+	var p [4][4]Point
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			p[i][j] = points[i*4+j]
+		}
+	}
+	g.addPatch(p, colors)
+	g.buildGrid()
+}
+
+// addPatch tessellates the tensor-product patch into triangles. The colors
+// belong to the corners p[0][0], p[0][3], p[3][3] and p[3][0] and are
+// interpolated bilinearly in the parameter space of the patch.
+func (g *meshGradient) addPatch(p [4][4]Point, colors [4]color.Color) {
+	c00 := premultipliedColor(colors[0])
+	c01 := premultipliedColor(colors[1])
+	c11 := premultipliedColor(colors[2])
+	c10 := premultipliedColor(colors[3])
+
+	// choose the resolution from the size of the control polygon
+	var size float64
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 3; j++ {
+			size = math.Max(size, p[i][j].Distance(p[i][j+1]))
+			size = math.Max(size, p[j][i].Distance(p[j+1][i]))
+		}
+	}
+	n := int(math.Max(2, math.Min(64, math.Ceil(size*3/8))))
+
+	bernstein := func(t float64) [4]float64 {
+		s := 1 - t
+		return [4]float64{s * s * s, 3 * s * s * t, 3 * s * t * t, t * t * t}
+	}
+	points := make([][]Point, n+1)
+	colorsAt := make([][][4]float64, n+1)
+	for a := 0; a <= n; a++ {
+		u := float64(a) / float64(n)
+		bu := bernstein(u)
+		points[a] = make([]Point, n+1)
+		colorsAt[a] = make([][4]float64, n+1)
+		for b := 0; b <= n; b++ {
+			v := float64(b) / float64(n)
+			bv := bernstein(v)
+			var q Point
+			for i := 0; i < 4; i++ {
+				for j := 0; j < 4; j++ {
+					w := bu[i] * bv[j]
+					q.X += w * p[i][j].X
+					q.Y += w * p[i][j].Y
+				}
+			}
+			points[a][b] = q
+			for k := 0; k < 4; k++ {
+				colorsAt[a][b][k] = (1-u)*((1-v)*c00[k]+v*c01[k]) + u*((1-v)*c10[k]+v*c11[k])
+			}
+		}
+	}
+	for a := 0; a < n; a++ {
+		for b := 0; b < n; b++ {
+			g.addTriangle(
+				[3]Point{points[a][b], points[a+1][b], points[a+1][b+1]},
+				[3][4]float64{colorsAt[a][b], colorsAt[a+1][b], colorsAt[a+1][b+1]})
+			g.addTriangle(
+				[3]Point{points[a][b], points[a+1][b+1], points[a][b+1]},
+				[3][4]float64{colorsAt[a][b], colorsAt[a+1][b+1], colorsAt[a][b+1]})
+		}
+	}
+}
+
+// buildGrid buckets the triangles by the grid cells their bounds overlap.
+func (g *meshGradient) buildGrid() {
+	if len(g.triangles) == 0 {
+		g.grid = nil
+		return
+	}
+	b := g.triangles[0].bounds
+	for _, t := range g.triangles[1:] {
+		b[0] = math.Min(b[0], t.bounds[0])
+		b[1] = math.Min(b[1], t.bounds[1])
+		b[2] = math.Max(b[2], t.bounds[2])
+		b[3] = math.Max(b[3], t.bounds[3])
+	}
+	n := int(math.Min(256, math.Ceil(math.Sqrt(float64(len(g.triangles))))))
+	g.gridBounds = b
+	g.gridSize = n
+	g.x0, g.y0 = b[0], b[1]
+	g.cellW = math.Max((b[2]-b[0])/float64(n), 1e-9)
+	g.cellH = math.Max((b[3]-b[1])/float64(n), 1e-9)
+	g.grid = make([][]int, n*n)
+	for i := range g.triangles {
+		g.bucket(i)
+	}
+}
+
+// insertTriangle adds the triangle i to the grid, which is rebuilt if the
+// triangle is outside of it or has outgrown it.
+func (g *meshGradient) insertTriangle(i int) {
+	t, b := g.triangles[i].bounds, g.gridBounds
+	if g.grid == nil || t[0] < b[0] || t[1] < b[1] || t[2] > b[2] || t[3] > b[3] ||
+		g.gridSize*g.gridSize*4 < len(g.triangles) && g.gridSize < 256 {
+		g.buildGrid()
+		return
+	}
+	g.bucket(i)
+}
+
+// bucket adds the triangle i to the grid cells that its bounds overlap.
+func (g *meshGradient) bucket(i int) {
+	t := g.triangles[i]
+	n := g.gridSize
+	x0, y0 := g.cell(t.bounds[0], t.bounds[1])
+	x1, y1 := g.cell(t.bounds[2], t.bounds[3])
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			g.grid[y*n+x] = append(g.grid[y*n+x], i)
+		}
+	}
+}
+
+func (g *meshGradient) cell(x, y float64) (int, int) {
+	n := g.gridSize
+	i := int((x - g.x0) / g.cellW)
+	j := int((y - g.y0) / g.cellH)
+	if i < 0 {
+		i = 0
+	} else if i >= n {
+		i = n - 1
+	}
+	if j < 0 {
+		j = 0
+	} else if j >= n {
+		j = n - 1
+	}
+	return i, j
+}
+
+func (g *meshGradient) ColorAt(x, y int) color.Color {
+	return g.sample(float64(x), float64(y))
+}
+
+func (g *meshGradient) sample(x, y float64) color.Color {
+	if len(g.grid) == 0 {
+		return color.Transparent
+	}
+	x, y = transformPixel(g.inverse, x, y)
+	p := Point{x + 0.5, y + 0.5}
+
+	// pixels along the edges of the mesh are partially covered, so points
+	// up to half a pixel outside still get the color of the nearest triangle
+	const margin = 0.5
+	b := g.gridBounds
+	if p.X < b[0]-margin || p.Y < b[1]-margin || p.X > b[2]+margin || p.Y > b[3]+margin {
+		return color.Transparent
+	}
+	i, j := g.cell(p.X, p.Y)
+	cell := g.grid[j*g.gridSize+i]
+	best, bestDistance := -1, margin
+	var bestWeights [3]float64
+	for k := len(cell) - 1; k >= 0; k-- {
+		t := &g.triangles[cell[k]]
+		w, d := barycentric(t.p, p)
+		if d == 0 {
+			best, bestWeights = cell[k], w
+			break
+		}
+		if d < bestDistance {
+			best, bestDistance, bestWeights = cell[k], d, w
+		}
+	}
+	if best < 0 {
+		return color.Transparent
+	}
+	t := &g.triangles[best]
+	var c [4]float64
+	for k := range c {
+		c[k] = bestWeights[0]*t.c[0][k] + bestWeights[1]*t.c[1][k] + bestWeights[2]*t.c[2][k]
+	}
+	return premultipliedToRGBA64(c)
+}
+
+// barycentric returns the barycentric coordinates of the point in the
+// triangle, clamped to the triangle, and the distance of the point from the
+// triangle, which is 0 if it is inside.
+func barycentric(t [3]Point, p Point) ([3]float64, float64) {
+	d := cross(sub(t[1], t[0]), sub(t[2], t[0]))
+	if d == 0 {
+		return [3]float64{}, math.Inf(1)
+	}
+	w1 := cross(sub(p, t[0]), sub(t[2], t[0])) / d
+	w2 := cross(sub(t[1], t[0]), sub(p, t[0])) / d
+	w := [3]float64{1 - w1 - w2, w1, w2}
+	if w[0] >= 0 && w[1] >= 0 && w[2] >= 0 {
+		return w, 0
+	}
+	// the nearest point is on one of the edges
+	best := math.Inf(1)
+	var result [3]float64
+	for i := 0; i < 3; i++ {
+		a, b := t[i], t[(i+1)%3]
+		ab := sub(b, a)
+		s := 0.0
+		if l := dot(ab, ab); l > 0 {
+			s = math.Max(0, math.Min(1, dot(sub(p, a), ab)/l))
+		}
+		q := a.Interpolate(b, s)
+		if dist := q.Distance(p); dist < best {
+			best = dist
+			result = [3]float64{}
+			result[i] = 1 - s
+			result[(i+1)%3] = s
+		}
+	}
+	return result, best
+}
+
+// DrawTriangles draws triangles with Gouraud shading, interpolating the
+// colors of their vertices. Each three consecutive vertices, in user space,
+// form a triangle, with the corresponding entries of colors as the colors of
+// its vertices. The current path is not affected.
+func (dc *Context) DrawTriangles(vertices []Point, colors []color.Color) {
+	dc.drawShadow(func() { dc.DrawTriangles(vertices, colors) })
+	mesh := &meshGradient{inverse: Identity()}
+	var path Path
+	for i := 0; i+2 < len(vertices) && i+2 < len(colors); i += 3 {
+		var p [3]Point
+		for j := range p {
+			p[j].X, p[j].Y = dc.TransformPoint(vertices[i+j].X, vertices[i+j].Y)
+		}
+		mesh.addTriangle(p, [3][4]float64{
+			premultipliedColor(colors[i]), premultipliedColor(colors[i+1]), premultipliedColor(colors[i+2]),
+		})
+		path.MoveTo(p[0].X, p[0].Y)
+		path.LineTo(p[1].X, p[1].Y)
+		path.LineTo(p[2].X, p[2].Y)
+		path.ClosePath()
+	}
+	mesh.buildGrid()
+	r := dc.rasterizer
+	r.UseNonZeroWinding = true
+	r.Clear()
+	r.AddPath(rasterPath(path.flatten()))
+	r.Rasterize(dc.painter(mesh))
+	if dc.surface != nil && !dc.recordRaster() {
+		dc.surface.fill(dc, &path, FillRuleWinding, mesh)
+	}
+}
@@ -0,0 +1,318 @@
+package gg
+
+import (
+	"image/color"
+	"math"
+	"math/rand"
+)
+
+// Noise is a smooth, random function of the plane, such as Perlin noise.
+// The same seed always gives the same noise.
+type Noise interface {
+	// At returns the value of the noise at x, y, in [-1, 1].
+	At(x, y float64) float64
+}
+
+type noiseKind int
+
+const (
+	noisePerlin noiseKind = iota
+	noiseSimplex
+	noiseValue
+	noiseWorley
+)
+
+type latticeNoise struct {
+	kind  noiseKind
+	scale float64
+	perm  [512]uint8
+}
+
+func newLatticeNoise(kind noiseKind, seed int64, scale float64) *latticeNoise {
+	n := &latticeNoise{kind: kind, scale: scale}
+	for i, v := range rand.New(rand.NewSource(seed)).Perm(256) {
+		n.perm[i] = uint8(v)
+		n.perm[i+256] = uint8(v)
+	}
+	return n
+}
+
+// NewPerlinNoise returns gradient noise with features about scale units
+// apart.
+func NewPerlinNoise(seed int64, scale float64) Noise {
+	return newLatticeNoise(noisePerlin, seed, scale)
+}
+
+// NewSimplexNoise returns simplex noise with features about scale units
+// apart. It looks like Perlin noise with fewer directional artifacts.
+func NewSimplexNoise(seed int64, scale float64) Noise {
+	return newLatticeNoise(noiseSimplex, seed, scale)
+}
+
+// NewValueNoise returns noise that smoothly interpolates random values on a
+// grid with cells scale units wide. It is blockier than Perlin noise.
+func NewValueNoise(seed int64, scale float64) Noise {
+	return newLatticeNoise(noiseValue, seed, scale)
+}
+
+// NewWorleyNoise returns cellular noise, based on the distance to the
+// nearest of random points about scale units apart. It is -1 at the points
+// and grows towards the edges of their cells.
+func NewWorleyNoise(seed int64, scale float64) Noise {
+	return newLatticeNoise(noiseWorley, seed, scale)
+}
+
+func (n *latticeNoise) At(x, y float64) float64 {
+	if n.scale != 0 {
+		x, y = x/n.scale, y/n.scale
+	}
+	switch n.kind {
+	case noiseSimplex:
+		return n.simplex(x, y)
+	case noiseValue:
+		return n.value(x, y)
+	case noiseWorley:
+		return n.worley(x, y)
+	}
+	return n.perlin(x, y)
+}
+
+func (n *latticeNoise) hash(i, j int) int {
+	return int(n.perm[int(n.perm[i&255])+j&255])
+}
+
+// gradient returns the dot product of one of 8 unit gradients, chosen by
+// the hash h, with x, y.
+func gradient(h int, x, y float64) float64 {
+	const d = math.Sqrt2 / 2
+	switch h & 7 {
+	case 0:
+		return x
+	case 1:
+		return -x
+	case 2:
+		return y
+	case 3:
+		return -y
+	case 4:
+		return (x + y) * d
+	case 5:
+		return (x - y) * d
+	case 6:
+		return (-x + y) * d
+	}
+	return (-x - y) * d
+}
+
+func fade(t float64) float64 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+func mix(a, b, t float64) float64 {
+	return a + (b-a)*t
+}
+
+func (n *latticeNoise) perlin(x, y float64) float64 {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	i, j := int(x0), int(y0)
+	x, y = x-x0, y-y0
+	u, v := fade(x), fade(y)
+	a := mix(gradient(n.hash(i, j), x, y), gradient(n.hash(i+1, j), x-1, y), u)
+	b := mix(gradient(n.hash(i, j+1), x, y-1), gradient(n.hash(i+1, j+1), x-1, y-1), u)
+	// the range of 2D Perlin noise is ±sqrt(2)/2
+	return math.Max(-1, math.Min(1, mix(a, b, v)*math.Sqrt2))
+}
+
+func (n *latticeNoise) simplex(x, y float64) float64 {
+	const f2 = 0.36602540378443865 // (sqrt(3) - 1) / 2
+	const g2 = 0.21132486540518713 // (3 - sqrt(3)) / 6
+	s := (x + y) * f2
+	i, j := math.Floor(x+s), math.Floor(y+s)
+	t := (i + j) * g2
+	x0, y0 := x-(i-t), y-(j-t)
+	var i1, j1 float64
+	if x0 > y0 {
+		i1 = 1
+	} else {
+		j1 = 1
+	}
+	corners := [3][2]float64{
+		{x0, y0},
+		{x0 - i1 + g2, y0 - j1 + g2},
+		{x0 - 1 + 2*g2, y0 - 1 + 2*g2},
+	}
+	offsets := [3][2]int{{0, 0}, {int(i1), int(j1)}, {1, 1}}
+	var sum float64
+	for k, c := range corners {
+		t := 0.5 - c[0]*c[0] - c[1]*c[1]
+		if t > 0 {
+			t *= t
+			h := n.hash(int(i)+offsets[k][0], int(j)+offsets[k][1])
+			sum += t * t * gradient(h, c[0], c[1])
+		}
+	}
+	return math.Max(-1, math.Min(1, 70*sum))
+}
+
+func (n *latticeNoise) value(x, y float64) float64 {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	i, j := int(x0), int(y0)
+	u, v := fade(x-x0), fade(y-y0)
+	value := func(i, j int) float64 {
+		return float64(n.hash(i, j))/127.5 - 1
+	}
+	return mix(mix(value(i, j), value(i+1, j), u), mix(value(i, j+1), value(i+1, j+1), u), v)
+}
+
+func (n *latticeNoise) worley(x, y float64) float64 {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	i, j := int(x0), int(y0)
+	best := math.Inf(1)
+	for dj := -1; dj <= 1; dj++ {
+		for di := -1; di <= 1; di++ {
+			// one feature point per cell, at a random position in it
+			h := n.hash(i+di, j+dj)
+			px := float64(i+di) + float64(h)/255
+			py := float64(j+dj) + float64(n.perm[h+17&255])/255
+			best = math.Min(best, math.Hypot(x-px, y-py))
+		}
+	}
+	return math.Min(1, 2*best-1)
+}
+
+type fractalNoise struct {
+	noise      Noise
+	octaves    int
+	lacunarity float64
+	gain       float64
+}
+
+// NewFractalNoise returns fractal Brownian motion, the sum of octaves copies
+// of the noise, each with its features lacunarity times finer and its
+// amplitude gain times smaller than the previous one. Typical values are 2
+// for lacunarity and 0.5 for gain. The sum is normalized to [-1, 1].
+func NewFractalNoise(noise Noise, octaves int, lacunarity, gain float64) Noise {
+	return &fractalNoise{noise, octaves, lacunarity, gain}
+}
+
+func (n *fractalNoise) At(x, y float64) float64 {
+	var sum, total float64
+	frequency, amplitude := 1.0, 1.0
+	for i := 0; i < n.octaves; i++ {
+		// offset the octaves so that their lattices don't line up
+		o := float64(i) * 97.31
+		sum += amplitude * n.noise.At(x*frequency+o, y*frequency+o)
+		total += amplitude
+		frequency *= n.lacunarity
+		amplitude *= n.gain
+	}
+	if total == 0 {
+		return 0
+	}
+	return sum / total
+}
+
+// Colormap maps a value in [0, 1] to a color.
+type Colormap func(t float64) color.Color
+
+// NewColormap returns a colormap that interpolates between the colors,
+// evenly spaced from 0 to 1.
+func NewColormap(colors ...color.Color) Colormap {
+	var s stops
+	for i, c := range colors {
+		pos := 0.0
+		if len(colors) > 1 {
+			pos = float64(i) / float64(len(colors)-1)
+		}
+		s = append(s, stop{pos, c})
+	}
+	return func(t float64) color.Color {
+		if len(s) == 0 {
+			return color.Transparent
+		}
+		return getColor(t, s)
+	}
+}
+
+type noisePattern struct {
+	noise    Noise
+	colormap Colormap
+}
+
+// NewNoisePattern returns a pattern that colors each point by mapping the
+// noise, from [-1, 1] to [0, 1], through the colormap.
+func NewNoisePattern(noise Noise, colormap Colormap) Pattern {
+	return &noisePattern{noise, colormap}
+}
+
+func (p *noisePattern) ColorAt(x, y int) color.Color {
+	return p.sample(float64(x), float64(y))
+}
+
+func (p *noisePattern) sample(x, y float64) color.Color {
+	v := p.noise.At(x+0.5, y+0.5)
+	return p.colormap(clamp01((v + 1) / 2))
+}
+
+// Displace returns a copy of the path with its points moved by up to amount
+// in x and y, as given by the noise at each point. The path is first
+// flattened to lines no longer than step, so that curves and long lines are
+// displaced smoothly.
+func (p *Path) Displace(noise Noise, amount, step float64) *Path {
+	result := NewPath()
+	for _, points := range p.flatten() {
+		closed := len(points) > 2 && points[0] == points[len(points)-1]
+		if closed {
+			points = points[:len(points)-1]
+		}
+		displace := func(q Point) Point {
+			// the y displacement samples the noise away from the x one so
+			// that the two are independent
+			return Point{
+				q.X + amount*noise.At(q.X, q.Y),
+				q.Y + amount*noise.At(q.X+5317.3, q.Y-2749.1),
+			}
+		}
+		for i, q := range points {
+			if i == 0 {
+				q = displace(q)
+				result.MoveTo(q.X, q.Y)
+				continue
+			}
+			subdivide(points[i-1], q, step, func(q Point) {
+				q = displace(q)
+				result.LineTo(q.X, q.Y)
+			})
+		}
+		if closed {
+			subdivide(points[len(points)-1], points[0], step, func(q Point) {
+				if q != points[0] {
+					q = displace(q)
+					result.LineTo(q.X, q.Y)
+				}
+			})
+			result.ClosePath()
+		}
+	}
+	return result
+}
+
+// subdivide calls f with the points that split the line from a to b into
+// pieces no longer than step, ending with b.
+func subdivide(a, b Point, step float64, f func(Point)) {
+	n := 1
+	if step > 0 {
+		n = int(math.Max(1, math.Ceil(a.Distance(b)/step)))
+	}
+	for i := 1; i <= n; i++ {
+		f(a.Interpolate(b, float64(i)/float64(n)))
+	}
+}
+
+// DisplacePath replaces the current path with its displaced copy, see
+// Path.Displace. The noise is sampled in user space.
+func (dc *Context) DisplacePath(noise Noise, amount, step float64) {
+	p := dc.CopyPath().Displace(noise, amount, step)
+	dc.ClearPath()
+	dc.AppendPath(p)
+}
@@ -0,0 +1,1048 @@
+package gg
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// This file implements the OpenType layout tables: glyph substitution
+// (GSUB), glyph positioning (GPOS) and glyph definitions (GDEF). They are
+// read directly from the bytes of the font, which the truetype package
+// doesn't parse.
+
+// otData is an OpenType table or a part of one. Reads past its end return
+// zero, so that malformed tables behave like empty ones.
+type otData []byte
+
+func (d otData) u16(off int) int {
+	if off < 0 || off+2 > len(d) {
+		return 0
+	}
+	return int(d[off])<<8 | int(d[off+1])
+}
+
+func (d otData) i16(off int) int {
+	return int(int16(d.u16(off)))
+}
+
+func (d otData) u32(off int) int {
+	return d.u16(off)<<16 | d.u16(off+2)
+}
+
+func (d otData) tag(off int) string {
+	if off < 0 || off+4 > len(d) {
+		return ""
+	}
+	return string(d[off : off+4])
+}
+
+// coverage returns the coverage index of the glyph in the coverage table at
+// off, or -1 if the glyph is not covered.
+func (d otData) coverage(off int, glyph uint16) int {
+	g := int(glyph)
+	n := d.u16(off + 2)
+	switch d.u16(off) {
+	case 1:
+		i := sort.Search(n, func(i int) bool { return d.u16(off+4+2*i) >= g })
+		if i < n && d.u16(off+4+2*i) == g {
+			return i
+		}
+	case 2:
+		i := sort.Search(n, func(i int) bool { return d.u16(off+4+6*i+2) >= g })
+		if rec := off + 4 + 6*i; i < n && d.u16(rec) <= g {
+			return d.u16(rec+4) + g - d.u16(rec)
+		}
+	}
+	return -1
+}
+
+// class returns the class of the glyph in the class definition table at
+// off.
+func (d otData) class(off int, glyph uint16) int {
+	g := int(glyph)
+	switch d.u16(off) {
+	case 1:
+		start := d.u16(off + 2)
+		if g >= start && g < start+d.u16(off+4) {
+			return d.u16(off + 6 + 2*(g-start))
+		}
+	case 2:
+		n := d.u16(off + 2)
+		i := sort.Search(n, func(i int) bool { return d.u16(off+4+6*i+2) >= g })
+		if rec := off + 4 + 6*i; i < n && d.u16(rec) <= g {
+			return d.u16(rec + 4)
+		}
+	}
+	return 0
+}
+
+// GDEF glyph classes.
+const (
+	otBase      = 1
+	otLigature  = 2
+	otMark      = 3
+	otComponent = 4
+)
+
+// Lookup flags.
+const (
+	otRightToLeft         = 0x1
+	otIgnoreBaseGlyphs    = 0x2
+	otIgnoreLigatures     = 0x4
+	otIgnoreMarks         = 0x8
+	otUseMarkFilteringSet = 0x10
+)
+
+// otFont holds the layout tables of a font.
+type otFont struct {
+	gsub, gpos otLayout
+	gdef       otData
+
+	// offsets in gdef, 0 if absent
+	glyphClasses, markAttachClasses, markSets int
+
+	// numGlyphs is the number of glyphs in the font, from maxp
+	numGlyphs int
+}
+
+// otLayout is a GSUB or GPOS table.
+type otLayout struct {
+	data otData
+	gpos bool
+}
+
+// parseOTFont finds the layout tables in the font file. For a collection
+// the first font is used, as by truetype.Parse.
+func parseOTFont(file []byte) *otFont {
+	d := otData(file)
+	f := &otFont{}
+	dir := 0
+	if d.tag(0) == "ttcf" {
+		dir = d.u32(12)
+	}
+	for i := 0; i < d.u16(dir+4); i++ {
+		rec := dir + 12 + 16*i
+		off, length := d.u32(rec+8), d.u32(rec+12)
+		if off+length > len(d) {
+			continue
+		}
+		table := d[off : off+length]
+		switch d.tag(rec) {
+		case "GSUB":
+			f.gsub = otLayout{data: table}
+		case "GPOS":
+			f.gpos = otLayout{data: table, gpos: true}
+		case "GDEF":
+			f.gdef = table
+		case "maxp":
+			f.numGlyphs = table.u16(4)
+		}
+	}
+	if len(f.gdef) > 0 {
+		f.glyphClasses = f.gdef.u16(4)
+		f.markAttachClasses = f.gdef.u16(10)
+		if f.gdef.u16(2) >= 2 {
+			f.markSets = f.gdef.u16(12)
+		}
+	}
+	return f
+}
+
+// validGlyph reports whether the glyph id is in the font. Substitutions to
+// ids past the end of the font are ignored.
+func (f *otFont) validGlyph(id int) bool {
+	return id >= 0 && id < f.numGlyphs
+}
+
+// glyphClass returns the GDEF class of the glyph, or 0 if the font doesn't
+// classify its glyphs.
+func (f *otFont) glyphClass(glyph uint16) int {
+	if f.glyphClasses == 0 {
+		return 0
+	}
+	return f.gdef.class(f.glyphClasses, glyph)
+}
+
+func (f *otFont) markAttachClass(glyph uint16) int {
+	if f.markAttachClasses == 0 {
+		return 0
+	}
+	return f.gdef.class(f.markAttachClasses, glyph)
+}
+
+func (f *otFont) inMarkSet(set int, glyph uint16) bool {
+	if f.markSets == 0 || set >= f.gdef.u16(f.markSets+2) {
+		return false
+	}
+	return f.gdef.coverage(f.markSets+f.gdef.u32(f.markSets+4+4*set), glyph) >= 0
+}
+
+// langSys returns the offset of the default language system of the first
+// of the scripts that the table has, or 0 if it has none of them.
+func (t otLayout) langSys(scripts []string) int {
+	d := t.data
+	list := d.u16(4)
+	if len(d) == 0 {
+		return 0
+	}
+	for _, want := range scripts {
+		for i := 0; i < d.u16(list); i++ {
+			rec := list + 2 + 6*i
+			if d.tag(rec) != want {
+				continue
+			}
+			script := list + d.u16(rec+4)
+			if off := d.u16(script); off != 0 {
+				return script + off
+			}
+			if d.u16(script+2) > 0 {
+				return script + d.u16(script+8)
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// featureLookups returns the indexes of the lookups of the feature in the
+// language system.
+func (t otLayout) featureLookups(langSys int, feature string) []int {
+	if langSys == 0 {
+		return nil
+	}
+	d := t.data
+	list := d.u16(6)
+	var result []int
+	for i := 0; i < d.u16(langSys+4); i++ {
+		rec := list + 2 + 6*d.u16(langSys+6+2*i)
+		if d.tag(rec) != feature {
+			continue
+		}
+		off := list + d.u16(rec+4)
+		for k := 0; k < d.u16(off+2); k++ {
+			result = append(result, d.u16(off+4+2*k))
+		}
+	}
+	return result
+}
+
+// lookup returns the type, flags, subtable offsets and mark filtering set
+// of the lookup.
+func (t otLayout) lookup(index int) (kind, flag int, subtables []int, markSet int) {
+	d := t.data
+	list := d.u16(8)
+	if index >= d.u16(list) {
+		return 0, 0, nil, 0
+	}
+	off := list + d.u16(list+2+2*index)
+	kind, flag = d.u16(off), d.u16(off+2)
+	n := d.u16(off + 4)
+	for i := 0; i < n; i++ {
+		subtables = append(subtables, off+d.u16(off+6+2*i))
+	}
+	if flag&otUseMarkFilteringSet != 0 {
+		markSet = d.u16(off + 6 + 2*n)
+	}
+	return kind, flag, subtables, markSet
+}
+
+// resolve follows an extension subtable to the subtable it points to.
+func (t otLayout) resolve(kind, sub int) (int, int) {
+	if (!t.gpos && kind == 7) || (t.gpos && kind == 9) {
+		return t.data.u16(sub + 2), sub + t.data.u32(sub+4)
+	}
+	return kind, sub
+}
+
+// otGlyph is a glyph in the buffer that the lookups are applied to.
+type otGlyph struct {
+	id       uint16
+	r        rune   // the rune the glyph was mapped from
+	cluster  int    // the index of the first rune of the cluster
+	mask     uint32 // the features that apply to the glyph
+	class    uint8  // the GDEF class
+	ligID    uint16 // the ligature that the glyph is, or a mark belongs to
+	ligComp  uint8  // the component of the ligature that a mark belongs to
+	syllable uint16 // the syllable of Indic text, from 1
+
+	// the position in font units
+	xAdvance, xOffset, yOffset int
+
+	// attach is 1 + the index of the glyph that the mark is attached to, 0
+	// if none, and attachX, attachY the offset from the origin of that
+	// glyph; cursive is 1 + the index of the glyph that this one is
+	// cursively attached to, and cursiveY its vertical offset from it
+	attach, attachX, attachY int
+	cursive, cursiveY        int
+}
+
+// Limits on the work of malformed or hostile fonts, as in HarfBuzz: the
+// depth of nested lookups, and the factors by which the number of glyphs
+// bounds how far multiple substitutions can grow them and how many nested
+// lookups can be applied.
+const (
+	otMaxNesting   = 64
+	otMaxLenFactor = 64
+	otMaxOpsFactor = 1024
+	otMinLimit     = 16384
+)
+
+// otApplier applies the lookups of a GSUB or GPOS table to glyphs.
+type otApplier struct {
+	font    *otFont
+	table   otLayout
+	glyphs  []otGlyph
+	rtl     bool
+	flag    int
+	markSet int
+	ligIDs  uint16
+
+	// nesting is the depth of the nested lookup being applied, and maxLen
+	// and ops the limits on the number of glyphs and the nested lookups
+	// left to apply, set by the first call to apply
+	nesting int
+	maxLen  int
+	ops     int
+}
+
+// otFeature is a feature to apply and the mask of the glyphs it applies to.
+type otFeature struct {
+	tag  string
+	mask uint32
+}
+
+// hasFeature reports whether the table has the feature in any script.
+func (t otLayout) hasFeature(feature string) bool {
+	d := t.data
+	list := d.u16(6)
+	if len(d) == 0 {
+		return false
+	}
+	for i := 0; i < d.u16(list); i++ {
+		if d.tag(list+2+6*i) == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// wouldSubstitute reports whether the feature substitutes the glyphs, when
+// applied to them alone.
+func (f *otFont) wouldSubstitute(langSys int, feature string, ids ...uint16) bool {
+	glyphs := make([]otGlyph, len(ids))
+	for i, id := range ids {
+		glyphs[i] = otGlyph{id: id, mask: 1, class: otBase}
+		if c := f.glyphClass(id); c != 0 {
+			glyphs[i].class = uint8(c)
+		}
+	}
+	a := otApplier{font: f, table: f.gsub, glyphs: glyphs}
+	a.apply(langSys, []otFeature{{feature, 1}})
+	if len(a.glyphs) != len(ids) {
+		return true
+	}
+	for i, g := range a.glyphs {
+		if g.id != ids[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// apply applies the lookups of the features of a stage in the order of
+// their indexes. Each feature applies to the glyphs that have any of the
+// bits of its mask.
+func (a *otApplier) apply(langSys int, features []otFeature) {
+	if a.maxLen == 0 {
+		a.maxLen = otMaxLenFactor * len(a.glyphs)
+		a.ops = otMaxOpsFactor * len(a.glyphs)
+		if a.maxLen < otMinLimit {
+			a.maxLen = otMinLimit
+		}
+		if a.ops < otMinLimit {
+			a.ops = otMinLimit
+		}
+	}
+	masks := make(map[int]uint32)
+	var lookups []int
+	for _, f := range features {
+		for _, index := range a.table.featureLookups(langSys, f.tag) {
+			if _, ok := masks[index]; !ok {
+				lookups = append(lookups, index)
+			}
+			masks[index] |= f.mask
+		}
+	}
+	sort.Ints(lookups)
+	for _, index := range lookups {
+		a.applyLookup(index, masks[index])
+	}
+}
+
+// applyLookup applies the lookup to the glyphs that have the mask.
+func (a *otApplier) applyLookup(index int, mask uint32) {
+	kind, flag, subtables, markSet := a.table.lookup(index)
+	if len(subtables) == 0 {
+		return
+	}
+	a.flag, a.markSet = flag, markSet
+	if k, _ := a.table.resolve(kind, subtables[0]); !a.table.gpos && k == 8 {
+		// reverse chaining substitutions go from the end to the start
+		for i := len(a.glyphs) - 1; i >= 0; i-- {
+			if a.glyphs[i].mask&mask != 0 && !a.ignored(&a.glyphs[i]) {
+				a.applySubtables(kind, subtables, i)
+			}
+		}
+		return
+	}
+	for i := 0; i < len(a.glyphs); {
+		if a.glyphs[i].mask&mask == 0 || a.ignored(&a.glyphs[i]) {
+			i++
+			continue
+		}
+		next, ok := a.applySubtables(kind, subtables, i)
+		if !ok {
+			next = i + 1
+		}
+		i = next
+	}
+}
+
+// applyLookupAt applies the lookup once at the glyph i, for the nested
+// lookups of contextual lookups. Lookups that nest too deep, such as those
+// that refer back to themselves, and those past the limit of operations are
+// not applied.
+func (a *otApplier) applyLookupAt(index, i int) {
+	if a.nesting >= otMaxNesting || a.ops <= 0 {
+		return
+	}
+	a.ops--
+	kind, flag, subtables, markSet := a.table.lookup(index)
+	flag0, markSet0 := a.flag, a.markSet
+	a.flag, a.markSet = flag, markSet
+	a.nesting++
+	a.applySubtables(kind, subtables, i)
+	a.nesting--
+	a.flag, a.markSet = flag0, markSet0
+}
+
+// applySubtables applies the first subtable of the lookup that matches at
+// the glyph i and returns where to continue.
+func (a *otApplier) applySubtables(kind int, subtables []int, i int) (int, bool) {
+	for _, sub := range subtables {
+		k, s := a.table.resolve(kind, sub)
+		var next int
+		var ok bool
+		if a.table.gpos {
+			next, ok = a.position(k, s, i)
+		} else {
+			next, ok = a.substitute(k, s, i)
+		}
+		if ok {
+			return next, true
+		}
+	}
+	return i + 1, false
+}
+
+// ignored reports whether the lookup flags skip the glyph.
+func (a *otApplier) ignored(g *otGlyph) bool {
+	switch g.class {
+	case otBase:
+		return a.flag&otIgnoreBaseGlyphs != 0
+	case otLigature:
+		return a.flag&otIgnoreLigatures != 0
+	case otMark:
+		if a.flag&otIgnoreMarks != 0 {
+			return true
+		}
+		if a.flag&otUseMarkFilteringSet != 0 {
+			return !a.font.inMarkSet(a.markSet, g.id)
+		}
+		if t := a.flag >> 8; t != 0 {
+			return a.font.markAttachClass(g.id) != t
+		}
+	}
+	return false
+}
+
+// next returns the index of the next glyph after i that the lookup doesn't
+// skip, or -1.
+func (a *otApplier) next(i int) int {
+	for i++; i < len(a.glyphs); i++ {
+		if !a.ignored(&a.glyphs[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// prev returns the index of the previous glyph before i that the lookup
+// doesn't skip, or -1.
+func (a *otApplier) prev(i int) int {
+	for i--; i >= 0; i-- {
+		if !a.ignored(&a.glyphs[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// setGlyph replaces the glyph id, updating its class from GDEF.
+func (a *otApplier) setGlyph(i int, id uint16, class uint8) {
+	g := &a.glyphs[i]
+	g.id = id
+	if c := a.font.glyphClass(id); c != 0 {
+		g.class = uint8(c)
+	} else if class != 0 {
+		g.class = class
+	}
+}
+
+// substitute applies the GSUB subtable of the kind at the glyph i.
+func (a *otApplier) substitute(kind, sub, i int) (int, bool) {
+	d := a.table.data
+	g := a.glyphs[i]
+	switch kind {
+	case 1: // single
+		k := d.coverage(sub+d.u16(sub+2), g.id)
+		if k < 0 {
+			return 0, false
+		}
+		var id int
+		switch d.u16(sub) {
+		case 1:
+			id = (int(g.id) + d.i16(sub+4)) & 0xffff
+		case 2:
+			if k >= d.u16(sub+4) {
+				return 0, false
+			}
+			id = d.u16(sub + 6 + 2*k)
+		default:
+			return 0, false
+		}
+		if !a.font.validGlyph(id) {
+			return 0, false
+		}
+		a.setGlyph(i, uint16(id), 0)
+		return i + 1, true
+	case 2: // multiple
+		k := d.coverage(sub+d.u16(sub+2), g.id)
+		if k < 0 || k >= d.u16(sub+4) {
+			return 0, false
+		}
+		seq := sub + d.u16(sub+6+2*k)
+		n := d.u16(seq)
+		if len(a.glyphs)-1+n > a.maxLen {
+			return 0, false
+		}
+		for j := 0; j < n; j++ {
+			if !a.font.validGlyph(d.u16(seq + 2 + 2*j)) {
+				return 0, false
+			}
+		}
+		out := make([]otGlyph, n)
+		for j := range out {
+			out[j] = g
+		}
+		a.glyphs = append(a.glyphs[:i], append(out, a.glyphs[i+1:]...)...)
+		for j := 0; j < n; j++ {
+			a.setGlyph(i+j, uint16(d.u16(seq+2+2*j)), 0)
+		}
+		return i + n, true
+	case 3: // alternate, the first alternate is used
+		k := d.coverage(sub+d.u16(sub+2), g.id)
+		if k < 0 || k >= d.u16(sub+4) {
+			return 0, false
+		}
+		set := sub + d.u16(sub+6+2*k)
+		if d.u16(set) == 0 || !a.font.validGlyph(d.u16(set+2)) {
+			return 0, false
+		}
+		a.setGlyph(i, uint16(d.u16(set+2)), 0)
+		return i + 1, true
+	case 4: // ligature
+		k := d.coverage(sub+d.u16(sub+2), g.id)
+		if k < 0 || k >= d.u16(sub+4) {
+			return 0, false
+		}
+		set := sub + d.u16(sub+6+2*k)
+		for l := 0; l < d.u16(set); l++ {
+			lig := set + d.u16(set+2+2*l)
+			if !a.font.validGlyph(d.u16(lig)) {
+				continue
+			}
+			count := d.u16(lig + 2)
+			positions, ok := a.matchInput(i, count, func(k, j int) bool {
+				return int(a.glyphs[j].id) == d.u16(lig+4+2*(k-1))
+			})
+			if ok {
+				a.ligate(positions, uint16(d.u16(lig)))
+				return i + 1, true
+			}
+		}
+		return 0, false
+	case 5:
+		return a.context(sub, i, false)
+	case 6:
+		return a.context(sub, i, true)
+	case 8: // reverse chaining single
+		if d.u16(sub) != 1 {
+			return 0, false
+		}
+		k := d.coverage(sub+d.u16(sub+2), g.id)
+		if k < 0 {
+			return 0, false
+		}
+		backtrack := d.u16(sub + 4)
+		ahead := sub + 6 + 2*backtrack
+		lookahead := d.u16(ahead)
+		substitutes := ahead + 2 + 2*lookahead
+		if k >= d.u16(substitutes) || !a.font.validGlyph(d.u16(substitutes+2+2*k)) {
+			return 0, false
+		}
+		j := i
+		for b := 0; b < backtrack; b++ {
+			if j = a.prev(j); j < 0 || d.coverage(sub+d.u16(sub+6+2*b), a.glyphs[j].id) < 0 {
+				return 0, false
+			}
+		}
+		j = i
+		for l := 0; l < lookahead; l++ {
+			if j = a.next(j); j < 0 || d.coverage(sub+d.u16(ahead+2+2*l), a.glyphs[j].id) < 0 {
+				return 0, false
+			}
+		}
+		a.setGlyph(i, uint16(d.u16(substitutes+2+2*k)), 0)
+		return i + 1, true
+	}
+	return 0, false
+}
+
+// matchInput matches count glyphs, starting with i and skipping the glyphs
+// that the lookup ignores, with match called for the k-th glyph, k >= 1,
+// at the index j. It returns the indexes of the matched glyphs.
+func (a *otApplier) matchInput(i, count int, match func(k, j int) bool) ([]int, bool) {
+	if count == 0 {
+		return nil, false
+	}
+	positions := []int{i}
+	j := i
+	for k := 1; k < count; k++ {
+		if j = a.next(j); j < 0 || !match(k, j) {
+			return nil, false
+		}
+		positions = append(positions, j)
+	}
+	return positions, true
+}
+
+// ligate replaces the glyphs at the positions with the ligature. The marks
+// between and after them remember which component they belong to, for
+// mark to ligature positioning.
+func (a *otApplier) ligate(positions []int, lig uint16) {
+	first, last := positions[0], positions[len(positions)-1]
+	a.ligIDs++
+	id := a.ligIDs
+	cluster := a.glyphs[first].cluster
+	for j := first; j <= last; j++ {
+		if c := a.glyphs[j].cluster; c < cluster {
+			cluster = c
+		}
+	}
+	component := 1
+	matched := 1
+	for j := first + 1; j <= last; j++ {
+		if matched < len(positions) && positions[matched] == j {
+			matched++
+			component++
+			continue
+		}
+		a.glyphs[j].ligID, a.glyphs[j].ligComp = id, uint8(component)
+	}
+	for j := last + 1; j < len(a.glyphs) && a.glyphs[j].class == otMark; j++ {
+		a.glyphs[j].ligID, a.glyphs[j].ligComp = id, uint8(component)
+	}
+	for j := first; j <= last; j++ {
+		a.glyphs[j].cluster = cluster
+	}
+	a.setGlyph(first, lig, otLigature)
+	a.glyphs[first].ligID, a.glyphs[first].ligComp = id, 0
+	for k := len(positions) - 1; k >= 1; k-- {
+		p := positions[k]
+		a.glyphs = append(a.glyphs[:p], a.glyphs[p+1:]...)
+	}
+}
+
+// otSequence is a sequence of values of a contextual rule, matched against
+// glyphs: glyph ids, classes or coverage tables.
+type otSequence struct {
+	count int
+	at    func(k int) int
+	match func(value int, glyph uint16) bool
+}
+
+// context applies a contextual (GSUB 5, GPOS 7) or chained contextual
+// (GSUB 6, GPOS 8) subtable at the glyph i.
+func (a *otApplier) context(sub, i int, chained bool) (int, bool) {
+	d := a.table.data
+	g := a.glyphs[i].id
+	ids := func(value int, glyph uint16) bool { return value == int(glyph) }
+	classes := func(classDef int) func(int, uint16) bool {
+		return func(value int, glyph uint16) bool { return d.class(classDef, glyph) == value }
+	}
+	covers := func(value int, glyph uint16) bool { return d.coverage(value, glyph) >= 0 }
+	array := func(off int) func(int) int {
+		return func(k int) int { return d.u16(off + 2*k) }
+	}
+	// input sequences of rules skip the first glyph, which is matched by
+	// the coverage or the rule set
+	inputArray := func(off int) func(int) int {
+		return func(k int) int { return d.u16(off + 2*(k-1)) }
+	}
+	none := otSequence{}
+
+	switch format := d.u16(sub); {
+	case format == 1 || format == 2:
+		if d.coverage(sub+d.u16(sub+2), g) < 0 {
+			return 0, false
+		}
+		var set int
+		var backtrackMatch, inputMatch, lookaheadMatch func(int, uint16) bool
+		if format == 1 {
+			k := d.coverage(sub+d.u16(sub+2), g)
+			if k >= d.u16(sub+4) {
+				return 0, false
+			}
+			set = d.u16(sub + 6 + 2*k)
+			backtrackMatch, inputMatch, lookaheadMatch = ids, ids, ids
+		} else if !chained {
+			classDef := sub + d.u16(sub+4)
+			c := d.class(classDef, g)
+			if c >= d.u16(sub+6) {
+				return 0, false
+			}
+			set = d.u16(sub + 8 + 2*c)
+			inputMatch = classes(classDef)
+		} else {
+			inputDef := sub + d.u16(sub+6)
+			c := d.class(inputDef, g)
+			if c >= d.u16(sub+10) {
+				return 0, false
+			}
+			set = d.u16(sub + 12 + 2*c)
+			backtrackMatch = classes(sub + d.u16(sub+4))
+			inputMatch = classes(inputDef)
+			lookaheadMatch = classes(sub + d.u16(sub+8))
+		}
+		if set == 0 {
+			return 0, false
+		}
+		set += sub
+		for r := 0; r < d.u16(set); r++ {
+			rule := set + d.u16(set+2+2*r)
+			backtrack, lookahead := none, none
+			if chained {
+				backtrack = otSequence{d.u16(rule), array(rule + 2), backtrackMatch}
+				rule += 2 + 2*backtrack.count
+			}
+			input := otSequence{d.u16(rule), nil, inputMatch}
+			var records, recordCount int
+			if chained {
+				input.at = inputArray(rule + 2)
+				rule += 2 + 2*(input.count-1)
+				lookahead = otSequence{d.u16(rule), array(rule + 2), lookaheadMatch}
+				rule += 2 + 2*lookahead.count
+				recordCount, records = d.u16(rule), rule+2
+			} else {
+				input.at = inputArray(rule + 4)
+				recordCount, records = d.u16(rule+2), rule+4+2*(input.count-1)
+			}
+			if next, ok := a.applyRule(i, backtrack, input, lookahead, records, recordCount); ok {
+				return next, true
+			}
+		}
+		return 0, false
+	case format == 3 && !chained:
+		count := d.u16(sub + 2)
+		coverages := func(k int) int { return sub + d.u16(sub+6+2*k) }
+		if count == 0 || d.coverage(coverages(0), g) < 0 {
+			return 0, false
+		}
+		input := otSequence{count, coverages, covers}
+		return a.applyRule(i, none, input, none, sub+6+2*count, d.u16(sub+4))
+	case format == 3:
+		off := sub + 2
+		backtrack := otSequence{d.u16(off), nil, covers}
+		backtrack.at = func(base int) func(int) int {
+			return func(k int) int { return sub + d.u16(base+2*k) }
+		}(off + 2)
+		off += 2 + 2*backtrack.count
+		input := otSequence{d.u16(off), nil, covers}
+		input.at = func(base int) func(int) int {
+			return func(k int) int { return sub + d.u16(base+2*k) }
+		}(off + 2)
+		if input.count == 0 || d.coverage(input.at(0), g) < 0 {
+			return 0, false
+		}
+		off += 2 + 2*input.count
+		lookahead := otSequence{d.u16(off), nil, covers}
+		lookahead.at = func(base int) func(int) int {
+			return func(k int) int { return sub + d.u16(base+2*k) }
+		}(off + 2)
+		off += 2 + 2*lookahead.count
+		return a.applyRule(i, backtrack, input, lookahead, off+2, d.u16(off))
+	}
+	return 0, false
+}
+
+// applyRule matches the rule at the glyph i and applies its nested lookups,
+// given by recordCount records at the offset records.
+func (a *otApplier) applyRule(i int, backtrack, input, lookahead otSequence, records, recordCount int) (int, bool) {
+	positions, ok := a.matchInput(i, input.count, func(k, j int) bool {
+		return input.match(input.at(k), a.glyphs[j].id)
+	})
+	if !ok {
+		return 0, false
+	}
+	j := i
+	for k := 0; k < backtrack.count; k++ {
+		if j = a.prev(j); j < 0 || !backtrack.match(backtrack.at(k), a.glyphs[j].id) {
+			return 0, false
+		}
+	}
+	j = positions[len(positions)-1]
+	for k := 0; k < lookahead.count; k++ {
+		if j = a.next(j); j < 0 || !lookahead.match(lookahead.at(k), a.glyphs[j].id) {
+			return 0, false
+		}
+	}
+	d := a.table.data
+	for r := 0; r < recordCount; r++ {
+		seqIndex, lookup := d.u16(records+4*r), d.u16(records+4*r+2)
+		if seqIndex >= len(positions) || positions[seqIndex] >= len(a.glyphs) {
+			continue
+		}
+		n := len(a.glyphs)
+		a.applyLookupAt(lookup, positions[seqIndex])
+		// later positions move with glyphs that were added or removed
+		if delta := len(a.glyphs) - n; delta != 0 {
+			for k := seqIndex + 1; k < len(positions); k++ {
+				positions[k] += delta
+			}
+		}
+	}
+	next := positions[len(positions)-1] + 1
+	if next <= i {
+		next = i + 1
+	}
+	return next, true
+}
+
+// valueSize returns the size of a value record of the format.
+func valueSize(format int) int {
+	return 2 * bits.OnesCount(uint(format&0xFF))
+}
+
+// applyValue adds the value record at off to the position of the glyph i.
+func (a *otApplier) applyValue(i, off, format int) {
+	d := a.table.data
+	g := &a.glyphs[i]
+	if format&1 != 0 {
+		g.xOffset += d.i16(off)
+		off += 2
+	}
+	if format&2 != 0 {
+		g.yOffset += d.i16(off)
+		off += 2
+	}
+	if format&4 != 0 {
+		g.xAdvance += d.i16(off)
+	}
+}
+
+func (a *otApplier) anchor(off int) (int, int) {
+	d := a.table.data
+	return d.i16(off + 2), d.i16(off + 4)
+}
+
+// position applies the GPOS subtable of the kind at the glyph i.
+func (a *otApplier) position(kind, sub, i int) (int, bool) {
+	d := a.table.data
+	g := &a.glyphs[i]
+	switch kind {
+	case 1: // single
+		k := d.coverage(sub+d.u16(sub+2), g.id)
+		if k < 0 {
+			return 0, false
+		}
+		format := d.u16(sub + 4)
+		switch d.u16(sub) {
+		case 1:
+			a.applyValue(i, sub+6, format)
+		case 2:
+			if k >= d.u16(sub+6) {
+				return 0, false
+			}
+			a.applyValue(i, sub+8+k*valueSize(format), format)
+		default:
+			return 0, false
+		}
+		return i + 1, true
+	case 2: // pair
+		k := d.coverage(sub+d.u16(sub+2), g.id)
+		j := a.next(i)
+		if k < 0 || j < 0 {
+			return 0, false
+		}
+		second := a.glyphs[j].id
+		format1, format2 := d.u16(sub+4), d.u16(sub+6)
+		size1, size2 := valueSize(format1), valueSize(format2)
+		var rec int
+		switch d.u16(sub) {
+		case 1:
+			if k >= d.u16(sub+8) {
+				return 0, false
+			}
+			set := sub + d.u16(sub+10+2*k)
+			n, size := d.u16(set), 2+size1+size2
+			r := sort.Search(n, func(r int) bool { return d.u16(set+2+r*size) >= int(second) })
+			if r == n || d.u16(set+2+r*size) != int(second) {
+				return 0, false
+			}
+			rec = set + 2 + r*size + 2
+		case 2:
+			c1 := d.class(sub+d.u16(sub+8), g.id)
+			c2 := d.class(sub+d.u16(sub+10), second)
+			count1, count2 := d.u16(sub+12), d.u16(sub+14)
+			if c1 >= count1 || c2 >= count2 {
+				return 0, false
+			}
+			rec = sub + 16 + (c1*count2+c2)*(size1+size2)
+		default:
+			return 0, false
+		}
+		a.applyValue(i, rec, format1)
+		a.applyValue(j, rec+size1, format2)
+		if format2 != 0 {
+			return j + 1, true
+		}
+		return j, true
+	case 3: // cursive
+		coverage := sub + d.u16(sub+2)
+		k := d.coverage(coverage, g.id)
+		j := a.next(i)
+		if k < 0 || j < 0 || k >= d.u16(sub+4) {
+			return 0, false
+		}
+		exit := d.u16(sub + 6 + 4*k + 2)
+		l := d.coverage(coverage, a.glyphs[j].id)
+		if exit == 0 || l < 0 || l >= d.u16(sub+4) {
+			return 0, false
+		}
+		entry := d.u16(sub + 6 + 4*l)
+		if entry == 0 {
+			return 0, false
+		}
+		exitX, exitY := a.anchor(sub + exit)
+		entryX, entryY := a.anchor(sub + entry)
+		gi, gj := &a.glyphs[i], &a.glyphs[j]
+		if a.rtl {
+			dx := exitX + gi.xOffset
+			gi.xAdvance -= dx
+			gi.xOffset -= dx
+			gj.xAdvance = entryX + gj.xOffset
+		} else {
+			gi.xAdvance = exitX + gi.xOffset
+			dx := entryX + gj.xOffset
+			gj.xAdvance -= dx
+			gj.xOffset -= dx
+		}
+		// the child glyph is aligned vertically with its parent
+		if a.flag&otRightToLeft != 0 {
+			gi.cursive, gi.cursiveY = j+1, entryY-exitY
+		} else {
+			gj.cursive, gj.cursiveY = i+1, exitY-entryY
+		}
+		return j, true
+	case 4, 5: // mark to base, mark to ligature
+		markArray := sub + d.u16(sub+8)
+		mk := d.coverage(sub+d.u16(sub+2), g.id)
+		if mk < 0 || mk >= d.u16(markArray) {
+			return 0, false
+		}
+		// the base is the previous glyph that isn't a mark
+		j := i - 1
+		for j >= 0 && a.glyphs[j].class == otMark {
+			j--
+		}
+		if j < 0 {
+			return 0, false
+		}
+		bk := d.coverage(sub+d.u16(sub+4), a.glyphs[j].id)
+		classCount := d.u16(sub + 6)
+		class := d.u16(markArray + 2 + 4*mk)
+		baseArray := sub + d.u16(sub+10)
+		if bk < 0 || bk >= d.u16(baseArray) || class >= classCount {
+			return 0, false
+		}
+		var anchor int
+		if kind == 4 {
+			if off := d.u16(baseArray + 2 + 2*(bk*classCount+class)); off != 0 {
+				anchor = baseArray + off
+			}
+		} else {
+			attach := baseArray + d.u16(baseArray+2+2*bk)
+			components := d.u16(attach)
+			if components == 0 {
+				return 0, false
+			}
+			component := components - 1
+			if g.ligID != 0 && g.ligID == a.glyphs[j].ligID && g.ligComp > 0 && int(g.ligComp) <= components {
+				component = int(g.ligComp) - 1
+			}
+			if off := d.u16(attach + 2 + 2*(component*classCount+class)); off != 0 {
+				anchor = attach + off
+			}
+		}
+		if anchor == 0 {
+			return 0, false
+		}
+		a.attachMark(i, j, markArray+d.u16(markArray+2+4*mk+2), anchor)
+		return i + 1, true
+	case 6: // mark to mark
+		mark1Array := sub + d.u16(sub+8)
+		mk := d.coverage(sub+d.u16(sub+2), g.id)
+		j := a.prev(i)
+		if mk < 0 || mk >= d.u16(mark1Array) || j < 0 || a.glyphs[j].class != otMark {
+			return 0, false
+		}
+		k2 := d.coverage(sub+d.u16(sub+4), a.glyphs[j].id)
+		classCount := d.u16(sub + 6)
+		class := d.u16(mark1Array + 2 + 4*mk)
+		mark2Array := sub + d.u16(sub+10)
+		if k2 < 0 || k2 >= d.u16(mark2Array) || class >= classCount {
+			return 0, false
+		}
+		off := d.u16(mark2Array + 2 + 2*(k2*classCount+class))
+		if off == 0 {
+			return 0, false
+		}
+		a.attachMark(i, j, mark1Array+d.u16(mark1Array+2+4*mk+2), mark2Array+off)
+		return i + 1, true
+	case 7:
+		return a.context(sub, i, false)
+	case 8:
+		return a.context(sub, i, true)
+	}
+	return 0, false
+}
+
+// attachMark attaches the mark i to the glyph j so that their anchors, at
+// the offsets markAnchor and baseAnchor, coincide.
+func (a *otApplier) attachMark(i, j, markAnchor, baseAnchor int) {
+	mx, my := a.anchor(markAnchor)
+	bx, by := a.anchor(baseAnchor)
+	g := &a.glyphs[i]
+	g.attach, g.attachX, g.attachY = j+1, bx-mx, by-my
+}
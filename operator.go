@@ -0,0 +1,231 @@
+package gg
+
+import "math"
+
+// Operator determines how drawing operations combine the source colors with
+// the colors already in the image. The Porter-Duff operators combine them
+// based on their coverage, the blend modes mix the colors themselves and
+// then composite the result with source-over.
+type Operator int
+
+const (
+	OperatorOver Operator = iota
+	OperatorClear
+	OperatorSource
+	OperatorIn
+	OperatorOut
+	OperatorAtop
+	OperatorDestOver
+	OperatorDestIn
+	OperatorDestOut
+	OperatorDestAtop
+	OperatorXor
+	OperatorAdd
+	OperatorMultiply
+	OperatorScreen
+	OperatorOverlay
+	OperatorDarken
+	OperatorLighten
+	OperatorColorDodge
+	OperatorColorBurn
+	OperatorHardLight
+	OperatorSoftLight
+	OperatorDifference
+	OperatorExclusion
+	OperatorHue
+	OperatorSaturation
+	OperatorColor
+	OperatorLuminosity
+)
+
+// isBlendMode reports whether the operator is a blend mode rather than a
+// Porter-Duff operator.
+func (op Operator) isBlendMode() bool {
+	return op >= OperatorMultiply
+}
+
+// isUnbounded reports whether the operator changes the destination where
+// the source is transparent, so that it affects the whole clip region rather
+// than only the pixels covered by the drawing operation.
+func (op Operator) isUnbounded() bool {
+	switch op {
+	case OperatorClear, OperatorSource, OperatorIn, OperatorOut, OperatorDestIn, OperatorDestAtop:
+		return true
+	}
+	return false
+}
+
+// composite combines the premultiplied source and destination colors, with
+// components in [0, 1], using the operator.
+func composite(op Operator, s, d [4]float64) [4]float64 {
+	sa, da := s[3], d[3]
+	var fs, fd float64
+	switch op {
+	case OperatorClear:
+		return [4]float64{}
+	case OperatorSource:
+		fs, fd = 1, 0
+	case OperatorOver:
+		fs, fd = 1, 1-sa
+	case OperatorIn:
+		fs, fd = da, 0
+	case OperatorOut:
+		fs, fd = 1-da, 0
+	case OperatorAtop:
+		fs, fd = da, 1-sa
+	case OperatorDestOver:
+		fs, fd = 1-da, 1
+	case OperatorDestIn:
+		fs, fd = 0, sa
+	case OperatorDestOut:
+		fs, fd = 0, 1-sa
+	case OperatorDestAtop:
+		fs, fd = 1-da, sa
+	case OperatorXor:
+		fs, fd = 1-da, 1-sa
+	case OperatorAdd:
+		fs, fd = 1, 1
+	default:
+		return blend(op, s, d)
+	}
+	var r [4]float64
+	for i := range r {
+		r[i] = math.Min(1, s[i]*fs+d[i]*fd)
+	}
+	return r
+}
+
+// blend applies a blend mode as defined by the W3C Compositing and Blending
+// specification to premultiplied colors.
+func blend(op Operator, s, d [4]float64) [4]float64 {
+	sa, da := s[3], d[3]
+	var cs, cd [3]float64
+	for i := 0; i < 3; i++ {
+		if sa > 0 {
+			cs[i] = s[i] / sa
+		}
+		if da > 0 {
+			cd[i] = d[i] / da
+		}
+	}
+	var b [3]float64
+	switch op {
+	case OperatorHue:
+		b = setLum(setSat(cs, sat(cd)), lum(cd))
+	case OperatorSaturation:
+		b = setLum(setSat(cd, sat(cs)), lum(cd))
+	case OperatorColor:
+		b = setLum(cs, lum(cd))
+	case OperatorLuminosity:
+		b = setLum(cd, lum(cs))
+	default:
+		for i := range b {
+			b[i] = blendChannel(op, cs[i], cd[i])
+		}
+	}
+	var r [4]float64
+	for i := 0; i < 3; i++ {
+		r[i] = (1-da)*s[i] + (1-sa)*d[i] + sa*da*b[i]
+	}
+	r[3] = sa + da - sa*da
+	return r
+}
+
+// blendChannel applies a separable blend mode to non-premultiplied source
+// and destination components.
+func blendChannel(op Operator, s, d float64) float64 {
+	switch op {
+	case OperatorMultiply:
+		return s * d
+	case OperatorScreen:
+		return s + d - s*d
+	case OperatorOverlay:
+		return blendChannel(OperatorHardLight, d, s)
+	case OperatorDarken:
+		return math.Min(s, d)
+	case OperatorLighten:
+		return math.Max(s, d)
+	case OperatorColorDodge:
+		if d == 0 {
+			return 0
+		}
+		if s >= 1 {
+			return 1
+		}
+		return math.Min(1, d/(1-s))
+	case OperatorColorBurn:
+		if d >= 1 {
+			return 1
+		}
+		if s <= 0 {
+			return 0
+		}
+		return 1 - math.Min(1, (1-d)/s)
+	case OperatorHardLight:
+		if s <= 0.5 {
+			return d * 2 * s
+		}
+		return blendChannel(OperatorScreen, 2*s-1, d)
+	case OperatorSoftLight:
+		if s <= 0.5 {
+			return d - (1-2*s)*d*(1-d)
+		}
+		var e float64
+		if d <= 0.25 {
+			e = ((16*d-12)*d + 4) * d
+		} else {
+			e = math.Sqrt(d)
+		}
+		return d + (2*s-1)*(e-d)
+	case OperatorDifference:
+		return math.Abs(s - d)
+	case OperatorExclusion:
+		return s + d - 2*s*d
+	}
+	return s
+}
+
+func lum(c [3]float64) float64 {
+	return 0.3*c[0] + 0.59*c[1] + 0.11*c[2]
+}
+
+func setLum(c [3]float64, l float64) [3]float64 {
+	d := l - lum(c)
+	c = [3]float64{c[0] + d, c[1] + d, c[2] + d}
+	l = lum(c)
+	n := math.Min(c[0], math.Min(c[1], c[2]))
+	x := math.Max(c[0], math.Max(c[1], c[2]))
+	for i := range c {
+		if n < 0 {
+			c[i] = l + (c[i]-l)*l/(l-n)
+		}
+		if x > 1 {
+			c[i] = l + (c[i]-l)*(1-l)/(x-l)
+		}
+	}
+	return c
+}
+
+func sat(c [3]float64) float64 {
+	return math.Max(c[0], math.Max(c[1], c[2])) - math.Min(c[0], math.Min(c[1], c[2]))
+}
+
+func setSat(c [3]float64, s float64) [3]float64 {
+	// indices of the minimum, middle and maximum components
+	lo, mid, hi := 0, 1, 2
+	if c[lo] > c[mid] {
+		lo, mid = mid, lo
+	}
+	if c[mid] > c[hi] {
+		mid, hi = hi, mid
+	}
+	if c[lo] > c[mid] {
+		lo, mid = mid, lo
+	}
+	var r [3]float64
+	if c[hi] > c[lo] {
+		r[mid] = (c[mid] - c[lo]) * s / (c[hi] - c[lo])
+		r[hi] = s
+	}
+	return r
+}
@@ -0,0 +1,143 @@
+package gg
+
+import (
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// TextPath adds the outlines of the glyphs of the text, drawn at the
+// specified point as by DrawString, to the current path. The path can then
+// be filled with any fill style, stroked, used as a clip region or
+// transformed like any other path. Fill it with FillRuleWinding.
+//
+// The outlines are the exact quadratic curves of the font for faces loaded
+// with LoadFontFace or ParseFontFace. Other faces, such as bitmap fonts,
+// have no outlines, so their glyphs are traced pixel by pixel instead.
+func (dc *Context) TextPath(s string, x, y float64) {
+	var glyph truetype.GlyphBuf
+	glyphs, _ := dc.layoutText(s)
+	origin := fixp(x, y)
+	for _, g := range glyphs {
+		dot := origin.Add(g.dot)
+		if ttf, ok := g.face.(*trueTypeFace); ok {
+			dc.glyphOutline(ttf, &glyph, g.index, unfix(dot.X), unfix(dot.Y))
+		} else {
+			dc.glyphPixels(g.face, dot, g.r)
+		}
+	}
+}
+
+// StrokeString strokes the outlines of the glyphs of the text drawn at the
+// specified point, see TextPath, with the current stroke style, line width,
+// line cap, line join and dash settings. The current path is not changed.
+func (dc *Context) StrokeString(s string, x, y float64) {
+	path, fillPath, strokePath := dc.path, dc.fillPath, dc.strokePath
+	start, current, hasCurrent := dc.start, dc.current, dc.hasCurrent
+	dc.path, dc.fillPath, dc.strokePath = Path{}, nil, nil
+	dc.hasCurrent = false
+	dc.TextPath(s, x, y)
+	dc.StrokePreserve()
+	dc.path, dc.fillPath, dc.strokePath = path, fillPath, strokePath
+	dc.start, dc.current, dc.hasCurrent = start, current, hasCurrent
+}
+
+// glyphOutline adds the outline of the glyph, with its origin at x, y, to
+// the current path.
+func (dc *Context) glyphOutline(face *trueTypeFace, glyph *truetype.GlyphBuf, index truetype.Index, x, y float64) {
+	if !face.validGlyph(index) {
+		return
+	}
+	if err := glyph.Load(face.font, fix(face.points), index, font.HintingNone); err != nil {
+		return
+	}
+	// glyph coordinates are in 26.6 fixed point with y pointing up
+	point := func(p truetype.Point) Point {
+		return Point{x + unfix(p.X), y - unfix(p.Y)}
+	}
+	start := 0
+	for _, end := range glyph.Ends {
+		dc.contour(glyph.Points[start:end], point)
+		start = end
+	}
+}
+
+// contour adds a closed TrueType contour to the current path. The points are
+// either on the curve or the control points of quadratic curves, with an
+// implied point on the curve midway between two consecutive control points.
+func (dc *Context) contour(points []truetype.Point, point func(truetype.Point) Point) {
+	if len(points) == 0 {
+		return
+	}
+	onCurve := func(p truetype.Point) bool {
+		return p.Flags&1 != 0
+	}
+	// start on the curve: at the first point, at the last point or midway
+	// between them
+	var start Point
+	first, last := points[0], points[len(points)-1]
+	switch {
+	case onCurve(first):
+		start = point(first)
+		points = points[1:]
+	case onCurve(last):
+		start = point(last)
+		points = points[:len(points)-1]
+	default:
+		start = point(first).Interpolate(point(last), 0.5)
+	}
+	dc.MoveTo(start.X, start.Y)
+	var control Point
+	curve := false
+	for _, p := range points {
+		q := point(p)
+		switch {
+		case onCurve(p) && curve:
+			dc.QuadraticTo(control.X, control.Y, q.X, q.Y)
+			curve = false
+		case onCurve(p):
+			dc.LineTo(q.X, q.Y)
+		default:
+			if curve {
+				mid := control.Interpolate(q, 0.5)
+				dc.QuadraticTo(control.X, control.Y, mid.X, mid.Y)
+			}
+			control = q
+			curve = true
+		}
+	}
+	if curve {
+		dc.QuadraticTo(control.X, control.Y, start.X, start.Y)
+	}
+	dc.ClosePath()
+}
+
+// glyphPixels adds a rectangle for each run of mostly opaque pixels in the
+// mask of the glyph for c, drawn at dot, to the current path.
+func (dc *Context) glyphPixels(face font.Face, dot fixed.Point26_6, c rune) {
+	dr, mask, maskp, _, ok := face.Glyph(dot, c)
+	if !ok {
+		return
+	}
+	for y := dr.Min.Y; y < dr.Max.Y; y++ {
+		run := dr.Min.X
+		for x := dr.Min.X; x <= dr.Max.X; x++ {
+			inside := false
+			if x < dr.Max.X {
+				_, _, _, a := mask.At(maskp.X+x-dr.Min.X, maskp.Y+y-dr.Min.Y).RGBA()
+				inside = a >= 0x8000
+			}
+			if !inside {
+				if x > run {
+					x0, y0, x1, y1 := float64(run), float64(y), float64(x), float64(y+1)
+					dc.MoveTo(x0, y0)
+					dc.LineTo(x1, y0)
+					dc.LineTo(x1, y1)
+					dc.LineTo(x0, y1)
+					dc.ClosePath()
+				}
+				run = x + 1
+			}
+		}
+	}
+}
@@ -7,6 +7,329 @@ import (
 	"golang.org/x/image/math/fixed"
 )
 
+type SegmentType int
+
+const (
+	SegmentMoveTo SegmentType = iota
+	SegmentLineTo
+	SegmentQuadraticTo
+	SegmentCubicTo
+	SegmentClosePath
+)
+
+// Segment is a single element of a Path. Points holds the end point of a
+// MoveTo or LineTo segment, the control and end points of a QuadraticTo or
+// CubicTo segment and nothing for a ClosePath segment.
+type Segment struct {
+	Type   SegmentType
+	Points []Point
+}
+
+// Path is a sequence of subpaths made of lines and bezier curves that can be
+// built once and then appended to a context any number of times with
+// Context.AppendPath. The zero value is an empty path ready to use.
+type Path struct {
+	segments   []Segment
+	start      Point
+	current    Point
+	hasCurrent bool
+}
+
+// NewPath returns a new, empty path.
+func NewPath() *Path {
+	return &Path{}
+}
+
+// MoveTo starts a new subpath within the path starting at the specified
+// point.
+func (p *Path) MoveTo(x, y float64) {
+	q := Point{x, y}
+	p.segments = append(p.segments, Segment{SegmentMoveTo, []Point{q}})
+	p.start = q
+	p.current = q
+	p.hasCurrent = true
+}
+
+// LineTo adds a line segment to the path starting at the current point. If
+// there is no current point, it is equivalent to MoveTo(x, y)
+func (p *Path) LineTo(x, y float64) {
+	if !p.hasCurrent {
+		p.MoveTo(x, y)
+		return
+	}
+	q := Point{x, y}
+	p.segments = append(p.segments, Segment{SegmentLineTo, []Point{q}})
+	p.current = q
+}
+
+// QuadraticTo adds a quadratic bezier curve to the path starting at the
+// current point. If there is no current point, it first performs
+// MoveTo(x1, y1)
+func (p *Path) QuadraticTo(x1, y1, x2, y2 float64) {
+	if !p.hasCurrent {
+		p.MoveTo(x1, y1)
+	}
+	q := Point{x2, y2}
+	p.segments = append(p.segments, Segment{SegmentQuadraticTo, []Point{{x1, y1}, q}})
+	p.current = q
+}
+
+// CubicTo adds a cubic bezier curve to the path starting at the current
+// point. If there is no current point, it first performs MoveTo(x1, y1)
+func (p *Path) CubicTo(x1, y1, x2, y2, x3, y3 float64) {
+	if !p.hasCurrent {
+		p.MoveTo(x1, y1)
+	}
+	q := Point{x3, y3}
+	p.segments = append(p.segments, Segment{SegmentCubicTo, []Point{{x1, y1}, {x2, y2}, q}})
+	p.current = q
+}
+
+// ClosePath adds a line segment from the current point to the beginning of
+// the current subpath. If there is no current point, this is a no-op.
+func (p *Path) ClosePath() {
+	if p.hasCurrent {
+		p.segments = append(p.segments, Segment{SegmentClosePath, nil})
+		p.current = p.start
+	}
+}
+
+// NewSubPath starts a new subpath within the path. There is no current point
+// after this operation.
+func (p *Path) NewSubPath() {
+	p.hasCurrent = false
+}
+
+// Clear removes all segments from the path. There is no current point after
+// this operation.
+func (p *Path) Clear() {
+	p.segments = nil
+	p.hasCurrent = false
+}
+
+// CurrentPoint returns the current point and whether there is a current
+// point.
+func (p *Path) CurrentPoint() (Point, bool) {
+	if p.hasCurrent {
+		return p.current, true
+	}
+	return Point{}, false
+}
+
+func (p *Path) hasCurrentPoint() bool {
+	return p.hasCurrent
+}
+
+// Segments returns the segments of the path in order.
+func (p *Path) Segments() []Segment {
+	result := make([]Segment, len(p.segments))
+	for i, s := range p.segments {
+		result[i] = Segment{s.Type, append([]Point(nil), s.Points...)}
+	}
+	return result
+}
+
+// Copy returns a copy of the path.
+func (p *Path) Copy() *Path {
+	return p.Transform(Identity())
+}
+
+// Transform returns a copy of the path with all of its points transformed by
+// the specified matrix.
+func (p *Path) Transform(m Matrix) *Path {
+	result := &Path{segments: make([]Segment, len(p.segments))}
+	for i, s := range p.segments {
+		points := make([]Point, len(s.Points))
+		for j, q := range s.Points {
+			points[j].X, points[j].Y = m.TransformPoint(q.X, q.Y)
+		}
+		result.segments[i] = Segment{s.Type, points}
+	}
+	result.start.X, result.start.Y = m.TransformPoint(p.start.X, p.start.Y)
+	result.current.X, result.current.Y = m.TransformPoint(p.current.X, p.current.Y)
+	result.hasCurrent = p.hasCurrent
+	return result
+}
+
+// AppendPath appends all segments of the specified path to this path.
+func (p *Path) AppendPath(q *Path) {
+	for _, s := range q.segments {
+		p.appendSegment(s)
+	}
+}
+
+func (p *Path) appendSegment(s Segment) {
+	switch s.Type {
+	case SegmentMoveTo:
+		p.MoveTo(s.Points[0].X, s.Points[0].Y)
+	case SegmentLineTo:
+		p.LineTo(s.Points[0].X, s.Points[0].Y)
+	case SegmentQuadraticTo:
+		p.QuadraticTo(s.Points[0].X, s.Points[0].Y, s.Points[1].X, s.Points[1].Y)
+	case SegmentCubicTo:
+		p.CubicTo(s.Points[0].X, s.Points[0].Y, s.Points[1].X, s.Points[1].Y, s.Points[2].X, s.Points[2].Y)
+	case SegmentClosePath:
+		p.ClosePath()
+	}
+}
+
+func (p *Path) DrawLine(x1, y1, x2, y2 float64) {
+	drawLine(p, x1, y1, x2, y2)
+}
+
+func (p *Path) DrawRectangle(x, y, w, h float64) {
+	drawRectangle(p, x, y, w, h)
+}
+
+func (p *Path) DrawRoundedRectangle(x, y, w, h, r float64) {
+	drawRoundedRectangle(p, x, y, w, h, r)
+}
+
+func (p *Path) DrawEllipticalArc(x, y, rx, ry, angle1, angle2 float64) {
+	drawEllipticalArc(p, x, y, rx, ry, angle1, angle2)
+}
+
+func (p *Path) DrawEllipse(x, y, rx, ry float64) {
+	drawEllipse(p, x, y, rx, ry)
+}
+
+func (p *Path) DrawArc(x, y, r, angle1, angle2 float64) {
+	drawEllipticalArc(p, x, y, r, r, angle1, angle2)
+}
+
+func (p *Path) DrawCircle(x, y, r float64) {
+	drawEllipse(p, x, y, r, r)
+}
+
+func (p *Path) DrawRegularPolygon(n int, x, y, r, rotation float64) {
+	drawRegularPolygon(p, n, x, y, r, rotation)
+}
+
+// flatten converts the path to polylines, one per subpath. Closed subpaths
+// end with their first point.
+func (p *Path) flatten() [][]Point {
+	var result [][]Point
+	var path []Point
+	var start Point
+	for _, s := range p.segments {
+		var current Point
+		if len(path) > 0 {
+			current = path[len(path)-1]
+		}
+		switch s.Type {
+		case SegmentMoveTo:
+			if len(path) > 0 {
+				result = append(result, path)
+			}
+			path = []Point{s.Points[0]}
+			start = s.Points[0]
+		case SegmentLineTo:
+			path = append(path, s.Points[0])
+		case SegmentQuadraticTo:
+			a, b := s.Points[0], s.Points[1]
+			points := QuadraticBezier(current.X, current.Y, a.X, a.Y, b.X, b.Y)
+			path = append(path, points[1:]...)
+		case SegmentCubicTo:
+			a, b, c := s.Points[0], s.Points[1], s.Points[2]
+			points := CubicBezier(current.X, current.Y, a.X, a.Y, b.X, b.Y, c.X, c.Y)
+			path = append(path, points[1:]...)
+		case SegmentClosePath:
+			path = append(path, start)
+		}
+	}
+	if len(path) > 0 {
+		result = append(result, path)
+	}
+	return result
+}
+
+// pathBuilder is implemented by Context and Path so that they can share the
+// shape drawing functions.
+type pathBuilder interface {
+	MoveTo(x, y float64)
+	LineTo(x, y float64)
+	QuadraticTo(x1, y1, x2, y2 float64)
+	ClosePath()
+	NewSubPath()
+	hasCurrentPoint() bool
+}
+
+func drawLine(b pathBuilder, x1, y1, x2, y2 float64) {
+	b.MoveTo(x1, y1)
+	b.LineTo(x2, y2)
+}
+
+func drawRectangle(b pathBuilder, x, y, w, h float64) {
+	b.NewSubPath()
+	b.MoveTo(x, y)
+	b.LineTo(x+w, y)
+	b.LineTo(x+w, y+h)
+	b.LineTo(x, y+h)
+	b.ClosePath()
+}
+
+func drawRoundedRectangle(b pathBuilder, x, y, w, h, r float64) {
+	x0, x1, x2, x3 := x, x+r, x+w-r, x+w
+	y0, y1, y2, y3 := y, y+r, y+h-r, y+h
+	b.NewSubPath()
+	b.MoveTo(x1, y0)
+	b.LineTo(x2, y0)
+	drawEllipticalArc(b, x2, y1, r, r, Radians(270), Radians(360))
+	b.LineTo(x3, y2)
+	drawEllipticalArc(b, x2, y2, r, r, Radians(0), Radians(90))
+	b.LineTo(x1, y3)
+	drawEllipticalArc(b, x1, y2, r, r, Radians(90), Radians(180))
+	b.LineTo(x0, y1)
+	drawEllipticalArc(b, x1, y1, r, r, Radians(180), Radians(270))
+	b.ClosePath()
+}
+
+func drawEllipticalArc(b pathBuilder, x, y, rx, ry, angle1, angle2 float64) {
+	const n = 16
+	for i := 0; i < n; i++ {
+		p1 := float64(i+0) / n
+		p2 := float64(i+1) / n
+		a1 := angle1 + (angle2-angle1)*p1
+		a2 := angle1 + (angle2-angle1)*p2
+		x0 := x + rx*math.Cos(a1)
+		y0 := y + ry*math.Sin(a1)
+		x1 := x + rx*math.Cos((a1+a2)/2)
+		y1 := y + ry*math.Sin((a1+a2)/2)
+		x2 := x + rx*math.Cos(a2)
+		y2 := y + ry*math.Sin(a2)
+		cx := 2*x1 - x0/2 - x2/2
+		cy := 2*y1 - y0/2 - y2/2
+		if i == 0 {
+			if b.hasCurrentPoint() {
+				b.LineTo(x0, y0)
+			} else {
+				b.MoveTo(x0, y0)
+			}
+		}
+		b.QuadraticTo(cx, cy, x2, y2)
+	}
+}
+
+func drawEllipse(b pathBuilder, x, y, rx, ry float64) {
+	b.NewSubPath()
+	drawEllipticalArc(b, x, y, rx, ry, 0, 2*math.Pi)
+	b.ClosePath()
+}
+
+func drawRegularPolygon(b pathBuilder, n int, x, y, r, rotation float64) {
+	angle := 2 * math.Pi / float64(n)
+	rotation -= math.Pi / 2
+	if n%2 == 0 {
+		rotation += angle / 2
+	}
+	b.NewSubPath()
+	for i := 0; i < n; i++ {
+		a := rotation + angle*float64(i)
+		b.LineTo(x+r*math.Cos(a), y+r*math.Sin(a))
+	}
+	b.ClosePath()
+}
+
 func flattenPath(p raster.Path) [][]Point {
 	var result [][]Point
 	var path []Point
@@ -0,0 +1,227 @@
+package gg
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAppendPath(t *testing.T) {
+	p := NewPath()
+	p.DrawCircle(50, 50, 40)
+	p.DrawRectangle(10, 10, 30, 30)
+	p.MoveTo(90, 90)
+	p.CubicTo(10, 90, 90, 10, 10, 10)
+
+	dc1 := NewContext(100, 100)
+	dc1.RotateAbout(0.5, 50, 50)
+	dc1.DrawCircle(50, 50, 40)
+	dc1.DrawRectangle(10, 10, 30, 30)
+	dc1.MoveTo(90, 90)
+	dc1.CubicTo(10, 90, 90, 10, 10, 10)
+	dc1.SetRGB(0, 0, 0)
+	dc1.FillPreserve()
+	dc1.SetRGB(1, 0, 0)
+	dc1.Stroke()
+
+	dc2 := NewContext(100, 100)
+	dc2.RotateAbout(0.5, 50, 50)
+	dc2.AppendPath(p)
+	dc2.SetRGB(0, 0, 0)
+	dc2.FillPreserve()
+	dc2.SetRGB(1, 0, 0)
+	dc2.Stroke()
+
+	if hash(dc1) != hash(dc2) {
+		t.Fatal("appended path rendered differently than the same path drawn directly")
+	}
+}
+
+func TestCopyPath(t *testing.T) {
+	dc := NewContext(100, 100)
+	dc.Translate(10, 20)
+	dc.Rotate(1)
+	dc.Scale(2, 3)
+	dc.MoveTo(1, 2)
+	dc.QuadraticTo(3, 4, 5, 6)
+	dc.ClosePath()
+	expected := []Segment{
+		{SegmentMoveTo, []Point{{1, 2}}},
+		{SegmentQuadraticTo, []Point{{3, 4}, {5, 6}}},
+		{SegmentClosePath, nil},
+	}
+	actual := dc.CopyPath().Segments()
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d segments, got %d", len(expected), len(actual))
+	}
+	for i, s := range actual {
+		if s.Type != expected[i].Type || len(s.Points) != len(expected[i].Points) {
+			t.Fatalf("segment %d: expected %v, got %v", i, expected[i], s)
+		}
+		for j, p := range s.Points {
+			q := expected[i].Points[j]
+			if math.Abs(p.X-q.X) > 1e-9 || math.Abs(p.Y-q.Y) > 1e-9 {
+				t.Fatalf("segment %d: expected %v, got %v", i, expected[i], s)
+			}
+		}
+	}
+}
+
+func pathArea(p *Path) float64 {
+	var area float64
+	for _, points := range p.flatten() {
+		for i, a := range points {
+			b := points[(i+1)%len(points)]
+			area += a.X*b.Y - b.X*a.Y
+		}
+	}
+	return math.Abs(area / 2)
+}
+
+func TestBoolean(t *testing.T) {
+	a := NewPath()
+	a.DrawRectangle(0, 0, 10, 10)
+	b := NewPath()
+	b.DrawRectangle(5, 5, 10, 10)
+	cases := []struct {
+		op   BooleanOp
+		area float64
+	}{
+		{BooleanUnion, 175},
+		{BooleanIntersection, 25},
+		{BooleanDifference, 75},
+		{BooleanXor, 150},
+	}
+	for _, c := range cases {
+		area := pathArea(a.Boolean(b, c.op, FillRuleWinding))
+		if math.Abs(area-c.area) > 1e-6 {
+			t.Errorf("op %d: expected area %g, got %g", c.op, c.area, area)
+		}
+	}
+
+	star := NewPath()
+	for i := 0; i < 5; i++ {
+		angle := float64(i*2)*2*math.Pi/5 - math.Pi/2
+		star.LineTo(50+40*math.Cos(angle), 50+40*math.Sin(angle))
+	}
+	star.ClosePath()
+	winding := pathArea(star.Union(NewPath(), FillRuleWinding))
+	evenOdd := pathArea(star.Union(NewPath(), FillRuleEvenOdd))
+	if evenOdd >= winding {
+		t.Errorf("expected the even-odd star to have a hole: %g >= %g", evenOdd, winding)
+	}
+	if u := pathArea(star.Union(star, FillRuleEvenOdd)); math.Abs(u-evenOdd) > 1e-6 {
+		t.Errorf("expected union with itself to keep the area: %g != %g", u, evenOdd)
+	}
+}
+
+func TestStroke(t *testing.T) {
+	line := NewPath()
+	line.DrawLine(0, 0, 100, 0)
+	cases := []struct {
+		cap    LineCap
+		dashes []float64
+		area   float64
+	}{
+		{LineCapButt, nil, 1000},
+		{LineCapSquare, nil, 1100},
+		{LineCapButt, []float64{20, 5}, 800},
+	}
+	for _, c := range cases {
+		outline := line.Stroke(10, c.cap, LineJoinMiter, c.dashes...)
+		area := pathArea(outline.Union(NewPath(), FillRuleWinding))
+		if math.Abs(area-c.area) > 1 {
+			t.Errorf("cap %d, dashes %v: expected area %g, got %g", c.cap, c.dashes, c.area, area)
+		}
+	}
+}
+
+func TestOffset(t *testing.T) {
+	square := NewPath()
+	square.DrawRectangle(0, 0, 10, 10)
+	cases := []struct {
+		distance float64
+		join     LineJoin
+		area     float64
+	}{
+		{2, LineJoinMiter, 196},
+		{2, LineJoinBevel, 196 - 4*2},
+		{2, LineJoinRound, 180 + 4*math.Pi},
+		{-2, LineJoinMiter, 36},
+		{-2, LineJoinRound, 36},
+		{0, LineJoinMiter, 100},
+	}
+	for _, c := range cases {
+		area := pathArea(square.Offset(c.distance, c.join))
+		if math.Abs(area-c.area) > 0.5 {
+			t.Errorf("offset %g, join %d: expected area %g, got %g", c.distance, c.join, c.area, area)
+		}
+	}
+	if area := pathArea(square.Offset(-6, LineJoinMiter)); area > 1e-6 {
+		t.Errorf("expected shrinking past the center to leave nothing, got area %g", area)
+	}
+}
+
+func TestArcLength(t *testing.T) {
+	p := NewPath()
+	p.MoveTo(0, 0)
+	p.LineTo(100, 0)
+	p.LineTo(100, 50)
+	p.MoveTo(0, 100)
+	p.QuadraticTo(50, 100, 100, 100)
+	if l := p.Length(); math.Abs(l-250) > 1e-6 {
+		t.Errorf("expected length 250, got %g", l)
+	}
+	cases := []struct {
+		d     float64
+		point Point
+		angle float64
+	}{
+		{-10, Point{0, 0}, 0},
+		{50, Point{50, 0}, 0},
+		{125, Point{100, 25}, math.Pi / 2},
+		{200, Point{50, 100}, 0},
+		{1000, Point{100, 100}, 0},
+	}
+	for _, c := range cases {
+		q, angle := p.PointAtLength(c.d)
+		if q.Distance(c.point) > 1e-6 || math.Abs(angle-c.angle) > 1e-6 {
+			t.Errorf("at %g: expected %v, %g, got %v, %g", c.d, c.point, c.angle, q, angle)
+		}
+	}
+
+	circle := NewPath()
+	circle.DrawCircle(0, 0, 10)
+	if l := circle.Length(); math.Abs(l-20*math.Pi) > 0.05 {
+		t.Errorf("expected the circumference %g, got %g", 20*math.Pi, l)
+	}
+
+	a, b := p.SplitAtLength(125)
+	if la, lb := a.Length(), b.Length(); math.Abs(la-125) > 1e-6 || math.Abs(lb-125) > 1e-6 {
+		t.Errorf("expected halves of 125, got %g and %g", la, lb)
+	}
+	expected := []SegmentType{SegmentMoveTo, SegmentLineTo, SegmentMoveTo, SegmentQuadraticTo}
+	for i, s := range b.Segments() {
+		if i >= len(expected) || s.Type != expected[i] {
+			t.Fatalf("unexpected segments %v", b.Segments())
+		}
+	}
+
+	trimmed := p.Trim(175, 225)
+	if l := trimmed.Length(); math.Abs(l-50) > 1e-6 {
+		t.Errorf("expected a trimmed length of 50, got %g", l)
+	}
+	if q, _ := trimmed.PointAtLength(0); q.Distance(Point{25, 100}) > 1e-6 {
+		t.Errorf("expected the trimmed curve to start at 25, 100, got %v", q)
+	}
+
+	square := NewPath()
+	square.DrawRectangle(0, 0, 10, 10)
+	segments := square.Trim(0, 40).Segments()
+	if segments[len(segments)-1].Type != SegmentClosePath {
+		t.Error("expected an untrimmed subpath to stay closed")
+	}
+	segments = square.Trim(5, 40).Segments()
+	if segments[len(segments)-1].Type == SegmentClosePath {
+		t.Error("expected a trimmed subpath to be open")
+	}
+}
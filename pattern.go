@@ -3,6 +3,7 @@ package gg
 import (
 	"image"
 	"image/color"
+	"math"
 
 	"github.com/golang/freetype/raster"
 )
@@ -14,12 +15,75 @@ const (
 	RepeatX
 	RepeatY
 	RepeatNone
+	RepeatMirror
+	RepeatMirrorX
+	RepeatMirrorY
 )
 
 type Pattern interface {
 	ColorAt(x, y int) color.Color
 }
 
+// sampler is implemented by the patterns that can be evaluated at arbitrary
+// points, so that the context can draw them through a transform. The
+// coordinates are those of ColorAt, i.e. x, y refers to the pixel centered at
+// x+0.5, y+0.5.
+type sampler interface {
+	Pattern
+	sample(x, y float64) color.Color
+}
+
+// areaSampler is implemented by the patterns that are antialiased, which
+// need to know the size of a pixel in their coordinates.
+type areaSampler interface {
+	sampleArea(x, y, pixel float64) color.Color
+}
+
+// transformPixel maps the pixel coordinates x, y through the matrix, taking
+// into account that the pixel is centered at x+0.5, y+0.5.
+func transformPixel(m Matrix, x, y float64) (float64, float64) {
+	x, y = m.TransformPoint(x+0.5, y+0.5)
+	return x - 0.5, y - 0.5
+}
+
+// transformedPattern is a pattern that was set as the fill or stroke style
+// while the context had a transform, so that it follows the geometry drawn
+// with that transform. matrix maps user space to device space.
+type transformedPattern struct {
+	pattern sampler
+	matrix  Matrix
+	inverse Matrix
+}
+
+func newTransformedPattern(p Pattern, m Matrix) Pattern {
+	s, ok := p.(sampler)
+	if !ok || m == Identity() {
+		return p
+	}
+	return &transformedPattern{s, m, m.Invert()}
+}
+
+// untransformPattern returns the pattern that p was created from and the
+// matrix that maps its user space to device space.
+func untransformPattern(p Pattern) (Pattern, Matrix) {
+	if t, ok := p.(*transformedPattern); ok {
+		return t.pattern, t.matrix
+	}
+	return p, Identity()
+}
+
+func (p *transformedPattern) ColorAt(x, y int) color.Color {
+	return p.sample(float64(x), float64(y))
+}
+
+func (p *transformedPattern) sample(x, y float64) color.Color {
+	if a, ok := p.pattern.(areaSampler); ok {
+		x, y = transformPixel(p.inverse, x, y)
+		return a.sampleArea(x, y, math.Sqrt(math.Abs(p.inverse.XX*p.inverse.YY-p.inverse.XY*p.inverse.YX)))
+	}
+	return p.pattern.sample(transformPixel(p.inverse, x, y))
+}
+
 // Solid Pattern
 type solidPattern struct {
 	color color.Color
@@ -33,45 +97,236 @@ func NewSolidPattern(color color.Color) Pattern {
 	return &solidPattern{color: color}
 }
 
+// SurfacePattern is a pattern that repeats an image.
+type SurfacePattern interface {
+	Pattern
+
+	// SetMatrix sets the matrix that maps the image coordinates to the
+	// space in which the pattern is used, which is the user space of the
+	// context when the pattern is set as its fill or stroke style. The
+	// default is the identity matrix.
+	SetMatrix(m Matrix)
+
+	// SetFilter sets how the image is sampled between its pixels. The
+	// default is FilterNearest.
+	SetFilter(filter Filter)
+}
+
+// Filter determines how images are sampled when they are scaled or
+// transformed.
+type Filter int
+
+const (
+	// FilterNearest uses the nearest pixel of the image.
+	FilterNearest Filter = iota
+	// FilterBilinear interpolates linearly between the 4 nearest pixels.
+	FilterBilinear
+	// FilterBicubic interpolates between the 16 nearest pixels with a
+	// Catmull-Rom spline, which is sharper than FilterBilinear.
+	FilterBicubic
+)
+
+// wrapMode is how a surface pattern continues along one axis.
+type wrapMode int
+
+const (
+	wrapNone wrapMode = iota
+	wrapRepeat
+	wrapMirror
+)
+
+// wrapModes returns how the repeat op continues the image along x and y.
+func (op RepeatOp) wrapModes() (wrapMode, wrapMode) {
+	switch op {
+	case RepeatBoth:
+		return wrapRepeat, wrapRepeat
+	case RepeatX:
+		return wrapRepeat, wrapNone
+	case RepeatY:
+		return wrapNone, wrapRepeat
+	case RepeatMirror:
+		return wrapMirror, wrapMirror
+	case RepeatMirrorX:
+		return wrapMirror, wrapNone
+	case RepeatMirrorY:
+		return wrapNone, wrapMirror
+	}
+	return wrapNone, wrapNone
+}
+
+// apply maps the coordinate i to [0, n), or returns false if the position is
+// outside of the image and the image isn't continued.
+func (w wrapMode) apply(i, n int) (int, bool) {
+	switch w {
+	case wrapRepeat:
+		i %= n
+		if i < 0 {
+			i += n
+		}
+	case wrapMirror:
+		i %= 2 * n
+		if i < 0 {
+			i += 2 * n
+		}
+		if i >= n {
+			i = 2*n - 1 - i
+		}
+	default:
+		if i < 0 || i >= n {
+			return 0, false
+		}
+	}
+	return i, true
+}
+
 // Surface Pattern
 type surfacePattern struct {
-	im image.Image
-	op RepeatOp
+	im      image.Image
+	op      RepeatOp
+	filter  Filter
+	inverse Matrix
+}
+
+func (p *surfacePattern) SetMatrix(m Matrix) {
+	p.inverse = m.Invert()
+}
+
+func (p *surfacePattern) SetFilter(filter Filter) {
+	p.filter = filter
 }
 
 func (p *surfacePattern) ColorAt(x, y int) color.Color {
-	b := p.im.Bounds()
-	switch p.op {
-	case RepeatX:
-		if y >= b.Dy() {
-			return color.Transparent
+	return p.sample(float64(x), float64(y))
+}
+
+func (p *surfacePattern) sample(fx, fy float64) color.Color {
+	// pixel x covers [x-0.5, x+0.5) in these coordinates
+	fx, fy = transformPixel(p.inverse, fx, fy)
+	switch p.filter {
+	case FilterBilinear:
+		x, y := math.Floor(fx), math.Floor(fy)
+		tx, ty := fx-x, fy-y
+		var c [4]float64
+		for j := 0; j < 2; j++ {
+			for i := 0; i < 2; i++ {
+				w := math.Abs(1-float64(i)-tx) * math.Abs(1-float64(j)-ty)
+				c = addScaled(c, p.texel(int(x)+i, int(y)+j), w)
+			}
 		}
-	case RepeatY:
-		if x >= b.Dx() {
-			return color.Transparent
+		return premultipliedToRGBA64(c)
+	case FilterBicubic:
+		x, y := math.Floor(fx), math.Floor(fy)
+		wx := catmullRom(fx - x)
+		wy := catmullRom(fy - y)
+		var c [4]float64
+		for j := 0; j < 4; j++ {
+			for i := 0; i < 4; i++ {
+				c = addScaled(c, p.texel(int(x)+i-1, int(y)+j-1), wx[i]*wy[j])
+			}
 		}
-	case RepeatNone:
-		if x >= b.Dx() || y >= b.Dy() {
-			return color.Transparent
+		// the spline overshoots, keep the color premultiplied
+		c[3] = clamp01(c[3])
+		for i := 0; i < 3; i++ {
+			c[i] = math.Max(0, math.Min(c[3], c[i]))
 		}
+		return premultipliedToRGBA64(c)
+	}
+	x, y, ok := p.wrap(int(math.Floor(fx+0.5)), int(math.Floor(fy+0.5)))
+	if !ok {
+		return color.Transparent
 	}
-	x = x%b.Dx() + b.Min.X
-	y = y%b.Dy() + b.Min.Y
 	return p.im.At(x, y)
 }
 
-func NewSurfacePattern(im image.Image, op RepeatOp) Pattern {
-	return &surfacePattern{im: im, op: op}
+// wrap maps the pixel coordinates, relative to the origin of the image, to
+// coordinates of the image.
+func (p *surfacePattern) wrap(x, y int) (int, int, bool) {
+	b := p.im.Bounds()
+	if b.Empty() {
+		return 0, 0, false
+	}
+	wx, wy := p.op.wrapModes()
+	x, okx := wx.apply(x, b.Dx())
+	y, oky := wy.apply(y, b.Dy())
+	return x + b.Min.X, y + b.Min.Y, okx && oky
+}
+
+// texel returns the premultiplied color of the pixel of the pattern.
+func (p *surfacePattern) texel(x, y int) [4]float64 {
+	x, y, ok := p.wrap(x, y)
+	if !ok {
+		return [4]float64{}
+	}
+	return premultipliedColor(p.im.At(x, y))
+}
+
+// catmullRom returns the weights of the 4 samples around a point that is
+// the fraction t of the way between the middle two.
+func catmullRom(t float64) [4]float64 {
+	t2, t3 := t*t, t*t*t
+	return [4]float64{
+		(-t3 + 2*t2 - t) / 2,
+		(3*t3 - 5*t2 + 2) / 2,
+		(-3*t3 + 4*t2 + t) / 2,
+		(t3 - t2) / 2,
+	}
+}
+
+func addScaled(c, d [4]float64, w float64) [4]float64 {
+	for i := range c {
+		c[i] += d[i] * w
+	}
+	return c
+}
+
+func NewSurfacePattern(im image.Image, op RepeatOp) SurfacePattern {
+	return &surfacePattern{im: im, op: op, inverse: Identity()}
 }
 
 type patternPainter struct {
-	im   *image.RGBA
-	mask *image.Alpha
-	p    Pattern
+	im     *image.RGBA
+	mask   *image.Alpha
+	p      Pattern
+	op     Operator
+	alpha  uint32
+	dither bool
+
+	// coverage accumulates the coverage of the spans for unbounded
+	// operators, which are applied to the whole image when painting is done
+	coverage []uint32
+}
+
+// bayer is the threshold matrix for ordered dithering.
+var bayer = [8][8]uint8{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+// dither8 converts the 16-bit value to 8 bits, adding the threshold t, in
+// [0, 256), before truncating.
+func dither8(v, t uint32) uint8 {
+	v = (v + t) >> 8
+	if v > 255 {
+		v = 255
+	}
+	return uint8(v)
 }
 
 // Paint satisfies the Painter interface.
 func (r *patternPainter) Paint(ss []raster.Span, done bool) {
+	if r.op.isUnbounded() {
+		r.accumulate(ss)
+		if done {
+			r.paintUnbounded()
+		}
+		return
+	}
 	b := r.im.Bounds()
 	for _, s := range ss {
 		if s.Y < b.Min.Y {
@@ -96,7 +351,7 @@ func (r *patternPainter) Paint(ss []raster.Span, done bool) {
 		i0 := (s.Y-r.im.Rect.Min.Y)*r.im.Stride + (s.X0-r.im.Rect.Min.X)*4
 		i1 := i0 + (s.X1-s.X0)*4
 		for i, x := i0, x0; i < i1; i, x = i+4, x+1 {
-			ma := s.Alpha
+			ma := s.Alpha * r.alpha / m
 			if r.mask != nil {
 				ma = ma * uint32(r.mask.AlphaAt(x, y).A) / 255
 				if ma == 0 {
@@ -105,19 +360,112 @@ func (r *patternPainter) Paint(ss []raster.Span, done bool) {
 			}
 			c := r.p.ColorAt(x, y)
 			cr, cg, cb, ca := c.RGBA()
+			var t uint32
+			if r.dither {
+				t = uint32(bayer[y&7][x&7])*4 + 2
+			}
+			if r.op != OperatorOver {
+				r.composite(r.im.Pix[i:i+4], [4]uint32{cr, cg, cb, ca}, ma, t)
+				continue
+			}
 			dr := uint32(r.im.Pix[i+0])
 			dg := uint32(r.im.Pix[i+1])
 			db := uint32(r.im.Pix[i+2])
 			da := uint32(r.im.Pix[i+3])
 			a := (m - (ca * ma / m)) * 0x101
-			r.im.Pix[i+0] = uint8((dr*a + cr*ma) / m >> 8)
-			r.im.Pix[i+1] = uint8((dg*a + cg*ma) / m >> 8)
-			r.im.Pix[i+2] = uint8((db*a + cb*ma) / m >> 8)
-			r.im.Pix[i+3] = uint8((da*a + ca*ma) / m >> 8)
+			r.im.Pix[i+0] = dither8((dr*a+cr*ma)/m, t)
+			r.im.Pix[i+1] = dither8((dg*a+cg*ma)/m, t)
+			r.im.Pix[i+2] = dither8((db*a+cb*ma)/m, t)
+			r.im.Pix[i+3] = dither8((da*a+ca*ma)/m, t)
+		}
+	}
+}
+
+// accumulate adds the coverage of the spans, clipped to the image.
+func (r *patternPainter) accumulate(ss []raster.Span) {
+	const m = 1<<16 - 1
+	b := r.im.Bounds()
+	if r.coverage == nil {
+		r.coverage = make([]uint32, b.Dx()*b.Dy())
+	}
+	for _, s := range ss {
+		if s.Y < b.Min.Y || s.Y >= b.Max.Y {
+			continue
+		}
+		if s.X0 < b.Min.X {
+			s.X0 = b.Min.X
+		}
+		if s.X1 > b.Max.X {
+			s.X1 = b.Max.X
+		}
+		i := (s.Y-b.Min.Y)*b.Dx() - b.Min.X
+		for x := s.X0; x < s.X1; x++ {
+			c := r.coverage[i+x] + s.Alpha*r.alpha/m
+			if c > m {
+				c = m
+			}
+			r.coverage[i+x] = c
+		}
+	}
+}
+
+// paintUnbounded composites the accumulated coverage over the whole image,
+// within the mask. The source is transparent where nothing was covered,
+// which clears the destination for the unbounded operators.
+func (r *patternPainter) paintUnbounded() {
+	const m = 1<<16 - 1
+	b := r.im.Bounds()
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			k := uint32(m)
+			if r.mask != nil {
+				k = uint32(r.mask.AlphaAt(x, y).A) * 0x101
+				if k == 0 {
+					continue
+				}
+			}
+			var c [4]uint32
+			if ma := r.coverage[y*b.Dx()+x]; ma > 0 {
+				cr, cg, cb, ca := r.p.ColorAt(x, y).RGBA()
+				c = [4]uint32{cr * ma / m, cg * ma / m, cb * ma / m, ca * ma / m}
+			}
+			var t uint32
+			if r.dither {
+				t = uint32(bayer[y&7][x&7])*4 + 2
+			}
+			i := y*r.im.Stride + x*4
+			r.composite(r.im.Pix[i:i+4], c, k, t)
+		}
+	}
+	r.coverage = nil
+}
+
+// composite combines the 16-bit source color with the destination pixel
+// using the painter's operator. Pixels only partially covered get a mix of
+// the composited and the original color. The dither threshold t is as for
+// dither8.
+func (r *patternPainter) composite(pix []uint8, c [4]uint32, coverage, t uint32) {
+	const m = 1<<16 - 1
+	var s, d [4]float64
+	for j := range s {
+		s[j] = float64(c[j]) / m
+		d[j] = float64(pix[j]) / 255
+	}
+	o := composite(r.op, s, d)
+	k := float64(coverage) / m
+	for j := range pix {
+		v := d[j] + (o[j]-d[j])*k
+		if t == 0 {
+			v = v*255 + 0.5
+		} else {
+			v = v*255 + float64(t)/256
 		}
+		pix[j] = uint8(math.Max(0, math.Min(255, v)))
 	}
 }
 
-func newPatternPainter(im *image.RGBA, mask *image.Alpha, p Pattern) *patternPainter {
-	return &patternPainter{im, mask, p}
+func newPatternPainter(im *image.RGBA, mask *image.Alpha, p Pattern, op Operator, alpha float64) *patternPainter {
+	base, _ := untransformPattern(p)
+	d, ok := base.(interface{ dithered() bool })
+	return &patternPainter{im: im, mask: mask, p: p, op: op, alpha: uint32(alpha*0xffff + 0.5), dither: ok && d.dithered()}
 }
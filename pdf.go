@@ -0,0 +1,893 @@
+package gg
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/fixed"
+)
+
+// NewPDFContext creates a new context with the specified page width and
+// height, in points, that records its drawing operations as native PDF
+// content so that they can be written out with EncodePDF or SavePDF. Use
+// NewPage to start additional pages. The operations are rasterized as usual,
+// so Image returns the rendered current page.
+func NewPDFContext(width, height int) *Context {
+	dc := NewContext(width, height)
+	dc.surface = newPDFSurface(width, height)
+	return dc
+}
+
+// NewPage finishes the current page of a context created with NewPDFContext
+// and starts a new, blank page. The image of the context is cleared, but the
+// rest of its state is kept. It does nothing for other contexts.
+func (dc *Context) NewPage() {
+	s, ok := dc.surface.(*pdfSurface)
+	if !ok {
+		return
+	}
+	s.newPage()
+	draw.Draw(dc.im, dc.im.Bounds(), image.Transparent, image.ZP, draw.Src)
+}
+
+// SavePDF writes the recorded pages to disk as a PDF document. The context
+// must have been created with NewPDFContext.
+func (dc *Context) SavePDF(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return dc.EncodePDF(file)
+}
+
+// EncodePDF writes the recorded pages to the provided io.Writer as a PDF
+// document. The context must have been created with NewPDFContext.
+func (dc *Context) EncodePDF(w io.Writer) error {
+	s, ok := dc.surface.(*pdfSurface)
+	if !ok {
+		return errors.New("context was not created with NewPDFContext")
+	}
+	return s.encode(w)
+}
+
+type pdfClip struct {
+	path string
+	rule FillRule
+}
+
+type pdfFont struct {
+	name   string
+	object int
+	font   *truetype.Font
+	data   []byte
+	glyphs map[truetype.Index]string // the text of each glyph used
+}
+
+// width returns the advance of the glyph in thousandths of the font size,
+// as in the widths of the font.
+func (f *pdfFont) width(index truetype.Index) int {
+	units := fixed.Int26_6(f.font.FUnitsPerEm())
+	return int(f.font.HMetric(units, index).AdvanceWidth) * 1000 / int(units)
+}
+
+type pdfSurface struct {
+	width     int
+	height    int
+	objects   [][]byte
+	pages     []*bytes.Buffer
+	page      *bytes.Buffer
+	xobjects  map[string]int
+	patterns  map[string]int
+	states    map[string]int
+	stateKeys map[string]string
+	fonts     map[*truetype.Font]*pdfFont
+	names     int
+	clips     []pdfClip
+	maskState string
+	alpha     float64
+	groups    []pdfGroup
+	forms     []pdfForm
+}
+
+// pdfGroup is a group being recorded: the content and clipping region from
+// before it.
+type pdfGroup struct {
+	page      *bytes.Buffer
+	clips     []pdfClip
+	maskState string
+}
+
+// pdfForm is a form XObject with the content of a group. Its data is written
+// by encode, as it refers to the resources of the document.
+type pdfForm struct {
+	object  int
+	content []byte
+}
+
+func newPDFSurface(width, height int) *pdfSurface {
+	s := &pdfSurface{
+		width:     width,
+		height:    height,
+		xobjects:  make(map[string]int),
+		patterns:  make(map[string]int),
+		states:    make(map[string]int),
+		stateKeys: make(map[string]string),
+		fonts:     make(map[*truetype.Font]*pdfFont),
+		alpha:     1,
+	}
+	s.newPage()
+	return s
+}
+
+func (s *pdfSurface) newPage() {
+	s.page = &bytes.Buffer{}
+	s.pages = append(s.pages, s.page)
+	// flip the y axis so that the content uses device space
+	fmt.Fprintf(s.page, "1 0 0 -1 0 %d cm\n", s.height)
+}
+
+// add appends an object to the document and returns its object number.
+func (s *pdfSurface) add(data []byte) int {
+	s.objects = append(s.objects, data)
+	return len(s.objects)
+}
+
+// reserve returns an object number whose data will be set later.
+func (s *pdfSurface) reserve() int {
+	return s.add(nil)
+}
+
+func (s *pdfSurface) set(object int, data []byte) {
+	s.objects[object-1] = data
+}
+
+func (s *pdfSurface) nextName(prefix string) string {
+	s.names++
+	return prefix + strconv.Itoa(s.names)
+}
+
+func (s *pdfSurface) encode(w io.Writer) error {
+	catalog := s.reserve()
+	pages := s.reserve()
+	resources := s.reserve()
+
+	for _, f := range s.fonts {
+		s.writeFont(f)
+	}
+	for _, f := range s.forms {
+		s.set(f.object, pdfStream(fmt.Sprintf(
+			"/Type /XObject /Subtype /Form /BBox [0 0 %d %d] "+
+				"/Group << /S /Transparency >> /Resources %d 0 R",
+			s.width, s.height, resources), f.content))
+	}
+
+	var kids []string
+	for _, page := range s.pages {
+		content := s.add(pdfStream("", page.Bytes()))
+		object := s.add([]byte(fmt.Sprintf(
+			"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] /Resources %d 0 R /Contents %d 0 R >>",
+			pages, s.width, s.height, resources, content)))
+		kids = append(kids, fmt.Sprintf("%d 0 R", object))
+	}
+	s.set(catalog, []byte(fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages)))
+	s.set(pages, []byte(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>",
+		strings.Join(kids, " "), len(kids))))
+
+	fonts := make(map[string]int)
+	for _, f := range s.fonts {
+		fonts[f.name] = f.object
+	}
+	var b bytes.Buffer
+	b.WriteString("<< /ProcSet [/PDF /Text /ImageB /ImageC]")
+	writeResources := func(key string, m map[string]int) {
+		if len(m) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, " /%s <<", key)
+		for _, name := range sortedKeys(m) {
+			fmt.Fprintf(&b, " /%s %d 0 R", name, m[name])
+		}
+		b.WriteString(" >>")
+	}
+	writeResources("XObject", s.xobjects)
+	writeResources("Pattern", s.patterns)
+	writeResources("ExtGState", s.states)
+	writeResources("Font", fonts)
+	b.WriteString(" >>")
+	s.set(resources, b.Bytes())
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(s.objects))
+	for i, data := range s.objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n", i+1)
+		out.Write(data)
+		out.WriteString("\nendobj\n")
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(s.objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(s.objects)+1, catalog, xref)
+
+	// the document stays open for more drawing, so drop the objects that
+	// are rebuilt on every encode
+	s.objects = s.objects[:catalog-1]
+	for _, f := range s.fonts {
+		s.objects[f.object-1] = nil
+	}
+	for _, f := range s.forms {
+		s.objects[f.object-1] = nil
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// alphaState returns the name of a graphics state that sets the fill or
+// stroke alpha.
+func (s *pdfSurface) alphaState(alpha float64, stroke bool) string {
+	key := "ca"
+	if stroke {
+		key = "CA"
+	}
+	return s.state(fmt.Sprintf("/%s %s", key, pdfFloat(alpha)))
+}
+
+// pdfBlendModes maps the blend mode operators to PDF blend mode names. The
+// Porter-Duff operators have no PDF equivalent, see recordRaster.
+var pdfBlendModes = map[Operator]string{
+	OperatorMultiply:   "Multiply",
+	OperatorScreen:     "Screen",
+	OperatorOverlay:    "Overlay",
+	OperatorDarken:     "Darken",
+	OperatorLighten:    "Lighten",
+	OperatorColorDodge: "ColorDodge",
+	OperatorColorBurn:  "ColorBurn",
+	OperatorHardLight:  "HardLight",
+	OperatorSoftLight:  "SoftLight",
+	OperatorDifference: "Difference",
+	OperatorExclusion:  "Exclusion",
+	OperatorHue:        "Hue",
+	OperatorSaturation: "Saturation",
+	OperatorColor:      "Color",
+	OperatorLuminosity: "Luminosity",
+}
+
+// state returns the name of a graphics state with the given entries,
+// adding it on first use.
+func (s *pdfSurface) state(key string) string {
+	if name, ok := s.stateKeys[key]; ok {
+		return name
+	}
+	name := s.nextName("GS")
+	s.states[name] = s.add([]byte("<< /Type /ExtGState " + key + " >>"))
+	s.stateKeys[key] = name
+	return name
+}
+
+// begin saves the graphics state and applies the clipping region, global
+// alpha and blend mode. Every drawing operation is wrapped in begin and end,
+// as PDF clipping regions can only be removed by restoring the graphics
+// state.
+func (s *pdfSurface) begin(dc *Context) {
+	s.page.WriteString("q\n")
+	s.alpha = dc.globalAlpha
+	if s.alpha < 1 {
+		a := pdfFloat(s.alpha)
+		fmt.Fprintf(s.page, "/%s gs\n", s.state("/ca "+a+" /CA "+a))
+	}
+	if mode, ok := pdfBlendModes[dc.operator]; ok {
+		fmt.Fprintf(s.page, "/%s gs\n", s.state("/BM /"+mode))
+	}
+	if s.maskState != "" {
+		fmt.Fprintf(s.page, "/%s gs\n", s.maskState)
+	}
+	for _, c := range s.clips {
+		s.page.WriteString(c.path)
+		if c.rule == FillRuleEvenOdd {
+			s.page.WriteString("W* n\n")
+		} else {
+			s.page.WriteString("W n\n")
+		}
+	}
+}
+
+func (s *pdfSurface) end() {
+	s.page.WriteString("Q\n")
+	s.alpha = 1
+}
+
+// paint selects the pattern as the fill or stroke paint. Patterns without a
+// PDF equivalent, which include repeating and reflecting gradients, are
+// sampled over the bounds of the path, grown by pad pixels, and used as an
+// image tiling pattern.
+func (s *pdfSurface) paint(pattern Pattern, path *Path, pad int, stroke bool) {
+	base, m := untransformPattern(pattern)
+	switch p := base.(type) {
+	case *solidPattern:
+		s.color(p.color, stroke)
+		return
+	case *linearGradient:
+		if p.extend == ExtendPad && pdfOpaque(p.stops) {
+			coords := fmt.Sprintf("%s %s %s %s",
+				pdfFloat(p.x0), pdfFloat(p.y0), pdfFloat(p.x1), pdfFloat(p.y1))
+			s.selectPattern(s.shading(2, coords, p.vectorStops(p.stops), p.matrix.Multiply(m)), stroke)
+			return
+		}
+	case *radialGradient:
+		if p.extend == ExtendPad && pdfOpaque(p.stops) {
+			coords := fmt.Sprintf("%s %s %s %s %s %s",
+				pdfFloat(p.c0.x), pdfFloat(p.c0.y), pdfFloat(p.c0.r),
+				pdfFloat(p.c1.x), pdfFloat(p.c1.y), pdfFloat(p.c1.r))
+			s.selectPattern(s.shading(3, coords, p.vectorStops(p.stops), p.matrix.Multiply(m)), stroke)
+			return
+		}
+	case *tilePattern:
+		if p.size > 0 && (p.fg[3] == 0 || p.fg[3] == 1) && (p.bg[3] == 0 || p.bg[3] == 1) {
+			s.selectPattern(s.tiling(p, m), stroke)
+			return
+		}
+	}
+	r := pathBounds(path, s.width, s.height).Inset(-pad)
+	r = r.Intersect(image.Rect(0, 0, s.width, s.height))
+	if r.Empty() {
+		s.color(color.Transparent, stroke)
+		return
+	}
+	im := s.image(patternImage(pattern, r))
+	content := fmt.Sprintf("%d 0 0 %d 0 0 cm /%s Do", r.Dx(), r.Dy(), im)
+	name := s.nextName("P")
+	s.patterns[name] = s.add(pdfStream(fmt.Sprintf(
+		"/Type /Pattern /PatternType 1 /PaintType 1 /TilingType 1 "+
+			"/BBox [0 0 %d %d] /XStep %d /YStep %d /Matrix [1 0 0 1 %d %d] "+
+			"/Resources << /XObject << /%s %d 0 R >> >>",
+		r.Dx(), r.Dy(), r.Dx(), r.Dy(), r.Min.X, s.height-r.Max.Y,
+		im, s.xobjects[im]), []byte(content)))
+	s.selectPattern(name, stroke)
+}
+
+func (s *pdfSurface) color(c color.Color, stroke bool) {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	op := "rg"
+	if stroke {
+		op = "RG"
+	}
+	fmt.Fprintf(s.page, "%s %s %s %s\n",
+		pdfFloat(float64(n.R)/255), pdfFloat(float64(n.G)/255),
+		pdfFloat(float64(n.B)/255), op)
+	// the alpha of the color replaces the global alpha, so they are combined
+	if a := float64(n.A) / 255 * s.alpha; a < 1 {
+		fmt.Fprintf(s.page, "/%s gs\n", s.alphaState(a, stroke))
+	}
+}
+
+func (s *pdfSurface) selectPattern(name string, stroke bool) {
+	if stroke {
+		fmt.Fprintf(s.page, "/Pattern CS /%s SCN\n", name)
+	} else {
+		fmt.Fprintf(s.page, "/Pattern cs /%s scn\n", name)
+	}
+}
+
+// shading adds an axial (2) or radial (3) shading pattern and returns its
+// name. The matrix maps the gradient coordinates to device space, the
+// pattern matrix also undoes the flip of the page content.
+func (s *pdfSurface) shading(shadingType int, coords string, stops stops, m Matrix) string {
+	m = m.Multiply(Matrix{1, 0, 0, -1, 0, float64(s.height)})
+	name := s.nextName("P")
+	s.patterns[name] = s.add([]byte(fmt.Sprintf(
+		"<< /Type /Pattern /PatternType 2 /Matrix [%s] "+
+			"/Shading << /ShadingType %d /ColorSpace /DeviceRGB /Coords [%s] "+
+			"/Extend [true true] /Function %s >> >>",
+		pdfMatrix(m), shadingType, coords, pdfFunction(stops))))
+	return name
+}
+
+// tiling adds a tiling pattern that draws the tile of the procedural
+// pattern and returns its name. The colors of the pattern must be opaque or
+// fully transparent. The matrix maps the pattern coordinates to device
+// space.
+func (s *pdfSurface) tiling(p *tilePattern, m Matrix) string {
+	size, shapes := p.tile()
+	var content strings.Builder
+	if p.bg[3] > 0 {
+		fmt.Fprintf(&content, "%s rg 0 0 %s %s re f\n", pdfRGB(p.bgColor), pdfFloat(size), pdfFloat(size))
+	}
+	if p.fg[3] > 0 {
+		fmt.Fprintf(&content, "%s rg\n%sf\n", pdfRGB(p.fgColor), pdfPathData(shapes))
+	}
+	m = Rotate(Radians(p.angle)).Multiply(m).Multiply(Matrix{1, 0, 0, -1, 0, float64(s.height)})
+	name := s.nextName("P")
+	s.patterns[name] = s.add(pdfStream(fmt.Sprintf(
+		"/Type /Pattern /PatternType 1 /PaintType 1 /TilingType 1 "+
+			"/BBox [0 0 %s %s] /XStep %s /YStep %s /Matrix [%s] /Resources << >>",
+		pdfFloat(size), pdfFloat(size), pdfFloat(size), pdfFloat(size), pdfMatrix(m)),
+		[]byte(content.String())))
+	return name
+}
+
+// image adds the image as an XObject and returns its name. Transparent images
+// get a soft mask holding their alpha channel.
+func (s *pdfSurface) image(im image.Image) string {
+	b := im.Bounds()
+	w, h := b.Dx(), b.Dy()
+	rgb := make([]byte, 0, w*h*3)
+	alpha := make([]byte, 0, w*h)
+	opaque := true
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(im.At(x, y)).(color.NRGBA)
+			rgb = append(rgb, c.R, c.G, c.B)
+			alpha = append(alpha, c.A)
+			if c.A != 255 {
+				opaque = false
+			}
+		}
+	}
+	dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d "+
+		"/ColorSpace /DeviceRGB /BitsPerComponent 8", w, h)
+	if !opaque {
+		smask := s.add(pdfStream(fmt.Sprintf(
+			"/Type /XObject /Subtype /Image /Width %d /Height %d "+
+				"/ColorSpace /DeviceGray /BitsPerComponent 8", w, h), alpha))
+		dict += fmt.Sprintf(" /SMask %d 0 R", smask)
+	}
+	name := s.nextName("Im")
+	s.xobjects[name] = s.add(pdfStream(dict, rgb))
+	return name
+}
+
+func (s *pdfSurface) fill(dc *Context, path *Path, rule FillRule, pattern Pattern) {
+	data := pdfPathData(path)
+	if data == "" {
+		return
+	}
+	s.begin(dc)
+	s.paint(pattern, path, 0, false)
+	s.page.WriteString(data)
+	if rule == FillRuleEvenOdd {
+		s.page.WriteString("f*\n")
+	} else {
+		s.page.WriteString("f\n")
+	}
+	s.end()
+}
+
+func (s *pdfSurface) stroke(dc *Context, path *Path, pattern Pattern) {
+	data := pdfPathData(path)
+	if data == "" {
+		return
+	}
+	s.begin(dc)
+	s.paint(pattern, path, int(math.Ceil(dc.lineWidth)), true)
+	fmt.Fprintf(s.page, "%s w\n", pdfFloat(dc.lineWidth))
+	switch dc.lineCap {
+	case LineCapButt:
+		s.page.WriteString("0 J\n")
+	case LineCapRound:
+		s.page.WriteString("1 J\n")
+	case LineCapSquare:
+		s.page.WriteString("2 J\n")
+	}
+	switch dc.lineJoin {
+	case LineJoinRound:
+		s.page.WriteString("1 j\n")
+	case LineJoinBevel:
+		s.page.WriteString("2 j\n")
+	case LineJoinMiter:
+		fmt.Fprintf(s.page, "0 j %s M\n", pdfFloat(dc.miterLimit))
+	}
+	if len(dc.dashes) > 0 {
+		dashes := make([]string, len(dc.dashes))
+		for i, x := range dc.dashes {
+			dashes[i] = pdfFloat(x)
+		}
+		fmt.Fprintf(s.page, "[%s] %s d\n", strings.Join(dashes, " "), pdfFloat(dc.dashOffset))
+	}
+	s.page.WriteString(data)
+	s.page.WriteString("S\n")
+	s.end()
+}
+
+func (s *pdfSurface) clip(dc *Context, path *Path, rule FillRule) {
+	s.clips = append(s.clips, pdfClip{pdfPathData(path), rule})
+}
+
+func (s *pdfSurface) setMask(mask *image.Alpha) {
+	s.clips = nil
+	s.maskState = ""
+	if mask == nil {
+		return
+	}
+	// soft masks use luminance, so the alpha values become gray levels
+	b := mask.Bounds()
+	var pix []byte
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := mask.PixOffset(b.Min.X, y)
+		pix = append(pix, mask.Pix[i:i+b.Dx()]...)
+	}
+	im := s.add(pdfStream(fmt.Sprintf(
+		"/Type /XObject /Subtype /Image /Width %d /Height %d "+
+			"/ColorSpace /DeviceGray /BitsPerComponent 8", b.Dx(), b.Dy()), pix))
+	content := fmt.Sprintf("%d 0 0 %d %d %d cm /M Do", b.Dx(), -b.Dy(), b.Min.X, b.Max.Y)
+	form := s.add(pdfStream(fmt.Sprintf(
+		"/Type /XObject /Subtype /Form /BBox [0 0 %d %d] "+
+			"/Group << /S /Transparency /CS /DeviceGray >> "+
+			"/Resources << /XObject << /M %d 0 R >> >>",
+		s.width, s.height, im), []byte(content)))
+	name := s.nextName("GS")
+	s.states[name] = s.add([]byte(fmt.Sprintf(
+		"<< /Type /ExtGState /SMask << /Type /Mask /S /Luminosity /G %d 0 R >> >>", form)))
+	s.maskState = name
+}
+
+func (s *pdfSurface) clear(c color.Color) {
+	s.page.Reset()
+	if len(s.groups) == 0 {
+		fmt.Fprintf(s.page, "1 0 0 -1 0 %d cm\n", s.height)
+	}
+	if _, _, _, a := c.RGBA(); a == 0 {
+		return
+	}
+	s.page.WriteString("q\n")
+	s.color(c, false)
+	fmt.Fprintf(s.page, "0 0 %d %d re f\nQ\n", s.width, s.height)
+}
+
+// pushGroup sends the content to a new buffer, which becomes a transparency
+// group. Groups are drawn in the device space of the page, so their content
+// needs no flip.
+func (s *pdfSurface) pushGroup() {
+	s.groups = append(s.groups, pdfGroup{s.page, s.clips, s.maskState})
+	s.page = &bytes.Buffer{}
+	s.clips, s.maskState = nil, ""
+}
+
+func (s *pdfSurface) popGroup(dc *Context, paint bool) {
+	g := s.groups[len(s.groups)-1]
+	s.groups = s.groups[:len(s.groups)-1]
+	content := s.page.Bytes()
+	s.page, s.clips, s.maskState = g.page, g.clips, g.maskState
+	if !paint || len(content) == 0 {
+		return
+	}
+	name := s.nextName("Fm")
+	object := s.reserve()
+	s.xobjects[name] = object
+	s.forms = append(s.forms, pdfForm{object, content})
+	s.begin(dc)
+	fmt.Fprintf(s.page, "/%s Do\n", name)
+	s.end()
+}
+
+func (s *pdfSurface) replace(im image.Image) {
+	s.clear(color.Transparent)
+	b := im.Bounds()
+	if b.Empty() {
+		return
+	}
+	name := s.image(im)
+	m := Matrix{float64(b.Dx()), 0, 0, float64(-b.Dy()), float64(b.Min.X), float64(b.Max.Y)}
+	fmt.Fprintf(s.page, "q\n%s cm /%s Do\nQ\n", pdfMatrix(m), name)
+}
+
+func (s *pdfSurface) drawImage(dc *Context, im image.Image, m Matrix) {
+	b := im.Bounds()
+	if b.Empty() {
+		return
+	}
+	name := s.image(im)
+	// the image occupies the unit square, with its first row at the top
+	m = Matrix{float64(b.Dx()), 0, 0, float64(-b.Dy()), float64(b.Min.X), float64(b.Max.Y)}.Multiply(m)
+	s.begin(dc)
+	fmt.Fprintf(s.page, "%s cm /%s Do\n", pdfMatrix(m), name)
+	s.end()
+}
+
+func (s *pdfSurface) drawString(dc *Context, str string, x, y float64) {
+	glyphs, _ := dc.layoutText(str)
+	face, ok := dc.fontFace.(*trueTypeFace)
+	for _, g := range glyphs {
+		if _, isTTF := g.face.(*trueTypeFace); !isTTF {
+			ok = false
+		}
+	}
+	if !ok {
+		// there is no font to embed, so the text is embedded as an image
+		coverage := image.NewRGBA(image.Rect(0, 0, s.width, s.height))
+		dc.drawString(coverage, image.Opaque, str, x, y)
+		if r := opaqueBounds(coverage); !r.Empty() {
+			im := image.NewRGBA(r)
+			draw.DrawMask(im, r, patternImage(dc.fillPattern, r), r.Min, coverage, r.Min, draw.Src)
+			s.drawImage(dc, im, Identity())
+		}
+		return
+	}
+	if len(glyphs) > 0 {
+		face = glyphs[0].face.(*trueTypeFace)
+	}
+	f := s.font(face)
+	name, size := f.name, face.points
+	var b strings.Builder
+	b.WriteString("[<")
+	// the glyphs are moved from where the widths of the font put them to
+	// where they were laid out, leaving out differences that are only due to
+	// rounding
+	var pen, rise float64
+	for _, g := range glyphs {
+		if g.face != face {
+			// glyphs of a fallback face switch fonts
+			face = g.face.(*trueTypeFace)
+			f = s.font(face)
+			fmt.Fprintf(&b, ">] TJ\n/%s %s Tf\n[<", f.name, pdfFloat(face.points))
+		}
+		gx, gy := unfix(g.dot.X), -unfix(g.dot.Y)
+		// TJ adjustments are in thousandths of text space, which is scaled
+		// by the font size
+		if adjust := (pen - gx) * 1000 / face.points; math.Abs(adjust) >= 5 {
+			fmt.Fprintf(&b, "> %s <", pdfFloat(adjust))
+			pen = gx
+		}
+		if gy != rise {
+			fmt.Fprintf(&b, ">] TJ\n%s Ts\n[<", pdfFloat(gy))
+			rise = gy
+		}
+		if f.glyphs[g.index] == "" {
+			f.glyphs[g.index] = g.text
+		}
+		fmt.Fprintf(&b, "%04x", g.index)
+		pen += float64(f.width(g.index)) * face.points / 1000
+	}
+	b.WriteString(">] TJ\n")
+	if rise != 0 {
+		b.WriteString("0 Ts\n")
+	}
+	m := Matrix{1, 0, 0, -1, x, y}.Multiply(dc.matrix)
+	s.begin(dc)
+	s.paint(dc.fillPattern, textBounds(dc, str, x, y), 0, false)
+	fmt.Fprintf(s.page, "BT\n/%s %s Tf\n%s Tm\n%sET\n",
+		name, pdfFloat(size), pdfMatrix(m), b.String())
+	s.end()
+}
+
+// font returns the embedded font for the face, adding it on first use.
+func (s *pdfSurface) font(face *trueTypeFace) *pdfFont {
+	if f, ok := s.fonts[face.font]; ok {
+		return f
+	}
+	f := &pdfFont{
+		name:   s.nextName("F"),
+		object: s.reserve(),
+		font:   face.font,
+		data:   face.data,
+		glyphs: make(map[truetype.Index]string),
+	}
+	s.fonts[face.font] = f
+	return f
+}
+
+// writeFont writes the font as a composite font with Identity-H encoding, so
+// that text strings are made of two byte glyph indexes.
+func (s *pdfSurface) writeFont(f *pdfFont) {
+	ttf := f.font
+	units := fixed.Int26_6(ttf.FUnitsPerEm())
+	scale := func(x fixed.Int26_6) int {
+		return int(x) * 1000 / int(units)
+	}
+	base := strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || strings.ContainsRune("()<>[]{}/%#?", r) {
+			return -1
+		}
+		return r
+	}, ttf.Name(truetype.NameIDPostscriptName))
+	if base == "" {
+		base = "Font" + f.name
+	}
+	bounds := ttf.Bounds(units)
+
+	indexes := make([]int, 0, len(f.glyphs))
+	for index := range f.glyphs {
+		indexes = append(indexes, int(index))
+	}
+	sort.Ints(indexes)
+	var widths strings.Builder
+	var mapped []int
+	for _, index := range indexes {
+		fmt.Fprintf(&widths, "%d [%d] ", index, f.width(truetype.Index(index)))
+		if f.glyphs[truetype.Index(index)] != "" {
+			mapped = append(mapped, index)
+		}
+	}
+
+	var cmap strings.Builder
+	cmap.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n" +
+		"1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	// glyphs for whole clusters, such as ligatures, map to their text and
+	// the other glyphs of the clusters to nothing
+	for i := 0; i < len(mapped); i += 100 {
+		j := i + 100
+		if j > len(mapped) {
+			j = len(mapped)
+		}
+		fmt.Fprintf(&cmap, "%d beginbfchar\n", j-i)
+		for _, index := range mapped[i:j] {
+			fmt.Fprintf(&cmap, "<%04x> <", index)
+			for _, u := range utf16.Encode([]rune(f.glyphs[truetype.Index(index)])) {
+				fmt.Fprintf(&cmap, "%04x", u)
+			}
+			cmap.WriteString(">\n")
+		}
+		cmap.WriteString("endbfchar\n")
+	}
+	cmap.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+
+	file := s.add(pdfStream(fmt.Sprintf("/Length1 %d", len(f.data)), f.data))
+	descriptor := s.add([]byte(fmt.Sprintf(
+		"<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] "+
+			"/ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		base, scale(bounds.Min.X), scale(bounds.Min.Y), scale(bounds.Max.X), scale(bounds.Max.Y),
+		scale(bounds.Max.Y), scale(bounds.Min.Y), scale(bounds.Max.Y), file)))
+	cid := s.add([]byte(fmt.Sprintf(
+		"<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s "+
+			"/CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> "+
+			"/FontDescriptor %d 0 R /CIDToGIDMap /Identity /W [%s] >>",
+		base, descriptor, widths.String())))
+	toUnicode := s.add(pdfStream("", []byte(cmap.String())))
+	s.set(f.object, []byte(fmt.Sprintf(
+		"<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H "+
+			"/DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		base, cid, toUnicode)))
+}
+
+// pdfFunction returns a PDF function that interpolates the gradient stops
+// over the domain [0, 1].
+func pdfFunction(stops stops) string {
+	if len(stops) == 1 {
+		c := pdfRGB(stops[0].color)
+		return fmt.Sprintf("<< /FunctionType 2 /Domain [0 1] /C0 [%s] /C1 [%s] /N 1 >>", c, c)
+	}
+	// make sure the stops cover the whole domain
+	var s []stop
+	if stops[0].pos > 0 {
+		s = append(s, stop{0, stops[0].color})
+	}
+	for _, x := range stops {
+		s = append(s, stop{math.Max(0, math.Min(1, x.pos)), x.color})
+	}
+	if last := stops[len(stops)-1]; last.pos < 1 {
+		s = append(s, stop{1, last.color})
+	}
+	var functions, bounds, encode []string
+	for i := 1; i < len(s); i++ {
+		functions = append(functions, fmt.Sprintf(
+			"<< /FunctionType 2 /Domain [0 1] /C0 [%s] /C1 [%s] /N 1 >>",
+			pdfRGB(s[i-1].color), pdfRGB(s[i].color)))
+		encode = append(encode, "0 1")
+		if i < len(s)-1 {
+			bounds = append(bounds, pdfFloat(s[i].pos))
+		}
+	}
+	return fmt.Sprintf("<< /FunctionType 3 /Domain [0 1] /Functions [%s] /Bounds [%s] /Encode [%s] >>",
+		strings.Join(functions, " "), strings.Join(bounds, " "), strings.Join(encode, " "))
+}
+
+func pdfOpaque(stops stops) bool {
+	if len(stops) == 0 {
+		return false
+	}
+	for _, s := range stops {
+		if _, _, _, a := s.color.RGBA(); a != 0xffff {
+			return false
+		}
+	}
+	return true
+}
+
+func pdfRGB(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("%s %s %s",
+		pdfFloat(float64(n.R)/255), pdfFloat(float64(n.G)/255), pdfFloat(float64(n.B)/255))
+}
+
+func pdfPathData(path *Path) string {
+	var b strings.Builder
+	var start, current Point
+	for _, s := range path.segments {
+		switch s.Type {
+		case SegmentMoveTo:
+			start = s.Points[0]
+			current = start
+			fmt.Fprintf(&b, "%s %s m\n", pdfFloat(current.X), pdfFloat(current.Y))
+		case SegmentLineTo:
+			current = s.Points[0]
+			fmt.Fprintf(&b, "%s %s l\n", pdfFloat(current.X), pdfFloat(current.Y))
+		case SegmentQuadraticTo:
+			// PDF has no quadratic curves, so they are raised to cubics
+			p1, p2 := s.Points[0], s.Points[1]
+			fmt.Fprintf(&b, "%s %s %s %s %s %s c\n",
+				pdfFloat(current.X+(p1.X-current.X)*2/3), pdfFloat(current.Y+(p1.Y-current.Y)*2/3),
+				pdfFloat(p2.X+(p1.X-p2.X)*2/3), pdfFloat(p2.Y+(p1.Y-p2.Y)*2/3),
+				pdfFloat(p2.X), pdfFloat(p2.Y))
+			current = p2
+		case SegmentCubicTo:
+			p1, p2, p3 := s.Points[0], s.Points[1], s.Points[2]
+			fmt.Fprintf(&b, "%s %s %s %s %s %s c\n",
+				pdfFloat(p1.X), pdfFloat(p1.Y), pdfFloat(p2.X), pdfFloat(p2.Y),
+				pdfFloat(p3.X), pdfFloat(p3.Y))
+			current = p3
+		case SegmentClosePath:
+			current = start
+			b.WriteString("h\n")
+		}
+	}
+	return b.String()
+}
+
+func pdfStream(dict string, data []byte) []byte {
+	var z bytes.Buffer
+	w := zlib.NewWriter(&z)
+	w.Write(data)
+	w.Close()
+	var b bytes.Buffer
+	if dict != "" {
+		dict += " "
+	}
+	fmt.Fprintf(&b, "<< %s/Length %d /Filter /FlateDecode >>\nstream\n", dict, z.Len())
+	b.Write(z.Bytes())
+	b.WriteString("\nendstream")
+	return b.Bytes()
+}
+
+func pdfFloat(x float64) string {
+	return strconv.FormatFloat(math.Round(x*1e6)/1e6, 'f', -1, 64)
+}
+
+func pdfMatrix(m Matrix) string {
+	return fmt.Sprintf("%s %s %s %s %s %s",
+		pdfFloat(m.XX), pdfFloat(m.YX), pdfFloat(m.XY),
+		pdfFloat(m.YY), pdfFloat(m.X0), pdfFloat(m.Y0))
+}
+
+// opaqueBounds returns the bounds of the pixels of the image that are not
+// fully transparent.
+func opaqueBounds(im *image.RGBA) image.Rectangle {
+	var r image.Rectangle
+	b := im.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if im.Pix[im.PixOffset(x, y)+3] != 0 {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return r
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,1113 @@
+package gg
+
+import (
+	"image"
+	"math"
+	"sort"
+	"unicode"
+
+	"github.com/golang/freetype/raster"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// This file lays out lines of text. The line is split into runs of the same
+// direction by the bidi algorithm, into runs of the same script and into
+// runs of the same face, the current face or one of its fallbacks. For
+// TrueType faces each run is shaped: its characters are mapped to glyphs,
+// which are substituted and positioned by the OpenType tables of the font
+// and by the rules of complex scripts such as Arabic and the Indic scripts.
+// Other faces get a glyph per character, as by font.Drawer.
+
+// textGlyph is a glyph of a line of text, in visual order.
+type textGlyph struct {
+	face  font.Face      // the face of the glyph
+	r     rune           // the character, for faces other than TrueType
+	index truetype.Index // the glyph, for TrueType faces
+
+	// text is the text of the cluster of the glyph, on the first glyph of
+	// the cluster and empty on the others
+	text string
+
+	// dot is the origin of the glyph relative to the origin of the line
+	dot     fixed.Point26_6
+	advance fixed.Int26_6
+}
+
+// layoutText lays out the line of text with the current font face and its
+// fallbacks and returns its glyphs and its width.
+func (dc *Context) layoutText(s string) ([]textGlyph, fixed.Int26_6) {
+	runes := []rune(s)
+	faces := dc.runeFaces(runes)
+	l := lineLayout{runes: runes}
+	for _, run := range bidiRuns(runes) {
+		items := splitFaces(itemizeScripts(runes[run.start:run.end]), faces[run.start:run.end])
+		if run.rtl() {
+			for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+				items[i], items[j] = items[j], items[i]
+			}
+		}
+		for _, item := range items {
+			start, end := run.start+item.start, run.start+item.end
+			if f, ok := item.face.(*trueTypeFace); ok {
+				l.place(f, f.shape(runes[start:end], start, item.script, run.rtl()), end, run.rtl())
+			} else {
+				l.placeRunes(item.face, start, end, run.rtl())
+			}
+		}
+	}
+	return l.glyphs, l.x
+}
+
+// textHeight returns the height of the line of glyphs: the font height of
+// the current face, or more if the glyphs include a fallback face that is
+// taller. Faces are compared by their ascent and descent, so that the font
+// heights of SetFontFace and LoadFontFace, which differ, don't matter.
+func (dc *Context) textHeight(glyphs []textGlyph) float64 {
+	h := dc.fontHeight
+	m := dc.fontFace.Metrics()
+	size := float64(m.Ascent + m.Descent)
+	var last font.Face
+	for _, g := range glyphs {
+		if g.face == dc.fontFace || g.face == last || size <= 0 {
+			continue
+		}
+		last = g.face
+		m := g.face.Metrics()
+		h = math.Max(h, dc.fontHeight*float64(m.Ascent+m.Descent)/size)
+	}
+	return h
+}
+
+// runeFaces returns the face of each rune: the first of the current face
+// and its fallbacks that has glyphs for the whole cluster of the rune, or
+// failing that for the first rune of the cluster, or failing that the
+// current face.
+func (dc *Context) runeFaces(runes []rune) []font.Face {
+	faces := make([]font.Face, len(runes))
+	for start := 0; start < len(runes); {
+		end := start + 1
+		for end < len(runes) && (extendsCluster(runes[end]) || runes[end-1] == 0x200D) {
+			end++
+		}
+		face := dc.fontFace
+		if len(dc.fontFallbacks) != 0 {
+			face = dc.clusterFace(runes[start:end])
+		}
+		for i := start; i < end; i++ {
+			faces[i] = face
+		}
+		start = end
+	}
+	return faces
+}
+
+func (dc *Context) clusterFace(cluster []rune) font.Face {
+	candidates := append([]font.Face{dc.fontFace}, dc.fontFallbacks...)
+	for _, face := range candidates {
+		ok := true
+		for _, r := range cluster {
+			// joiners and variation selectors need no glyph
+			if r != 0x200C && r != 0x200D && !unicode.Is(unicode.Variation_Selector, r) && !hasGlyph(face, r) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return face
+		}
+	}
+	for _, face := range candidates {
+		if hasGlyph(face, cluster[0]) {
+			return face
+		}
+	}
+	return dc.fontFace
+}
+
+// extendsCluster reports whether the rune belongs to the cluster of the
+// character before it: combining marks, which include the variation
+// selectors, the zero width joiner and emoji skin tone modifiers. The
+// character after a zero width joiner belongs to the cluster too.
+func extendsCluster(r rune) bool {
+	return r == 0x200D || (r >= 0x1F3FB && r <= 0x1F3FF) || unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc)
+}
+
+// hasGlyph reports whether the face has a glyph for the rune.
+func hasGlyph(face font.Face, r rune) bool {
+	if f, ok := face.(*trueTypeFace); ok {
+		return f.font.Index(r) != 0
+	}
+	_, ok := face.GlyphAdvance(r)
+	return ok
+}
+
+// splitFaces splits the script runs where the face of the runes changes.
+func splitFaces(items []scriptRun, faces []font.Face) []scriptRun {
+	var result []scriptRun
+	for _, item := range items {
+		for i := item.start; i < item.end; i++ {
+			if i == item.start || faces[i] != faces[i-1] {
+				result = append(result, scriptRun{i, i, item.script, faces[i]})
+			}
+			result[len(result)-1].end = i + 1
+		}
+	}
+	return result
+}
+
+// Shapers for the scripts that need more than the default features.
+const (
+	shapeDefault = iota
+	shapeArabic
+	shapeIndic
+	shapeThai
+)
+
+// otScript is a script and how to shape it.
+type otScript struct {
+	table  *unicode.RangeTable
+	tags   []string // OpenType script tags, preferred first
+	shaper int
+
+	// the start of the Unicode block of an Indic script, and whether a Ra
+	// followed by a virama at the start of a syllable forms a reph
+	block rune
+	reph  bool
+}
+
+var otScripts = []otScript{
+	{table: unicode.Latin, tags: []string{"latn"}},
+	{table: unicode.Greek, tags: []string{"grek"}},
+	{table: unicode.Cyrillic, tags: []string{"cyrl"}},
+	{table: unicode.Armenian, tags: []string{"armn"}},
+	{table: unicode.Georgian, tags: []string{"geor"}},
+	{table: unicode.Hebrew, tags: []string{"hebr"}},
+	{table: unicode.Arabic, tags: []string{"arab"}, shaper: shapeArabic},
+	{table: unicode.Syriac, tags: []string{"syrc"}, shaper: shapeArabic},
+	{table: unicode.Devanagari, tags: []string{"dev2", "deva"}, shaper: shapeIndic, block: 0x0900, reph: true},
+	{table: unicode.Bengali, tags: []string{"bng2", "beng"}, shaper: shapeIndic, block: 0x0980, reph: true},
+	{table: unicode.Gurmukhi, tags: []string{"gur2", "guru"}, shaper: shapeIndic, block: 0x0A00},
+	{table: unicode.Gujarati, tags: []string{"gjr2", "gujr"}, shaper: shapeIndic, block: 0x0A80, reph: true},
+	{table: unicode.Oriya, tags: []string{"ory2", "orya"}, shaper: shapeIndic, block: 0x0B00, reph: true},
+	{table: unicode.Tamil, tags: []string{"tml2", "taml"}, shaper: shapeIndic, block: 0x0B80},
+	{table: unicode.Telugu, tags: []string{"tel2", "telu"}, shaper: shapeIndic, block: 0x0C00},
+	{table: unicode.Kannada, tags: []string{"knd2", "knda"}, shaper: shapeIndic, block: 0x0C80, reph: true},
+	{table: unicode.Malayalam, tags: []string{"mlm2", "mlym"}, shaper: shapeIndic, block: 0x0D00, reph: true},
+	{table: unicode.Thai, tags: []string{"thai"}, shaper: shapeThai},
+	{table: unicode.Lao, tags: []string{"lao "}, shaper: shapeThai},
+	{table: unicode.Tibetan, tags: []string{"tibt"}},
+	{table: unicode.Khmer, tags: []string{"khmr"}},
+	{table: unicode.Myanmar, tags: []string{"mym2", "mymr"}},
+	{table: unicode.Ethiopic, tags: []string{"ethi"}},
+	{table: unicode.Hangul, tags: []string{"hang"}},
+	{table: unicode.Hiragana, tags: []string{"kana"}},
+	{table: unicode.Katakana, tags: []string{"kana"}},
+	{table: unicode.Han, tags: []string{"hani"}},
+}
+
+// scriptOf returns the script of the rune, or nil for characters that are
+// common to several scripts, such as spaces, digits and punctuation, and
+// for combining marks, which take the script of their neighbours.
+func scriptOf(r rune) *otScript {
+	if r < 0x250 {
+		if unicode.IsLetter(r) {
+			return &otScripts[0]
+		}
+		return nil
+	}
+	for i := range otScripts {
+		if unicode.Is(otScripts[i].table, r) {
+			return &otScripts[i]
+		}
+	}
+	return nil
+}
+
+// scriptRun is a run of runes of the same script, and of the same face
+// once split by splitFaces.
+type scriptRun struct {
+	start, end int
+	script     *otScript
+	face       font.Face
+}
+
+// itemizeScripts splits the runes into runs of the same script.
+func itemizeScripts(runes []rune) []scriptRun {
+	scripts := make([]*otScript, len(runes))
+	for i, r := range runes {
+		scripts[i] = scriptOf(r)
+	}
+	// common characters take the script of the preceding character, or
+	// failing that of the following one
+	for i := 1; i < len(scripts); i++ {
+		if scripts[i] == nil {
+			scripts[i] = scripts[i-1]
+		}
+	}
+	for i := len(scripts) - 2; i >= 0; i-- {
+		if scripts[i] == nil {
+			scripts[i] = scripts[i+1]
+		}
+	}
+	var runs []scriptRun
+	for i := range scripts {
+		if i == 0 || scripts[i] != scripts[i-1] {
+			runs = append(runs, scriptRun{i, i, scripts[i], nil})
+		}
+		runs[len(runs)-1].end = i + 1
+	}
+	return runs
+}
+
+// lineLayout positions the runs of a line one after the other.
+type lineLayout struct {
+	runes  []rune
+	glyphs []textGlyph
+	x      fixed.Int26_6
+
+	// the face and the glyph or character placed last, for kerning
+	prevFace font.Face
+	prev     truetype.Index
+	prevRune rune
+}
+
+// placeRunes positions a glyph per character of the runes from start to
+// end, kerned as by font.Drawer.
+func (l *lineLayout) placeRunes(face font.Face, start, end int, rtl bool) {
+	for k := start; k < end; k++ {
+		i, c := k, l.runes[k]
+		if rtl {
+			i = start + end - 1 - k
+			c = bidiMirror(l.runes[i])
+		}
+		if l.prevFace == face {
+			l.x += face.Kern(l.prevRune, c)
+		}
+		advance, ok := face.GlyphAdvance(c)
+		if !ok {
+			continue
+		}
+		l.glyphs = append(l.glyphs, textGlyph{
+			face:    face,
+			r:       c,
+			text:    string(l.runes[i]),
+			dot:     fixed.Point26_6{X: l.x},
+			advance: advance,
+		})
+		l.x += advance
+		l.prevFace, l.prevRune = face, c
+	}
+}
+
+// place positions the glyphs of a run of the line that ends at the rune
+// end.
+func (l *lineLayout) place(f *trueTypeFace, glyphs []otGlyph, end int, rtl bool) {
+	// the legacy kerning table is used by fonts without kerning in GPOS
+	kern := !f.layout().gpos.hasFeature("kern")
+	n := len(glyphs)
+	order := make([]int, n)
+	for k := range order {
+		order[k] = k
+		if rtl {
+			order[k] = n - 1 - k
+		}
+	}
+	origins := make([]fixed.Point26_6, n)
+	advances := make([]fixed.Int26_6, n)
+	skip := make([]bool, n)
+	for _, i := range order {
+		g := &glyphs[i]
+		index := truetype.Index(g.id)
+		m := f.metrics(index)
+		if !m.ok {
+			skip[i] = true
+			continue
+		}
+		if kern && l.prevFace == f {
+			l.x += f.font.Kern(fix(f.points), l.prev, index)
+		}
+		// the advance is scaled like that of the face, adjusted by the
+		// positioning in font units
+		advance := m.advance
+		if g.xAdvance == 0 {
+			advance = 0
+		} else if g.xAdvance != m.units {
+			advance += f.units(g.xAdvance - m.units)
+		}
+		origins[i] = fixed.Point26_6{X: l.x + f.units(g.xOffset), Y: -f.units(g.yOffset)}
+		advances[i] = advance
+		l.x += advance
+		l.prev, l.prevFace = index, f
+	}
+
+	// attached marks and cursive glyphs are positioned relative to the
+	// glyph they are attached to
+	state := make([]uint8, n)
+	var resolve func(i int)
+	resolve = func(i int) {
+		if state[i] != 0 {
+			return
+		}
+		state[i] = 1
+		g := &glyphs[i]
+		if j := g.attach - 1; j >= 0 && j < n {
+			resolve(j)
+			origins[i] = origins[j].Add(fixed.Point26_6{X: f.units(g.attachX), Y: -f.units(g.attachY)})
+		} else if j := g.cursive - 1; j >= 0 && j < n {
+			resolve(j)
+			origins[i].Y = origins[j].Y - f.units(g.cursiveY)
+		}
+		state[i] = 2
+	}
+
+	// the ends of the clusters
+	var starts []int
+	for _, g := range glyphs {
+		starts = append(starts, g.cluster)
+	}
+	sort.Ints(starts)
+	clusterEnd := func(cluster int) int {
+		k := sort.SearchInts(starts, cluster+1)
+		if k < len(starts) {
+			return starts[k]
+		}
+		return end
+	}
+	seen := make(map[int]bool)
+	for _, i := range order {
+		if skip[i] {
+			continue
+		}
+		resolve(i)
+		g := glyphs[i]
+		var text string
+		if !seen[g.cluster] {
+			seen[g.cluster] = true
+			text = string(l.runes[g.cluster:clusterEnd(g.cluster)])
+		}
+		l.glyphs = append(l.glyphs, textGlyph{
+			face:    f,
+			r:       g.r,
+			index:   truetype.Index(g.id),
+			text:    text,
+			dot:     origins[i],
+			advance: advances[i],
+		})
+	}
+}
+
+// Feature masks. Every glyph has otGlobal; the others select the glyphs
+// that the joining forms of Arabic and the forms of the parts of Indic
+// syllables apply to.
+const (
+	otGlobal uint32 = 1 << iota
+	otIsol
+	otFina
+	otMedi
+	otInit
+	otRphf
+	otHalf
+	otPostBase
+)
+
+func globalFeatures(tags ...string) []otFeature {
+	features := make([]otFeature, len(tags))
+	for i, tag := range tags {
+		features[i] = otFeature{tag, otGlobal}
+	}
+	return features
+}
+
+// shape maps the runes, which are of the same script and direction and
+// start at the index start of the line, to glyphs and applies the OpenType
+// features of the script to them. The glyphs are returned in logical order.
+func (f *trueTypeFace) shape(runes []rune, start int, script *otScript, rtl bool) []otGlyph {
+	ot := f.layout()
+	glyphs := make([]otGlyph, len(runes))
+	for i, r := range runes {
+		if rtl {
+			r = bidiMirror(r)
+		}
+		glyphs[i] = otGlyph{r: r, cluster: start + i, mask: otGlobal}
+		// combining marks are in the cluster of their base
+		if i > 0 && (r == 0x200D || unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc)) {
+			glyphs[i].cluster = glyphs[i-1].cluster
+		}
+	}
+	shaper := shapeDefault
+	var tags []string
+	if script != nil {
+		shaper, tags = script.shaper, script.tags
+	}
+	switch shaper {
+	case shapeIndic:
+		glyphs = indicDecompose(glyphs)
+	case shapeThai:
+		glyphs = thaiDecompose(glyphs)
+	}
+	for i := range glyphs {
+		g := &glyphs[i]
+		g.id = uint16(f.font.Index(g.r))
+		g.class = uint8(ot.glyphClass(g.id))
+		if g.class == 0 {
+			g.class = otBase
+			if unicode.In(g.r, unicode.Mn, unicode.Me) {
+				g.class = otMark
+			}
+		}
+	}
+
+	candidates := append(append([]string(nil), tags...), "DFLT", "dflt", "latn")
+	gsub := &otApplier{font: ot, table: ot.gsub, glyphs: glyphs, rtl: rtl}
+	lang := ot.gsub.langSys(candidates)
+	stage := func(features ...otFeature) {
+		gsub.apply(lang, features)
+	}
+	switch shaper {
+	case shapeArabic:
+		arabicJoin(gsub.glyphs)
+		if ot.gsub.langSys(tags) == 0 {
+			gsub.glyphs = f.arabicFallback(gsub.glyphs)
+		}
+		stage(globalFeatures("ccmp", "locl")...)
+		stage(otFeature{"isol", otIsol})
+		stage(otFeature{"fina", otFina})
+		stage(otFeature{"medi", otMedi})
+		stage(otFeature{"init", otInit})
+		stage(globalFeatures("rlig")...)
+		stage(globalFeatures("calt", "liga", "clig", "mset")...)
+	case shapeIndic:
+		stage(globalFeatures("locl", "ccmp")...)
+		indicReorder(ot, lang, gsub.glyphs, script)
+		for _, feature := range []otFeature{
+			{"nukt", otGlobal}, {"akhn", otGlobal}, {"rphf", otRphf},
+			{"rkrf", otGlobal}, {"pref", otPostBase}, {"blwf", otPostBase},
+			{"abvf", otPostBase}, {"half", otHalf}, {"pstf", otPostBase},
+			{"vatu", otGlobal}, {"cjct", otGlobal},
+		} {
+			stage(feature)
+		}
+		f.indicFinalReorder(gsub.glyphs)
+		stage(globalFeatures("pres", "abvs", "blws", "psts", "haln", "rlig", "calt", "clig", "liga")...)
+	default:
+		stage(globalFeatures("ccmp", "locl", "rlig", "rclt", "calt", "liga", "clig")...)
+	}
+
+	glyphs = gsub.glyphs
+	for i := range glyphs {
+		g := &glyphs[i]
+		g.xAdvance = f.metrics(truetype.Index(g.id)).units
+		// marks that the font knows about take no room
+		if g.class == otMark && ot.glyphClasses != 0 {
+			g.xAdvance = 0
+		}
+	}
+	gpos := &otApplier{font: ot, table: ot.gpos, glyphs: glyphs, rtl: rtl}
+	gpos.apply(ot.gpos.langSys(candidates), globalFeatures("curs", "kern", "dist", "abvm", "blwm", "mark", "mkmk"))
+	return gpos.glyphs
+}
+
+// arabicJoining returns the joining type of the rune: R joins with the
+// character before it, D with both neighbours, C causes its neighbours to
+// join, T is transparent and U doesn't join.
+func arabicJoining(r rune) byte {
+	switch {
+	case r == 0x0640 || r == 0x07FA || r == 0x200D:
+		return 'C'
+	case r == 0x200C:
+		return 'U'
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 'T'
+	case r == 0x0621 || r == 0x0674:
+		return 'U'
+	case inRanges(r, arabicRightJoining):
+		return 'R'
+	case unicode.IsLetter(r) && unicode.In(r, unicode.Arabic, unicode.Syriac):
+		return 'D'
+	}
+	return 'U'
+}
+
+var arabicRightJoining = []runeRange{
+	{0x0622, 0x0625}, {0x0627, 0x0627}, {0x0629, 0x0629}, {0x062F, 0x0632},
+	{0x0648, 0x0648}, {0x0671, 0x0673}, {0x0675, 0x0677}, {0x0688, 0x0699},
+	{0x06C0, 0x06C0}, {0x06C3, 0x06CB}, {0x06CD, 0x06CD}, {0x06CF, 0x06CF},
+	{0x06D2, 0x06D3}, {0x06D5, 0x06D5}, {0x06EE, 0x06EF}, {0x0710, 0x0710},
+	{0x0715, 0x0719}, {0x071E, 0x071E}, {0x0728, 0x0728}, {0x072A, 0x072A},
+	{0x072C, 0x072C}, {0x072F, 0x072F}, {0x074D, 0x074D},
+}
+
+// arabicJoin sets the masks of the joining forms of the glyphs.
+func arabicJoin(glyphs []otGlyph) {
+	forms := make([]uint32, len(glyphs))
+	prev := -1
+	var prevType byte
+	for i := range glyphs {
+		t := arabicJoining(glyphs[i].r)
+		if t == 'T' {
+			continue
+		}
+		if prev >= 0 && (prevType == 'D' || prevType == 'C') && t != 'U' {
+			switch forms[prev] {
+			case otIsol:
+				forms[prev] = otInit
+			case otFina:
+				forms[prev] = otMedi
+			}
+			forms[i] = otFina
+		} else {
+			forms[i] = otIsol
+		}
+		prev, prevType = i, t
+	}
+	for i := range glyphs {
+		if t := arabicJoining(glyphs[i].r); t == 'R' || t == 'D' {
+			glyphs[i].mask |= forms[i]
+		}
+	}
+}
+
+// arabicForms maps Arabic letters to their isolated, final, initial and
+// medial presentation forms, for fonts that have the presentation forms
+// but no OpenType tables for Arabic.
+var arabicForms = map[rune][4]rune{
+	0x0621: {0xFE80}, 0x0622: {0xFE81, 0xFE82}, 0x0623: {0xFE83, 0xFE84},
+	0x0624: {0xFE85, 0xFE86}, 0x0625: {0xFE87, 0xFE88},
+	0x0626: {0xFE89, 0xFE8A, 0xFE8B, 0xFE8C}, 0x0627: {0xFE8D, 0xFE8E},
+	0x0628: {0xFE8F, 0xFE90, 0xFE91, 0xFE92}, 0x0629: {0xFE93, 0xFE94},
+	0x062A: {0xFE95, 0xFE96, 0xFE97, 0xFE98}, 0x062B: {0xFE99, 0xFE9A, 0xFE9B, 0xFE9C},
+	0x062C: {0xFE9D, 0xFE9E, 0xFE9F, 0xFEA0}, 0x062D: {0xFEA1, 0xFEA2, 0xFEA3, 0xFEA4},
+	0x062E: {0xFEA5, 0xFEA6, 0xFEA7, 0xFEA8}, 0x062F: {0xFEA9, 0xFEAA},
+	0x0630: {0xFEAB, 0xFEAC}, 0x0631: {0xFEAD, 0xFEAE}, 0x0632: {0xFEAF, 0xFEB0},
+	0x0633: {0xFEB1, 0xFEB2, 0xFEB3, 0xFEB4}, 0x0634: {0xFEB5, 0xFEB6, 0xFEB7, 0xFEB8},
+	0x0635: {0xFEB9, 0xFEBA, 0xFEBB, 0xFEBC}, 0x0636: {0xFEBD, 0xFEBE, 0xFEBF, 0xFEC0},
+	0x0637: {0xFEC1, 0xFEC2, 0xFEC3, 0xFEC4}, 0x0638: {0xFEC5, 0xFEC6, 0xFEC7, 0xFEC8},
+	0x0639: {0xFEC9, 0xFECA, 0xFECB, 0xFECC}, 0x063A: {0xFECD, 0xFECE, 0xFECF, 0xFED0},
+	0x0641: {0xFED1, 0xFED2, 0xFED3, 0xFED4}, 0x0642: {0xFED5, 0xFED6, 0xFED7, 0xFED8},
+	0x0643: {0xFED9, 0xFEDA, 0xFEDB, 0xFEDC}, 0x0644: {0xFEDD, 0xFEDE, 0xFEDF, 0xFEE0},
+	0x0645: {0xFEE1, 0xFEE2, 0xFEE3, 0xFEE4}, 0x0646: {0xFEE5, 0xFEE6, 0xFEE7, 0xFEE8},
+	0x0647: {0xFEE9, 0xFEEA, 0xFEEB, 0xFEEC}, 0x0648: {0xFEED, 0xFEEE},
+	0x0649: {0xFEEF, 0xFEF0}, 0x064A: {0xFEF1, 0xFEF2, 0xFEF3, 0xFEF4},
+	0x0679: {0xFB66, 0xFB67, 0xFB68, 0xFB69}, 0x067E: {0xFB56, 0xFB57, 0xFB58, 0xFB59},
+	0x0686: {0xFB7A, 0xFB7B, 0xFB7C, 0xFB7D}, 0x0688: {0xFB88, 0xFB89},
+	0x0691: {0xFB8C, 0xFB8D}, 0x0698: {0xFB8A, 0xFB8B},
+	0x06A9: {0xFB8E, 0xFB8F, 0xFB90, 0xFB91}, 0x06AF: {0xFB92, 0xFB93, 0xFB94, 0xFB95},
+	0x06BA: {0xFB9E, 0xFB9F}, 0x06BE: {0xFBAA, 0xFBAB, 0xFBAC, 0xFBAD},
+	0x06C1: {0xFBA6, 0xFBA7, 0xFBA8, 0xFBA9}, 0x06CC: {0xFBFC, 0xFBFD, 0xFBFE, 0xFBFF},
+	0x06D2: {0xFBAE, 0xFBAF},
+}
+
+// arabicLamAlef maps the alefs to the isolated form of their ligature with
+// lam. The final form follows it.
+var arabicLamAlef = map[rune]rune{
+	0x0622: 0xFEF5, 0x0623: 0xFEF7, 0x0625: 0xFEF9, 0x0627: 0xFEFB,
+}
+
+// arabicFallback substitutes the presentation forms of the joining forms
+// and of the lam alef ligatures, where the font has them.
+func (f *trueTypeFace) arabicFallback(glyphs []otGlyph) []otGlyph {
+	for i := range glyphs {
+		g := &glyphs[i]
+		forms, ok := arabicForms[g.r]
+		if !ok {
+			continue
+		}
+		var form rune
+		switch {
+		case g.mask&otIsol != 0:
+			form = forms[0]
+		case g.mask&otFina != 0:
+			form = forms[1]
+		case g.mask&otInit != 0:
+			form = forms[2]
+		case g.mask&otMedi != 0:
+			form = forms[3]
+		}
+		if index := f.font.Index(form); form != 0 && index != 0 {
+			g.id = uint16(index)
+		}
+	}
+	for i := 0; i < len(glyphs); i++ {
+		if glyphs[i].r != 0x0644 {
+			continue
+		}
+		j := i + 1
+		for j < len(glyphs) && arabicJoining(glyphs[j].r) == 'T' {
+			j++
+		}
+		if j == len(glyphs) || glyphs[j].mask&otFina == 0 {
+			continue
+		}
+		lig, ok := arabicLamAlef[glyphs[j].r]
+		if !ok {
+			continue
+		}
+		if glyphs[i].mask&otMedi != 0 {
+			lig++
+		}
+		index := f.font.Index(lig)
+		if index == 0 {
+			continue
+		}
+		glyphs[i].id = uint16(index)
+		for k := i + 1; k <= j; k++ {
+			glyphs[k].cluster = glyphs[i].cluster
+		}
+		glyphs = append(glyphs[:j], glyphs[j+1:]...)
+	}
+	return glyphs
+}
+
+// Categories of the characters of the Indic scripts.
+const (
+	indicOther = iota
+	indicConsonant
+	indicVowel
+	indicNukta
+	indicVirama
+	indicMatra
+	indicModifier
+	indicJoiner
+)
+
+// indicCategory returns the category of the character. The Indic blocks
+// share their layout, so the category follows from the offset of the
+// character in its block.
+func indicCategory(r rune) int {
+	switch {
+	case r == 0x200C || r == 0x200D:
+		return indicJoiner
+	case r == 0x09CE:
+		return indicConsonant
+	case r == 0x0A70 || r == 0x0A71:
+		return indicModifier
+	case r < 0x0900 || r >= 0x0D80:
+		return indicOther
+	}
+	switch o := r & 0x7F; {
+	case o >= 0x01 && o <= 0x03:
+		return indicModifier
+	case o >= 0x04 && o <= 0x14, o == 0x60, o == 0x61:
+		return indicVowel
+	case o >= 0x15 && o <= 0x39, o >= 0x58 && o <= 0x5F:
+		return indicConsonant
+	case o == 0x3C:
+		return indicNukta
+	case o == 0x4D:
+		return indicVirama
+	case o >= 0x3E && o <= 0x4C, o == 0x4E, o == 0x4F, o >= 0x55 && o <= 0x57, o == 0x62, o == 0x63:
+		return indicMatra
+	}
+	return indicOther
+}
+
+// indicPreBase has the matras that are written before the consonants they
+// follow.
+var indicPreBase = map[rune]bool{
+	0x093F: true, 0x094E: true, 0x09BF: true, 0x09C7: true, 0x09C8: true,
+	0x0A3F: true, 0x0ABF: true, 0x0B47: true, 0x0BC6: true, 0x0BC7: true,
+	0x0BC8: true, 0x0D46: true, 0x0D47: true, 0x0D48: true,
+}
+
+// indicSplitMatras maps the matras that are written on both sides of the
+// consonant to their parts.
+var indicSplitMatras = map[rune][2]rune{
+	0x09CB: {0x09C7, 0x09BE}, 0x09CC: {0x09C7, 0x09D7},
+	0x0B48: {0x0B47, 0x0B56}, 0x0B4B: {0x0B47, 0x0B3E}, 0x0B4C: {0x0B47, 0x0B57},
+	0x0BCA: {0x0BC6, 0x0BBE}, 0x0BCB: {0x0BC7, 0x0BBE}, 0x0BCC: {0x0BC6, 0x0BD7},
+	0x0D4A: {0x0D46, 0x0D3E}, 0x0D4B: {0x0D47, 0x0D3E}, 0x0D4C: {0x0D46, 0x0D57},
+}
+
+// indicDecompose splits the split matras into their parts.
+func indicDecompose(glyphs []otGlyph) []otGlyph {
+	result := make([]otGlyph, 0, len(glyphs))
+	for _, g := range glyphs {
+		parts, ok := indicSplitMatras[g.r]
+		if !ok {
+			result = append(result, g)
+			continue
+		}
+		for _, r := range parts {
+			g.r = r
+			result = append(result, g)
+		}
+	}
+	return result
+}
+
+// indicSyllableEnd returns the end of the syllable that starts at start.
+func indicSyllableEnd(glyphs []otGlyph, start int) int {
+	category := func(i int) int {
+		if i < len(glyphs) {
+			return indicCategory(glyphs[i].r)
+		}
+		return -1
+	}
+	i := start
+	switch category(i) {
+	case indicConsonant:
+		// consonants joined by viramas
+		for i++; ; i++ {
+			if category(i) == indicNukta {
+				i++
+			}
+			if category(i) != indicVirama {
+				break
+			}
+			j := i + 1
+			if category(j) == indicJoiner {
+				j++
+			}
+			if category(j) != indicConsonant {
+				// the syllable ends with a dead consonant
+				i = j
+				for category(i) == indicModifier {
+					i++
+				}
+				return i
+			}
+			i = j
+		}
+	case indicVowel:
+		i++
+		if category(i) == indicNukta {
+			i++
+		}
+	default:
+		return i + 1
+	}
+	for category(i) == indicMatra || category(i) == indicNukta {
+		i++
+	}
+	for category(i) == indicModifier {
+		i++
+	}
+	return i
+}
+
+// indicReorder finds the syllables and, in the syllables that start with a
+// consonant, their base consonant. It sets the masks of the forms of the
+// consonants before and after the base, and of the reph, and moves the
+// pre-base matras to the start of the syllable.
+func indicReorder(ot *otFont, lang int, glyphs []otGlyph, script *otScript) {
+	var syllable uint16
+	for start := 0; start < len(glyphs); {
+		end := indicSyllableEnd(glyphs, start)
+		syllable++
+		for i := start; i < end; i++ {
+			glyphs[i].syllable = syllable
+			glyphs[i].cluster = glyphs[start].cluster
+		}
+		if indicCategory(glyphs[start].r) == indicConsonant {
+			indicReorderSyllable(ot, lang, glyphs[start:end], script)
+		}
+		start = end
+	}
+}
+
+func indicReorderSyllable(ot *otFont, lang int, s []otGlyph, script *otScript) {
+	limit := 0
+	if script.reph && len(s) >= 3 && s[0].r == script.block+0x30 &&
+		indicCategory(s[1].r) == indicVirama && indicCategory(s[2].r) == indicConsonant &&
+		ot.wouldSubstitute(lang, "rphf", s[0].id, s[1].id) {
+		s[0].mask |= otRphf
+		s[1].mask |= otRphf
+		limit = 2
+	}
+	// the base is the last consonant, unless it has a below-base or a
+	// post-base form
+	base := -1
+	for j := len(s) - 1; j >= limit; j-- {
+		if indicCategory(s[j].r) != indicConsonant {
+			continue
+		}
+		base = j
+		if h := j - 1; h > limit && indicCategory(s[h].r) == indicVirama && indicHasPostForm(ot, lang, s[h].id, s[j].id) {
+			continue
+		}
+		break
+	}
+	if base < 0 {
+		return
+	}
+	for j := limit; j < len(s); j++ {
+		if j < base {
+			s[j].mask |= otHalf
+		} else if j > base {
+			s[j].mask |= otPostBase
+		}
+	}
+	for j := base + 1; j < len(s); j++ {
+		if indicPreBase[s[j].r] {
+			m := s[j]
+			m.mask = otGlobal
+			copy(s[limit+1:j+1], s[limit:j])
+			s[limit] = m
+		}
+	}
+}
+
+// indicHasPostForm reports whether the consonant following a virama has a
+// below-base or post-base form.
+func indicHasPostForm(ot *otFont, lang int, virama, consonant uint16) bool {
+	for _, feature := range []string{"blwf", "pstf", "pref"} {
+		if ot.wouldSubstitute(lang, feature, virama, consonant) || ot.wouldSubstitute(lang, feature, consonant, virama) {
+			return true
+		}
+	}
+	return false
+}
+
+// indicFinalReorder moves the rephs that were formed to the end of their
+// syllables, before the syllable modifiers.
+func (f *trueTypeFace) indicFinalReorder(glyphs []otGlyph) {
+	for start := 0; start < len(glyphs); {
+		end := start + 1
+		for end < len(glyphs) && glyphs[end].syllable == glyphs[start].syllable {
+			end++
+		}
+		g := glyphs[start]
+		if g.mask&otRphf != 0 && g.id != uint16(f.font.Index(g.r)) {
+			to := end
+			for to > start+1 && indicCategory(glyphs[to-1].r) == indicModifier {
+				to--
+			}
+			copy(glyphs[start:to-1], glyphs[start+1:to])
+			glyphs[to-1] = g
+		}
+		start = end
+	}
+}
+
+// isThaiAboveMark reports whether the character is a vowel or tone mark
+// written above the consonant in Thai or Lao.
+func isThaiAboveMark(r rune) bool {
+	switch {
+	case r == 0x0E31 || r >= 0x0E34 && r <= 0x0E37 || r >= 0x0E47 && r <= 0x0E4E:
+		return true
+	case r == 0x0EB1 || r >= 0x0EB4 && r <= 0x0EB7 || r == 0x0EBB || r >= 0x0EC8 && r <= 0x0ECD:
+		return true
+	}
+	return false
+}
+
+// thaiDecompose splits the sara am of Thai and Lao into the nikhahit, which
+// goes before the marks above the consonant, and the sara aa.
+func thaiDecompose(glyphs []otGlyph) []otGlyph {
+	result := make([]otGlyph, 0, len(glyphs)+1)
+	for _, g := range glyphs {
+		var nikhahit, aa rune
+		switch g.r {
+		case 0x0E33:
+			nikhahit, aa = 0x0E4D, 0x0E32
+		case 0x0EB3:
+			nikhahit, aa = 0x0ECD, 0x0EB2
+		default:
+			result = append(result, g)
+			continue
+		}
+		n, a := g, g
+		n.r, a.r = nikhahit, aa
+		j := len(result)
+		for j > 0 && isThaiAboveMark(result[j-1].r) {
+			j--
+		}
+		if j < len(result) {
+			// the marks move into one cluster with their consonant
+			k := j
+			if k > 0 {
+				k--
+			}
+			cluster := result[k].cluster
+			for ; k < len(result); k++ {
+				result[k].cluster = cluster
+			}
+			n.cluster, a.cluster = cluster, cluster
+		}
+		result = append(result, otGlyph{})
+		copy(result[j+1:], result[j:])
+		result[j] = n
+		result = append(result, a)
+	}
+	return result
+}
+
+// glyphMetrics are the advance of a glyph at the size of the face and in
+// font units.
+type glyphMetrics struct {
+	advance fixed.Int26_6
+	units   int
+	ok      bool
+}
+
+// glyphMaskKey identifies a glyph drawn at a fractional pixel position.
+type glyphMaskKey struct {
+	index  truetype.Index
+	fx, fy fixed.Int26_6
+}
+
+// glyphMask is a rendered glyph and the offset of its top left corner from
+// the dot.
+type glyphMask struct {
+	mask   *image.Alpha
+	offset image.Point
+}
+
+// layout returns the OpenType layout tables of the font.
+func (f *trueTypeFace) layout() *otFont {
+	if f.ot == nil {
+		f.ot = parseOTFont(f.data)
+	}
+	return f.ot
+}
+
+// validGlyph reports whether the index is in the font. Loading a glyph past
+// the end of the font panics in the truetype package.
+func (f *trueTypeFace) validGlyph(index truetype.Index) bool {
+	return f.layout().validGlyph(int(index))
+}
+
+// units converts a distance in font units to the size of the face.
+func (f *trueTypeFace) units(x int) fixed.Int26_6 {
+	return fixed.Int26_6(math.Round(float64(x) * float64(fix(f.points)) / float64(f.font.FUnitsPerEm())))
+}
+
+// metrics returns the advance of the glyph, which is that of the face for
+// the glyph.
+func (f *trueTypeFace) metrics(index truetype.Index) glyphMetrics {
+	if m, ok := f.glyphMetrics[index]; ok {
+		return m
+	}
+	if f.glyphMetrics == nil {
+		f.glyphMetrics = make(map[truetype.Index]glyphMetrics)
+	}
+	var m glyphMetrics
+	if !f.validGlyph(index) {
+		return m
+	}
+	if err := f.glyph.Load(f.font, fix(f.points), index, font.HintingNone); err == nil {
+		m.advance = f.glyph.AdvanceWidth
+		m.units = int(f.font.HMetric(fixed.Int26_6(f.font.FUnitsPerEm()), index).AdvanceWidth)
+		m.ok = true
+	}
+	f.glyphMetrics[index] = m
+	return m
+}
+
+// glyphMask returns the mask of the glyph drawn at dot, and where to draw
+// it. It renders glyphs by index exactly like the Glyph method of the face
+// renders them by rune.
+func (f *trueTypeFace) glyphMask(dot fixed.Point26_6, index truetype.Index) (image.Rectangle, image.Image, bool) {
+	// quantize to a quarter of a pixel horizontally and to whole pixels
+	// vertically, like the face
+	dotX := (dot.X + 8) & -16
+	dotY := (dot.Y + 32) & -64
+	ix, fx := int(dotX>>6), dotX&0x3f
+	iy, fy := int(dotY>>6), dotY&0x3f
+	key := glyphMaskKey{index, fx, fy}
+	m, ok := f.glyphMasks[key]
+	if !ok {
+		m = f.rasterize(index, fx, fy)
+		if f.glyphMasks == nil || len(f.glyphMasks) >= 512 {
+			f.glyphMasks = make(map[glyphMaskKey]glyphMask)
+		}
+		f.glyphMasks[key] = m
+	}
+	if m.mask == nil {
+		return image.Rectangle{}, nil, false
+	}
+	return m.mask.Bounds().Add(m.offset).Add(image.Pt(ix, iy)), m.mask, true
+}
+
+// rasterize renders the glyph with the fractional offset fx, fy, based on
+// the rasterize method of the face in the truetype package.
+func (f *trueTypeFace) rasterize(index truetype.Index, fx, fy fixed.Int26_6) glyphMask {
+	g := &f.glyph
+	if !f.validGlyph(index) {
+		return glyphMask{}
+	}
+	if err := g.Load(f.font, fix(f.points), index, font.HintingNone); err != nil {
+		return glyphMask{}
+	}
+	xmin := int(fx+g.Bounds.Min.X) >> 6
+	ymin := int(fy-g.Bounds.Max.Y) >> 6
+	xmax := int(fx+g.Bounds.Max.X+0x3f) >> 6
+	ymax := int(fy-g.Bounds.Min.Y+0x3f) >> 6
+	if xmin > xmax || ymin > ymax {
+		return glyphMask{}
+	}
+	fx -= fixed.Int26_6(xmin << 6)
+	fy -= fixed.Int26_6(ymin << 6)
+	if f.raster == nil {
+		// big enough for the largest glyph, like the face
+		b := f.font.Bounds(fix(f.points))
+		x0, y0 := int(b.Min.X)>>6, -int(b.Max.Y)>>6
+		x1, y1 := int(b.Max.X+63)>>6, -int(b.Min.Y-63)>>6
+		f.raster = raster.NewRasterizer(x1-x0, y1-y0)
+		f.canvas = image.NewAlpha(image.Rect(0, 0, x1-x0, y1-y0))
+	}
+	f.raster.Clear()
+	for i := range f.canvas.Pix {
+		f.canvas.Pix[i] = 0
+	}
+	e0 := 0
+	for _, e1 := range g.Ends {
+		f.drawContour(g.Points[e0:e1], fx, fy)
+		e0 = e1
+	}
+	f.raster.Rasterize(raster.NewAlphaSrcPainter(f.canvas))
+	mask := image.NewAlpha(image.Rect(0, 0, xmax-xmin, ymax-ymin))
+	for y := 0; y < mask.Rect.Dy() && y < f.canvas.Rect.Dy(); y++ {
+		copy(mask.Pix[y*mask.Stride:(y+1)*mask.Stride], f.canvas.Pix[y*f.canvas.Stride:(y+1)*f.canvas.Stride])
+	}
+	return glyphMask{mask, image.Pt(xmin, ymin)}
+}
+
+// drawContour adds a contour of the glyph to the rasterizer, with the
+// implied points between consecutive control points, offset by dx, dy.
+func (f *trueTypeFace) drawContour(ps []truetype.Point, dx, dy fixed.Int26_6) {
+	if len(ps) == 0 {
+		return
+	}
+	point := func(p truetype.Point) fixed.Point26_6 {
+		return fixed.Point26_6{X: dx + p.X, Y: dy - p.Y}
+	}
+	start := point(ps[0])
+	var others []truetype.Point
+	if ps[0].Flags&0x01 != 0 {
+		others = ps[1:]
+	} else {
+		last := point(ps[len(ps)-1])
+		if ps[len(ps)-1].Flags&0x01 != 0 {
+			start = last
+			others = ps[:len(ps)-1]
+		} else {
+			start = fixed.Point26_6{X: (start.X + last.X) / 2, Y: (start.Y + last.Y) / 2}
+			others = ps
+		}
+	}
+	f.raster.Start(start)
+	q0, on0 := start, true
+	for _, p := range others {
+		q := point(p)
+		on := p.Flags&0x01 != 0
+		if on {
+			if on0 {
+				f.raster.Add1(q)
+			} else {
+				f.raster.Add2(q0, q)
+			}
+		} else if !on0 {
+			mid := fixed.Point26_6{X: (q0.X + q.X) / 2, Y: (q0.Y + q.Y) / 2}
+			f.raster.Add2(q0, mid)
+		}
+		q0, on0 = q, on
+	}
+	if on0 {
+		f.raster.Add1(start)
+	} else {
+		f.raster.Add2(q0, start)
+	}
+}
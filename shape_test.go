@@ -0,0 +1,371 @@
+package gg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/math/fixed"
+)
+
+// visual returns the runes of the text in the visual order of its bidi
+// runs, with the runes of right to left runs mirrored.
+func visual(s string) string {
+	runes := []rune(s)
+	var result []rune
+	for _, run := range bidiRuns(runes) {
+		for k := run.start; k < run.end; k++ {
+			if run.rtl() {
+				result = append(result, bidiMirror(runes[run.start+run.end-1-k]))
+			} else {
+				result = append(result, runes[k])
+			}
+		}
+	}
+	return string(result)
+}
+
+func TestBidiRuns(t *testing.T) {
+	tests := []struct{ logical, visual string }{
+		{"hello, world", "hello, world"},
+		{"abc אבג def", "abc גבא def"},
+		{"אבג abc דהו", "והד abc גבא"},
+		{"אבג 123 דהו", "והד 123 גבא"},
+		{"אבג (abc)!", "!(abc) גבא"},
+		{"abc (אבג) def", "abc (גבא) def"},
+		{"مرحبا 2024", "2024 ابحرم"},
+		{"a ⁧אב⁩ c", "a ⁧בא⁩ c"},
+	}
+	for _, test := range tests {
+		if got := visual(test.logical); got != test.visual {
+			t.Errorf("%q: expected %q, got %q", test.logical, test.visual, got)
+		}
+	}
+}
+
+func TestLayoutTextBidi(t *testing.T) {
+	dc := NewContext(100, 100)
+	glyphs, width := dc.layoutText("ab (cd)")
+	var text string
+	for _, g := range glyphs {
+		text += g.text
+	}
+	if text != "ab (cd)" || width != glyphs[len(glyphs)-1].dot.X+glyphs[len(glyphs)-1].advance {
+		t.Errorf("unexpected layout of left to right text: %q, %v", text, width)
+	}
+	w, _ := dc.MeasureString("ab (cd)")
+	if w != 7*7 {
+		t.Errorf("expected a width of 49, got %v", w)
+	}
+}
+
+// layoutFont returns the bytes of goregular with the tables added.
+func layoutFont(tables map[string][]byte) []byte {
+	font := goregular.TTF
+	n := int(binary.BigEndian.Uint16(font[4:]))
+	count := n + len(tables)
+	dir := append([]byte(nil), font[:12]...)
+	binary.BigEndian.PutUint16(dir[4:], uint16(count))
+	var data []byte
+	offset := 12 + 16*count
+	add := func(tag string, table []byte) {
+		rec := make([]byte, 16)
+		copy(rec, tag)
+		binary.BigEndian.PutUint32(rec[8:], uint32(offset+len(data)))
+		binary.BigEndian.PutUint32(rec[12:], uint32(len(table)))
+		dir = append(dir, rec...)
+		data = append(data, table...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+	for i := 0; i < n; i++ {
+		rec := font[12+16*i:]
+		off, length := binary.BigEndian.Uint32(rec[8:]), binary.BigEndian.Uint32(rec[12:])
+		add(string(rec[:4]), font[off:off+length])
+	}
+	for _, tag := range []string{"GDEF", "GPOS", "GSUB"} {
+		if table, ok := tables[tag]; ok {
+			add(tag, table)
+		}
+	}
+	return append(dir, data...)
+}
+
+func u16s(values ...int) []byte {
+	b := make([]byte, 2*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint16(b[2*i:], uint16(v))
+	}
+	return b
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// layoutTable returns a GSUB or GPOS table with the features for the
+// script, each with one lookup.
+func layoutTable(script string, features []string, lookups [][]byte) []byte {
+	n := len(features)
+	indexes := make([]int, n)
+	for i := range indexes {
+		indexes[i] = i
+	}
+	scripts := concat(u16s(1), []byte(script), u16s(8), u16s(4, 0), u16s(0, 0xFFFF, n), u16s(indexes...))
+	featureList := u16s(n)
+	for i, tag := range features {
+		featureList = concat(featureList, []byte(tag), u16s(2+6*n+6*i))
+	}
+	for i := range features {
+		featureList = concat(featureList, u16s(0, 1, i))
+	}
+	lookupList := u16s(n)
+	offset := 2 + 2*n
+	for _, lookup := range lookups {
+		lookupList = concat(lookupList, u16s(offset))
+		offset += len(lookup)
+	}
+	lookupList = concat(append(lookupList, concat(lookups...)...))
+	header := concat(u16s(1, 0, 10, 10+len(scripts), 10+len(scripts)+len(featureList)))
+	return concat(header, scripts, featureList, lookupList)
+}
+
+func lookup(kind, flag int, subtable []byte) []byte {
+	return concat(u16s(kind, flag, 1, 8), subtable)
+}
+
+func TestShapeSubstitution(t *testing.T) {
+	f, _ := truetype.Parse(goregular.TTF)
+	fi, z := int(f.Index('f')), int(f.Index('i'))
+	lig := int(f.Index('Z'))
+	x, y := int(f.Index('x')), int(f.Index('y'))
+	// f i -> Z, and x -> y in a chaining context after a y
+	liga := concat(u16s(1, 18, 1, 8), u16s(1, 4), u16s(lig, 2, z), u16s(1, 1, fi))
+	single := lookup(1, 0, concat(u16s(1, 6, y-x), u16s(1, 1, x)))
+	calt := concat(u16s(3, 1, 18, 1, 24, 0, 1, 0, 2), u16s(1, 1, y), u16s(1, 1, x))
+	gsub := layoutTable("latn", []string{"liga", "calt", "ss01"}, [][]byte{
+		lookup(4, 0, liga), lookup(6, 0, calt), single,
+	})
+	face, err := ParseFontFace(layoutFont(map[string][]byte{"GSUB": gsub}), 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc := NewContext(100, 100)
+	dc.SetFontFace(face)
+	glyphs, width := dc.layoutText("fix yx")
+	var indexes []int
+	var text []string
+	for _, g := range glyphs {
+		indexes = append(indexes, int(g.index))
+		text = append(text, g.text)
+	}
+	expected := []int{lig, x, int(f.Index(' ')), y, y}
+	if len(indexes) != len(expected) {
+		t.Fatalf("expected glyphs %v, got %v", expected, indexes)
+	}
+	for i := range expected {
+		if indexes[i] != expected[i] {
+			t.Fatalf("expected glyphs %v, got %v", expected, indexes)
+		}
+	}
+	if text[0] != "fi" || text[1] != "x" {
+		t.Errorf("expected the ligature to have the text of both characters, got %q", text)
+	}
+	plain := NewContext(100, 100)
+	plain.SetFontFace(face)
+	zx, _ := plain.layoutText("Zx yy")
+	if width != zx[len(zx)-1].dot.X+zx[len(zx)-1].advance {
+		t.Error("expected the ligature to have the advance of its glyph")
+	}
+}
+
+func TestShapeMalformedLookups(t *testing.T) {
+	f, _ := truetype.Parse(goregular.TTF)
+	x := int(f.Index('x'))
+	// a contextual lookup whose nested lookup is itself
+	self := lookup(5, 0, concat(u16s(3, 1, 1, 12, 0, 0), u16s(1, 1, x)))
+	// and one that also replaces the glyph with a thousand copies of it
+	xs := make([]int, 1000)
+	for i := range xs {
+		xs[i] = x
+	}
+	multiple := lookup(2, 0, concat(u16s(1, 8+2+2*len(xs), 1, 8), u16s(len(xs)), u16s(xs...), u16s(1, 1, x)))
+	grow := lookup(5, 0, concat(u16s(3, 1, 2, 16, 0, 1, 0, 0), u16s(1, 1, x)))
+	// a single substitution to a glyph past the end of the font
+	past := lookup(1, 0, concat(u16s(2, 8, 1, 0xfffe), u16s(1, 1, x)))
+	tests := map[string][]byte{
+		"self":   layoutTable("latn", []string{"calt"}, [][]byte{self}),
+		"growth": layoutTable("latn", []string{"calt", "ss20"}, [][]byte{grow, multiple}),
+		"past":   layoutTable("latn", []string{"calt"}, [][]byte{past}),
+	}
+	for name, gsub := range tests {
+		face, err := ParseFontFace(layoutFont(map[string][]byte{"GSUB": gsub}), 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dc := NewContext(100, 100)
+		dc.SetFontFace(face)
+		glyphs, _ := dc.layoutText("x")
+		if len(glyphs) == 0 || len(glyphs) > otMinLimit {
+			t.Errorf("%s: expected at most %d glyphs, got %d", name, otMinLimit, len(glyphs))
+		}
+		dc.MeasureString("x")
+		dc.DrawString("x", 10, 50)
+		dc.TextPath("x", 10, 50)
+		dc.WordWrap("x x", 50)
+	}
+	face, _ := ParseFontFace(goregular.TTF, 32)
+	ttf := face.(*trueTypeFace)
+	if ttf.metrics(0xfffe).ok || !ttf.metrics(truetype.Index(x)).ok {
+		t.Error("expected glyphs past the end of the font to be missing")
+	}
+}
+
+func TestShapePositioning(t *testing.T) {
+	f, _ := truetype.Parse(goregular.TTF)
+	a, v := int(f.Index('A')), int(f.Index('V'))
+	e, acute := int(f.Index('e')), int(f.Index('\u00b4'))
+	// kern A V by -200 units and attach the acute accent, a mark in GDEF,
+	// over the e
+	kern := concat(u16s(1, 18, 4, 0, 1, 12), u16s(1, v, -200), u16s(1, 1, a))
+	mark := concat(u16s(1, 34, 40, 1, 12, 24), u16s(1, 0, 6), u16s(1, 100, 0),
+		u16s(1, 4), u16s(1, 500, 1000), u16s(1, 1, acute), u16s(1, 1, e))
+	gpos := layoutTable("latn", []string{"kern", "mark"}, [][]byte{
+		lookup(2, 0, kern), lookup(4, 0, mark),
+	})
+	gdef := concat(u16s(1, 0, 12, 0, 0, 0), u16s(2, 1, acute, acute, otMark))
+	// 32 points for 2048 units per em make a font unit 1/64 of a pixel,
+	// the unit of fixed.Int26_6
+	face, err := ParseFontFace(layoutFont(map[string][]byte{"GPOS": gpos, "GDEF": gdef}), 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc := NewContext(100, 100)
+	dc.SetFontFace(face)
+	glyphs, _ := dc.layoutText("AVe\u00b4")
+	if len(glyphs) != 4 {
+		t.Fatalf("expected 4 glyphs, got %d", len(glyphs))
+	}
+	ttf := face.(*trueTypeFace)
+	if got, want := glyphs[1].dot.X, ttf.metrics(truetype.Index(a)).advance-200; got != want {
+		t.Errorf("expected V at %v, got %v", want, got)
+	}
+	if glyphs[3].advance != 0 {
+		t.Errorf("expected the mark to take no room, got %v", glyphs[3].advance)
+	}
+	if d := glyphs[3].dot.Sub(glyphs[2].dot); d.X != 400 || d.Y != -1000 {
+		t.Errorf("expected the mark at 400, -1000 from the e, got %v", d)
+	}
+
+	// combining marks are in the cluster of their base
+	glyphs, _ = dc.layoutText("e\u0301")
+	if len(glyphs) != 2 || glyphs[0].text != "e\u0301" || glyphs[1].text != "" {
+		t.Error("expected the e and its combining mark in one cluster")
+	}
+}
+
+func TestArabicJoining(t *testing.T) {
+	// beh, yeh, teh, space, alef, lam, tatweel, lam
+	runes := []rune("بيت الـل")
+	glyphs := make([]otGlyph, len(runes))
+	for i, r := range runes {
+		glyphs[i].r = r
+	}
+	arabicJoin(glyphs)
+	expected := []uint32{otInit, otMedi, otFina, 0, otIsol, otInit, 0, otFina}
+	for i, g := range glyphs {
+		if g.mask != expected[i] {
+			t.Errorf("%U: expected form %d, got %d", runes[i], expected[i], g.mask)
+		}
+	}
+}
+
+func TestIndicReorder(t *testing.T) {
+	script := scriptOf('क')
+	// ki, kti: the i matra goes before the consonants
+	runes := []rune("कि क्ति")
+	glyphs := make([]otGlyph, len(runes))
+	for i, r := range runes {
+		glyphs[i] = otGlyph{r: r, cluster: i}
+	}
+	indicReorder(&otFont{}, 0, glyphs, script)
+	var result []rune
+	for _, g := range glyphs {
+		result = append(result, g.r)
+	}
+	if string(result) != "िक िक्त" {
+		t.Errorf("unexpected order %q", string(result))
+	}
+	if glyphs[0].cluster != 0 || glyphs[3].cluster != 3 || glyphs[6].cluster != 3 {
+		t.Error("expected each syllable to be one cluster")
+	}
+}
+
+func TestFontFallbacks(t *testing.T) {
+	fallback, err := ParseFontFace(goregular.TTF, 13)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc := NewContext(100, 100)
+	// the default bitmap face has no Greek
+	if w, _ := dc.MeasureString("aΩb"); w != 14 {
+		t.Errorf("expected the omega to be left out, got a width of %v", w)
+	}
+	dc.SetFontFallbacks(fallback)
+	glyphs, width := dc.layoutText("aΩb")
+	if len(glyphs) != 3 || glyphs[0].face != dc.fontFace || glyphs[1].face != fallback || glyphs[2].face != dc.fontFace {
+		t.Fatal("expected the omega to be drawn with the fallback")
+	}
+	omega, _ := fallback.GlyphAdvance('Ω')
+	if glyphs[2].dot.X != fixed.I(7)+omega || width != fixed.I(14)+omega {
+		t.Errorf("unexpected positions %v, %v", glyphs[2].dot.X, width)
+	}
+	if glyphs[1].dot.Y != 0 {
+		t.Error("expected the faces to share the baseline")
+	}
+
+	// clusters joined by a zero width joiner take the first face that has
+	// all of their glyphs
+	faces := dc.runeFaces([]rune("a‍Ω a"))
+	if faces[0] != fallback || faces[1] != fallback || faces[2] != fallback || faces[4] != dc.fontFace {
+		t.Error("expected the cluster to be drawn with the fallback")
+	}
+	// lines are as tall as the tallest face that they use
+	tall, _ := ParseFontFace(goregular.TTF, 26)
+	dc.SetFontFallbacks(tall)
+	m := tall.Metrics()
+	expected := 13 * float64(m.Ascent+m.Descent) / float64(fixed.I(13))
+	if _, h := dc.MeasureString("a"); h != 13 {
+		t.Errorf("expected the height of the current face, got %v", h)
+	}
+	if _, h := dc.MeasureString("aΩ"); h != expected {
+		t.Errorf("expected the height of the fallback, %v, got %v", expected, h)
+	}
+	if _, h := dc.MeasureMultilineString("a\nΩ", 1); h != 13+expected {
+		t.Errorf("expected the lines to add up to %v, got %v", 13+expected, h)
+	}
+
+	// SVG output lists the fallbacks in the font family
+	svg := NewSVGContext(100, 100)
+	svg.SetFontFallbacks(fallback, tall, basicfont.Face7x13)
+	svg.DrawString("aΩb", 10, 50)
+	var buf bytes.Buffer
+	svg.EncodeSVG(&buf)
+	if s := buf.String(); !strings.Contains(s, `font-family="monospace, &#39;Go&#39;"`) {
+		t.Errorf("expected quoted font families without duplicates, got %s", s)
+	}
+
+	dc.SetFontFallbacks()
+	if w, _ := dc.MeasureString("aΩb"); w != 14 {
+		t.Errorf("expected no fallbacks, got a width of %v", w)
+	}
+}
@@ -0,0 +1,58 @@
+package gg
+
+import (
+	"math"
+
+	"github.com/golang/freetype/raster"
+)
+
+// StrokeToPath replaces the current path with the outline of the area that
+// Stroke would paint, given the current line width, line cap, line join and
+// dash settings. The outline overlaps itself where the stroke does, so it
+// must be filled with FillRuleWinding.
+func (dc *Context) StrokeToPath() {
+	outline := dc.strokeOutline().Transform(dc.matrix.Invert())
+	dc.ClearPath()
+	dc.AppendPath(outline)
+}
+
+// Stroke returns the outline of the area covered by stroking the path with
+// the specified line width, cap, join and dash pattern. Miter joins use the
+// default miter limit of 10. The outline must be filled with
+// FillRuleWinding.
+func (p *Path) Stroke(width float64, lineCap LineCap, lineJoin LineJoin, dashes ...float64) *Path {
+	path := rasterPath(dashPath(p.flatten(), dashes, 0))
+	adder := pathAdder{NewPath()}
+	raster.Stroke(adder, path, fix(width), lineCapper(lineCap), lineJoiner(lineJoin, 10))
+	return adder.path
+}
+
+// Offset returns the outline of the area filled by the path, with the
+// nonzero winding rule, grown by distance in every direction, or shrunk if
+// distance is negative. The corners that get farther from the path are
+// rounded, mitered or beveled as specified by join, using a miter limit of
+// 10.
+func (p *Path) Offset(distance float64, join LineJoin) *Path {
+	area := p.Union(NewPath(), FillRuleWinding)
+	if distance == 0 {
+		return area
+	}
+	// the subpaths are closed and go around to their second point again so
+	// that every corner, including the first one, gets a join
+	var paths [][]Point
+	for _, points := range p.flatten() {
+		if len(points) < 2 {
+			continue
+		}
+		if points[0] != points[len(points)-1] {
+			points = append(points, points[0])
+		}
+		paths = append(paths, append(points, points[1]))
+	}
+	adder := pathAdder{NewPath()}
+	raster.Stroke(adder, rasterPath(paths), fix(2*math.Abs(distance)), raster.ButtCapper, lineJoiner(join, 10))
+	if distance > 0 {
+		return area.Union(adder.path, FillRuleWinding)
+	}
+	return area.Difference(adder.path, FillRuleWinding)
+}
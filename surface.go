@@ -0,0 +1,116 @@
+package gg
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/font"
+)
+
+// surface is implemented by the vector output backends. A Context that has
+// a surface still rasterizes every operation into its image, but it also
+// forwards the operation to the surface. Paths are always given in device
+// space, i.e. they have already been transformed by the context's matrix.
+type surface interface {
+	// fill records a fill of the path with the given pattern.
+	fill(dc *Context, path *Path, rule FillRule, pattern Pattern)
+
+	// stroke records a stroke of the path with the given pattern, using the
+	// line width, cap, join and dash settings of the context.
+	stroke(dc *Context, path *Path, pattern Pattern)
+
+	// clip intersects the current clipping region with the path.
+	clip(dc *Context, path *Path, rule FillRule)
+
+	// setMask replaces the clipping region with the alpha mask. A nil mask
+	// removes all clipping.
+	setMask(mask *image.Alpha)
+
+	// clear discards everything drawn so far and fills the surface with c.
+	clear(c color.Color)
+
+	// drawImage records the image, with m mapping image space to device
+	// space.
+	drawImage(dc *Context, im image.Image, m Matrix)
+
+	// drawString records the text with its baseline origin at x, y in user
+	// space, using the font face and fill style of the context.
+	drawString(dc *Context, s string, x, y float64)
+
+	// pushGroup starts recording the operations of a group, which starts
+	// without clipping, separately from the operations before it.
+	pushGroup()
+
+	// popGroup ends the group started by the last pushGroup and restores the
+	// clipping region from before it. If paint is true, the group is drawn
+	// as a whole with the global alpha, operator and clipping of the
+	// context, otherwise it is discarded.
+	popGroup(dc *Context, paint bool)
+
+	// replace discards everything recorded on the page, or in the current
+	// group, and records the image in its place, unclipped.
+	replace(im image.Image)
+}
+
+// recordRaster records the image of the context in place of the operation
+// just drawn, if the operator is a Porter-Duff operator other than
+// OperatorOver, and reports whether it did. SVG and PDF have no equivalent
+// for those operators, so the result they give is only known as pixels. The
+// context must have a surface.
+func (dc *Context) recordRaster() bool {
+	if dc.operator == OperatorOver || dc.operator.isBlendMode() {
+		return false
+	}
+	dc.surface.replace(dc.im.SubImage(opaqueBounds(dc.im)))
+	return true
+}
+
+// textBounds returns a box around the text drawn at x, y in user space, in
+// device space, for sampling the fill style over the text. It is as tall as
+// the tallest of the current face and its fallbacks and is grown
+// horizontally to make room for glyphs that extend past their advance.
+func textBounds(dc *Context, s string, x, y float64) *Path {
+	w, _ := dc.MeasureString(s)
+	var ascent, descent float64
+	for _, face := range append([]font.Face{dc.fontFace}, dc.fontFallbacks...) {
+		m := face.Metrics()
+		ascent = math.Max(ascent, unfix(m.Ascent))
+		descent = math.Max(descent, unfix(m.Descent))
+	}
+	p := NewPath()
+	p.DrawRectangle(x-ascent/2, y-ascent, w+ascent, ascent+descent)
+	return p.Transform(dc.matrix)
+}
+
+// patternImage samples the pattern over the rectangle r and returns the
+// result as an image. The vector backends use it for patterns that have no
+// native representation.
+func patternImage(p Pattern, r image.Rectangle) *image.RGBA {
+	im := image.NewRGBA(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			im.Set(x, y, p.ColorAt(x, y))
+		}
+	}
+	return im
+}
+
+// pathBounds returns the integer bounding box of the path, clipped to the
+// specified width and height.
+func pathBounds(path *Path, width, height int) image.Rectangle {
+	var r image.Rectangle
+	first := true
+	for _, points := range path.flatten() {
+		for _, p := range points {
+			q := image.Rect(int(p.X-1), int(p.Y-1), int(p.X+2), int(p.Y+2))
+			if first {
+				r = q
+				first = false
+			} else {
+				r = r.Union(q)
+			}
+		}
+	}
+	return r.Intersect(image.Rect(0, 0, width, height))
+}
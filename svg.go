@@ -0,0 +1,471 @@
+package gg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+)
+
+// NewSVGContext creates a new context with the specified width and height
+// that records its drawing operations so that they can be written out as an
+// SVG document with EncodeSVG or SaveSVG. The operations are rasterized as
+// usual, so Image still returns the rendered image.
+func NewSVGContext(width, height int) *Context {
+	dc := NewContext(width, height)
+	dc.surface = newSVGSurface(width, height)
+	return dc
+}
+
+// SaveSVG writes the recorded drawing operations to disk as an SVG document.
+// The context must have been created with NewSVGContext.
+func (dc *Context) SaveSVG(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return dc.EncodeSVG(file)
+}
+
+// EncodeSVG writes the recorded drawing operations to the provided io.Writer
+// as an SVG document. The context must have been created with NewSVGContext.
+func (dc *Context) EncodeSVG(w io.Writer) error {
+	s, ok := dc.surface.(*svgSurface)
+	if !ok {
+		return errors.New("context was not created with NewSVGContext")
+	}
+	return s.encode(w)
+}
+
+type svgSurface struct {
+	width  int
+	height int
+	defs   bytes.Buffer
+	body   bytes.Buffer
+	ids    int
+	clipID string
+	maskID string
+	groups []svgGroup
+}
+
+// svgGroup is a group being recorded: where its elements start in the body
+// and the clipping region from before it.
+type svgGroup struct {
+	start          int
+	clipID, maskID string
+}
+
+func newSVGSurface(width, height int) *svgSurface {
+	return &svgSurface{width: width, height: height}
+}
+
+func (s *svgSurface) encode(w io.Writer) error {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" `+
+		`xmlns:xlink="http://www.w3.org/1999/xlink" `+
+		`width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		s.width, s.height, s.width, s.height)
+	if s.defs.Len() > 0 {
+		b.WriteString("<defs>\n")
+		b.Write(s.defs.Bytes())
+		b.WriteString("</defs>\n")
+	}
+	b.Write(s.body.Bytes())
+	b.WriteString("</svg>\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func (s *svgSurface) nextID(prefix string) string {
+	s.ids++
+	return prefix + strconv.Itoa(s.ids)
+}
+
+// svgBlendModes maps the blend mode operators to CSS mix-blend-mode values.
+// The Porter-Duff operators have no SVG equivalent, see recordRaster.
+var svgBlendModes = map[Operator]string{
+	OperatorMultiply:   "multiply",
+	OperatorScreen:     "screen",
+	OperatorOverlay:    "overlay",
+	OperatorDarken:     "darken",
+	OperatorLighten:    "lighten",
+	OperatorColorDodge: "color-dodge",
+	OperatorColorBurn:  "color-burn",
+	OperatorHardLight:  "hard-light",
+	OperatorSoftLight:  "soft-light",
+	OperatorDifference: "difference",
+	OperatorExclusion:  "exclusion",
+	OperatorHue:        "hue",
+	OperatorSaturation: "saturation",
+	OperatorColor:      "color",
+	OperatorLuminosity: "luminosity",
+}
+
+// attrs returns the attributes that apply the current clipping region and
+// the global alpha and blend mode of the context to an element.
+func (s *svgSurface) attrs(dc *Context) string {
+	var b strings.Builder
+	if dc.globalAlpha < 1 {
+		fmt.Fprintf(&b, ` opacity="%s"`, svgFloat(dc.globalAlpha))
+	}
+	if mode, ok := svgBlendModes[dc.operator]; ok {
+		fmt.Fprintf(&b, ` style="mix-blend-mode:%s"`, mode)
+	}
+	if s.clipID != "" {
+		fmt.Fprintf(&b, ` clip-path="url(#%s)"`, s.clipID)
+	}
+	if s.maskID != "" {
+		fmt.Fprintf(&b, ` mask="url(#%s)"`, s.maskID)
+	}
+	return b.String()
+}
+
+// paint returns an SVG paint value and opacity for the pattern. Patterns
+// without an SVG equivalent are sampled over the bounds of the path, grown by
+// pad pixels, and embedded as an image.
+func (s *svgSurface) paint(pattern Pattern, path *Path, pad int) (string, float64) {
+	base, m := untransformPattern(pattern)
+	switch p := base.(type) {
+	case *solidPattern:
+		return svgColor(p.color)
+	case *linearGradient:
+		if len(p.stops) > 0 {
+			id := s.nextID("gradient")
+			fmt.Fprintf(&s.defs, `<linearGradient id="%s" gradientUnits="userSpaceOnUse" x1="%s" y1="%s" x2="%s" y2="%s"%s%s>`+"\n",
+				id, svgFloat(p.x0), svgFloat(p.y0), svgFloat(p.x1), svgFloat(p.y1),
+				svgSpread(p.extend), svgGradientTransform(p.matrix.Multiply(m)))
+			s.writeStops(p.vectorStops(p.stops))
+			s.defs.WriteString("</linearGradient>\n")
+			return "url(#" + id + ")", 1
+		}
+	case *radialGradient:
+		if len(p.stops) > 0 {
+			id := s.nextID("gradient")
+			fmt.Fprintf(&s.defs, `<radialGradient id="%s" gradientUnits="userSpaceOnUse" cx="%s" cy="%s" r="%s" fx="%s" fy="%s" fr="%s"%s%s>`+"\n",
+				id, svgFloat(p.c1.x), svgFloat(p.c1.y), svgFloat(p.c1.r),
+				svgFloat(p.c0.x), svgFloat(p.c0.y), svgFloat(p.c0.r),
+				svgSpread(p.extend), svgGradientTransform(p.matrix.Multiply(m)))
+			s.writeStops(p.vectorStops(p.stops))
+			s.defs.WriteString("</radialGradient>\n")
+			return "url(#" + id + ")", 1
+		}
+	case *tilePattern:
+		if p.size > 0 {
+			size, shapes := p.tile()
+			id := s.nextID("pattern")
+			fmt.Fprintf(&s.defs, `<pattern id="%s" patternUnits="userSpaceOnUse" width="%s" height="%s" patternTransform="%s">`+"\n",
+				id, svgFloat(size), svgFloat(size), svgMatrix(Rotate(Radians(p.angle)).Multiply(m)))
+			if p.bg[3] > 0 {
+				c, a := svgColor(p.bgColor)
+				fmt.Fprintf(&s.defs, `<rect width="%s" height="%s" fill="%s"`, svgFloat(size), svgFloat(size), c)
+				if a < 1 {
+					fmt.Fprintf(&s.defs, ` fill-opacity="%s"`, svgFloat(a))
+				}
+				s.defs.WriteString("/>\n")
+			}
+			if p.fg[3] > 0 {
+				c, a := svgColor(p.fgColor)
+				fmt.Fprintf(&s.defs, `<path d="%s" fill="%s"`, svgPathData(shapes), c)
+				if a < 1 {
+					fmt.Fprintf(&s.defs, ` fill-opacity="%s"`, svgFloat(a))
+				}
+				s.defs.WriteString("/>\n")
+			}
+			s.defs.WriteString("</pattern>\n")
+			return "url(#" + id + ")", 1
+		}
+	}
+	r := pathBounds(path, s.width, s.height).Inset(-pad)
+	r = r.Intersect(image.Rect(0, 0, s.width, s.height))
+	if r.Empty() {
+		return "none", 1
+	}
+	id := s.nextID("pattern")
+	fmt.Fprintf(&s.defs, `<pattern id="%s" patternUnits="userSpaceOnUse" x="%d" y="%d" width="%d" height="%d">`+"\n",
+		id, r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+	fmt.Fprintf(&s.defs, `<image x="%d" y="%d" width="%d" height="%d" xlink:href="%s"/>`+"\n",
+		r.Min.X, r.Min.Y, r.Dx(), r.Dy(), svgImageData(patternImage(pattern, r)))
+	s.defs.WriteString("</pattern>\n")
+	return "url(#" + id + ")", 1
+}
+
+// svgSpread returns the spreadMethod attribute for the extend mode.
+func svgSpread(extend Extend) string {
+	switch extend {
+	case ExtendRepeat:
+		return ` spreadMethod="repeat"`
+	case ExtendReflect:
+		return ` spreadMethod="reflect"`
+	}
+	return ""
+}
+
+// svgGradientTransform returns the gradientTransform attribute for the
+// matrix, if it is not the identity.
+func svgGradientTransform(m Matrix) string {
+	if m == Identity() {
+		return ""
+	}
+	return ` gradientTransform="` + svgMatrix(m) + `"`
+}
+
+func (s *svgSurface) writeStops(stops stops) {
+	for _, stop := range stops {
+		c, a := svgColor(stop.color)
+		offset := math.Max(0, math.Min(1, stop.pos))
+		fmt.Fprintf(&s.defs, `<stop offset="%s" stop-color="%s"`, svgFloat(offset), c)
+		if a < 1 {
+			fmt.Fprintf(&s.defs, ` stop-opacity="%s"`, svgFloat(a))
+		}
+		s.defs.WriteString("/>\n")
+	}
+}
+
+func (s *svgSurface) fill(dc *Context, path *Path, rule FillRule, pattern Pattern) {
+	d := svgPathData(path)
+	if d == "" {
+		return
+	}
+	paint, opacity := s.paint(pattern, path, 0)
+	fmt.Fprintf(&s.body, `<path d="%s" fill="%s"`, d, paint)
+	if opacity < 1 {
+		fmt.Fprintf(&s.body, ` fill-opacity="%s"`, svgFloat(opacity))
+	}
+	if rule == FillRuleEvenOdd {
+		s.body.WriteString(` fill-rule="evenodd"`)
+	}
+	s.body.WriteString(s.attrs(dc))
+	s.body.WriteString("/>\n")
+}
+
+func (s *svgSurface) stroke(dc *Context, path *Path, pattern Pattern) {
+	d := svgPathData(path)
+	if d == "" {
+		return
+	}
+	paint, opacity := s.paint(pattern, path, int(math.Ceil(dc.lineWidth)))
+	fmt.Fprintf(&s.body, `<path d="%s" fill="none" stroke="%s"`, d, paint)
+	if opacity < 1 {
+		fmt.Fprintf(&s.body, ` stroke-opacity="%s"`, svgFloat(opacity))
+	}
+	fmt.Fprintf(&s.body, ` stroke-width="%s"`, svgFloat(dc.lineWidth))
+	switch dc.lineCap {
+	case LineCapRound:
+		s.body.WriteString(` stroke-linecap="round"`)
+	case LineCapButt:
+		s.body.WriteString(` stroke-linecap="butt"`)
+	case LineCapSquare:
+		s.body.WriteString(` stroke-linecap="square"`)
+	}
+	switch dc.lineJoin {
+	case LineJoinRound:
+		s.body.WriteString(` stroke-linejoin="round"`)
+	case LineJoinBevel:
+		s.body.WriteString(` stroke-linejoin="bevel"`)
+	case LineJoinMiter:
+		fmt.Fprintf(&s.body, ` stroke-linejoin="miter" stroke-miterlimit="%s"`, svgFloat(dc.miterLimit))
+	}
+	if len(dc.dashes) > 0 {
+		dashes := make([]string, len(dc.dashes))
+		for i, x := range dc.dashes {
+			dashes[i] = svgFloat(x)
+		}
+		fmt.Fprintf(&s.body, ` stroke-dasharray="%s"`, strings.Join(dashes, " "))
+		if dc.dashOffset != 0 {
+			fmt.Fprintf(&s.body, ` stroke-dashoffset="%s"`, svgFloat(dc.dashOffset))
+		}
+	}
+	s.body.WriteString(s.attrs(dc))
+	s.body.WriteString("/>\n")
+}
+
+func (s *svgSurface) clip(dc *Context, path *Path, rule FillRule) {
+	id := s.nextID("clip")
+	fmt.Fprintf(&s.defs, `<clipPath id="%s"`, id)
+	if s.clipID != "" {
+		fmt.Fprintf(&s.defs, ` clip-path="url(#%s)"`, s.clipID)
+	}
+	fmt.Fprintf(&s.defs, `><path d="%s"`, svgPathData(path))
+	if rule == FillRuleEvenOdd {
+		s.defs.WriteString(` clip-rule="evenodd"`)
+	}
+	s.defs.WriteString("/></clipPath>\n")
+	s.clipID = id
+}
+
+func (s *svgSurface) setMask(mask *image.Alpha) {
+	s.clipID = ""
+	s.maskID = ""
+	if mask == nil {
+		return
+	}
+	// SVG masks use luminance, so the alpha values become gray levels
+	b := mask.Bounds()
+	gray := &image.Gray{Pix: mask.Pix, Stride: mask.Stride, Rect: b}
+	id := s.nextID("mask")
+	fmt.Fprintf(&s.defs, `<mask id="%s" maskUnits="userSpaceOnUse" x="%d" y="%d" width="%d" height="%d">`+"\n",
+		id, b.Min.X, b.Min.Y, b.Dx(), b.Dy())
+	fmt.Fprintf(&s.defs, `<image x="%d" y="%d" width="%d" height="%d" xlink:href="%s"/>`+"\n",
+		b.Min.X, b.Min.Y, b.Dx(), b.Dy(), svgImageData(gray))
+	s.defs.WriteString("</mask>\n")
+	s.maskID = id
+}
+
+func (s *svgSurface) clear(c color.Color) {
+	if n := len(s.groups); n > 0 {
+		s.body.Truncate(s.groups[n-1].start)
+	} else {
+		s.body.Reset()
+	}
+	paint, opacity := svgColor(c)
+	if opacity == 0 {
+		return
+	}
+	fmt.Fprintf(&s.body, `<rect width="%d" height="%d" fill="%s"`, s.width, s.height, paint)
+	if opacity < 1 {
+		fmt.Fprintf(&s.body, ` fill-opacity="%s"`, svgFloat(opacity))
+	}
+	s.body.WriteString("/>\n")
+}
+
+func (s *svgSurface) pushGroup() {
+	s.groups = append(s.groups, svgGroup{s.body.Len(), s.clipID, s.maskID})
+	s.clipID, s.maskID = "", ""
+}
+
+func (s *svgSurface) popGroup(dc *Context, paint bool) {
+	g := s.groups[len(s.groups)-1]
+	s.groups = s.groups[:len(s.groups)-1]
+	content := append([]byte(nil), s.body.Bytes()[g.start:]...)
+	s.body.Truncate(g.start)
+	s.clipID, s.maskID = g.clipID, g.maskID
+	if !paint || len(content) == 0 {
+		return
+	}
+	fmt.Fprintf(&s.body, "<g%s>\n", s.attrs(dc))
+	s.body.Write(content)
+	s.body.WriteString("</g>\n")
+}
+
+func (s *svgSurface) replace(im image.Image) {
+	s.clear(color.Transparent)
+	b := im.Bounds()
+	if b.Empty() {
+		return
+	}
+	fmt.Fprintf(&s.body, `<image x="%d" y="%d" width="%d" height="%d" xlink:href="%s"/>`+"\n",
+		b.Min.X, b.Min.Y, b.Dx(), b.Dy(), svgImageData(im))
+}
+
+func (s *svgSurface) drawImage(dc *Context, im image.Image, m Matrix) {
+	b := im.Bounds()
+	fmt.Fprintf(&s.body, `<image transform="%s" x="%d" y="%d" width="%d" height="%d" xlink:href="%s"%s/>`+"\n",
+		svgMatrix(m), b.Min.X, b.Min.Y, b.Dx(), b.Dy(), svgImageData(im), s.attrs(dc))
+}
+
+func (s *svgSurface) drawString(dc *Context, str string, x, y float64) {
+	size := float64(dc.fontFace.Metrics().Height) / 64
+	if face, ok := dc.fontFace.(*trueTypeFace); ok {
+		size = face.points
+	}
+	// the fallbacks of the face become the fallbacks of the font family.
+	// Font names are quoted, as names with digits or punctuation must be,
+	// and the generic families are not
+	var families []string
+	seen := make(map[string]bool)
+	for _, face := range append([]font.Face{dc.fontFace}, dc.fontFallbacks...) {
+		family := "sans-serif"
+		switch face := face.(type) {
+		case *trueTypeFace:
+			if name := face.font.Name(truetype.NameIDFontFamily); name != "" {
+				family = svgFontName(name)
+			}
+		case *basicfont.Face:
+			family = "monospace"
+		}
+		if !seen[family] {
+			seen[family] = true
+			families = append(families, family)
+		}
+	}
+	family := strings.Join(families, ", ")
+	paint, opacity := s.paint(dc.fillPattern, textBounds(dc, str, x, y), 0)
+	fmt.Fprintf(&s.body, `<text transform="%s" x="%s" y="%s" font-family="%s" font-size="%s" fill="%s"`,
+		svgMatrix(dc.matrix), svgFloat(x), svgFloat(y), svgEscape(family), svgFloat(size), paint)
+	if opacity < 1 {
+		fmt.Fprintf(&s.body, ` fill-opacity="%s"`, svgFloat(opacity))
+	}
+	fmt.Fprintf(&s.body, ` xml:space="preserve"%s>%s</text>`+"\n", s.attrs(dc), svgEscape(str))
+}
+
+// svgFontName quotes a font name as a CSS string.
+func svgFontName(name string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(name) + "'"
+}
+
+func svgPathData(path *Path) string {
+	var b strings.Builder
+	for _, s := range path.segments {
+		switch s.Type {
+		case SegmentMoveTo:
+			b.WriteString("M")
+		case SegmentLineTo:
+			b.WriteString("L")
+		case SegmentQuadraticTo:
+			b.WriteString("Q")
+		case SegmentCubicTo:
+			b.WriteString("C")
+		case SegmentClosePath:
+			b.WriteString("Z")
+		}
+		for i, p := range s.Points {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			fmt.Fprintf(&b, "%s %s", svgFloat(p.X), svgFloat(p.Y))
+		}
+	}
+	return b.String()
+}
+
+func svgFloat(x float64) string {
+	return strconv.FormatFloat(math.Round(x*1e6)/1e6, 'f', -1, 64)
+}
+
+func svgMatrix(m Matrix) string {
+	return fmt.Sprintf("matrix(%s %s %s %s %s %s)",
+		svgFloat(m.XX), svgFloat(m.YX), svgFloat(m.XY),
+		svgFloat(m.YY), svgFloat(m.X0), svgFloat(m.Y0))
+}
+
+func svgColor(c color.Color) (string, float64) {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("#%02x%02x%02x", n.R, n.G, n.B), float64(n.A) / 255
+}
+
+func svgImageData(im image.Image) string {
+	var b bytes.Buffer
+	png.Encode(&b, im)
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(b.Bytes())
+}
+
+func svgEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
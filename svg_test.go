@@ -0,0 +1,69 @@
+package gg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/color"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSVG(t *testing.T) {
+	dc := NewSVGContext(100, 100)
+	dc.DrawRectangle(0, 0, 80, 80)
+	dc.Clip()
+	linear := NewLinearGradient(0, 0, 100, 0)
+	linear.AddColorStop(0, color.RGBA{255, 0, 0, 255})
+	linear.AddColorStop(1, color.RGBA{0, 0, 255, 255})
+	dc.SetFillStyle(linear)
+	dc.DrawCircle(40, 40, 30)
+	dc.Fill()
+	radial := NewRadialGradient(50, 50, 0, 50, 50, 50)
+	radial.AddColorStop(0, color.RGBA{0, 255, 0, 255})
+	radial.AddColorStop(1, color.Black)
+	dc.SetStrokeStyle(radial)
+	dc.DrawLine(10, 10, 90, 90)
+	dc.Stroke()
+	dc.ResetClip()
+	dc.SetRGB(0, 0, 0)
+	const text = `a < b & "c"`
+	dc.DrawString(text, 10, 95)
+
+	var buf bytes.Buffer
+	if err := dc.EncodeSVG(&buf); err != nil {
+		t.Fatal(err)
+	}
+	elements := make(map[string]int)
+	var inText bool
+	var chars strings.Builder
+	decoder := xml.NewDecoder(&buf)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("expected well-formed XML, got %v", err)
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			elements[token.Name.Local]++
+			inText = token.Name.Local == "text"
+		case xml.EndElement:
+			inText = false
+		case xml.CharData:
+			if inText {
+				chars.Write(token)
+			}
+		}
+	}
+	for _, name := range []string{"svg", "path", "clipPath", "linearGradient", "radialGradient", "text"} {
+		if elements[name] == 0 {
+			t.Errorf("expected a <%s> element, got %v", name, elements)
+		}
+	}
+	if chars.String() != text {
+		t.Errorf("expected the text %q, got %q", text, chars.String())
+	}
+}
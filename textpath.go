@@ -0,0 +1,138 @@
+package gg
+
+import (
+	"image"
+	"math"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/fixed"
+)
+
+// TextPathSide is the side of the path that DrawStringOnPath puts the text
+// on, relative to the direction of the path.
+type TextPathSide int
+
+const (
+	// TextPathAbove puts the baseline of the text on the path.
+	TextPathAbove TextPathSide = iota
+	// TextPathBelow hangs the text from the path, with the top of the text
+	// on the path.
+	TextPathBelow
+)
+
+// TextPathOverflow is what DrawStringOnPath does with text that doesn't fit
+// on the path.
+type TextPathOverflow int
+
+const (
+	// TextPathClip leaves out the glyphs that are not entirely on the path.
+	TextPathClip TextPathOverflow = iota
+	// TextPathExtend continues the path in a straight line before its start
+	// and after its end.
+	TextPathExtend
+	// TextPathFit condenses the text horizontally until it fits.
+	TextPathFit
+)
+
+// SetTextPathSide sets the side of the path that DrawStringOnPath puts the
+// text on. The default is TextPathAbove.
+func (dc *Context) SetTextPathSide(side TextPathSide) {
+	dc.textPathSide = side
+}
+
+// SetTextPathOverflow sets what DrawStringOnPath does with text longer than
+// the path. The default is TextPathClip.
+func (dc *Context) SetTextPathOverflow(overflow TextPathOverflow) {
+	dc.textOverflow = overflow
+}
+
+type placedGlyph struct {
+	glyph  textGlyph
+	matrix Matrix
+}
+
+// DrawStringOnPath draws the text along the path, given in user space, or
+// along the current path if path is nil. Each glyph is rotated to follow
+// the direction of the path at its center. The text starts at the distance
+// offset along the path if align is AlignLeft, is centered there if align is
+// AlignCenter and ends there if align is AlignRight. See SetTextPathSide and
+// SetTextPathOverflow for more options.
+func (dc *Context) DrawStringOnPath(s string, path *Path, offset float64, align Align) {
+	dc.drawShadow(func() { dc.DrawStringOnPath(s, path, offset, align) })
+	if path == nil {
+		path = dc.CopyPath()
+	}
+	glyphs := dc.layoutStringOnPath(s, path, offset, align)
+	matrix := dc.matrix
+	defer func() { dc.matrix = matrix }()
+	dc.paintText(func(im draw.Image, src image.Image) {
+		for _, g := range glyphs {
+			dc.matrix = g.matrix
+			dc.drawGlyphs(im, src, []textGlyph{g.glyph}, fixed.Point26_6{})
+		}
+	})
+	if dc.surface != nil && !dc.recordRaster() {
+		// the surfaces get the text of each cluster
+		for _, g := range glyphs {
+			if g.glyph.text != "" {
+				dc.matrix = g.matrix
+				dc.surface.drawString(dc, g.glyph.text, 0, unfix(g.glyph.dot.Y))
+			}
+		}
+	}
+}
+
+// layoutStringOnPath returns the glyphs of the text with the matrices that
+// map their coordinates, with the origin on the baseline at the start of
+// the glyph, to device space.
+func (dc *Context) layoutStringOnPath(s string, path *Path, offset float64, align Align) []placedGlyph {
+	face := dc.fontFace
+	glyphs, total := dc.layoutText(s)
+	width := unfix(total)
+
+	length := path.Length()
+	var ax float64
+	switch align {
+	case AlignCenter:
+		ax = 0.5
+	case AlignRight:
+		ax = 1
+	}
+	scale := 1.0
+	if dc.textOverflow == TextPathFit && width > 0 {
+		available := length - offset
+		switch align {
+		case AlignCenter:
+			available = 2 * math.Min(offset, length-offset)
+		case AlignRight:
+			available = offset
+		}
+		scale = math.Max(0, math.Min(1, available/width))
+	}
+	start := offset - ax*width*scale
+
+	var shift float64
+	if dc.textPathSide == TextPathBelow {
+		shift = unfix(face.Metrics().Ascent)
+	}
+	var result []placedGlyph
+	for _, g := range glyphs {
+		advance := unfix(g.advance) * scale
+		d := start + unfix(g.dot.X)*scale + advance/2
+		if dc.textOverflow == TextPathClip && (d-advance/2 < -1e-9 || d+advance/2 > length+1e-9) {
+			continue
+		}
+		p, angle := path.PointAtLength(d)
+		// the straight continuation of the path before and after it
+		if d < 0 {
+			p = Point{p.X + d*math.Cos(angle), p.Y + d*math.Sin(angle)}
+		} else if d > length {
+			p = Point{p.X + (d-length)*math.Cos(angle), p.Y + (d-length)*math.Sin(angle)}
+		}
+		m := dc.matrix.Translate(p.X, p.Y).Rotate(angle).Translate(-advance/2, shift).Scale(scale, 1)
+		// the glyph keeps only its vertical offset from the baseline
+		g.dot.X = 0
+		result = append(result, placedGlyph{g, m})
+	}
+	return result
+}
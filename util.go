@@ -12,6 +12,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/golang/freetype/raster"
 	"github.com/golang/freetype/truetype"
 
 	"golang.org/x/image/font"
@@ -134,6 +135,12 @@ func LoadFontFace(path string, points float64) (font.Face, error) {
 	if err != nil {
 		return nil, err
 	}
+	return ParseFontFace(fontBytes, points)
+}
+
+// ParseFontFace is like LoadFontFace but parses the font from the bytes of a
+// TrueType font file, such as the fonts in golang.org/x/image/font/gofont.
+func ParseFontFace(fontBytes []byte, points float64) (font.Face, error) {
 	f, err := truetype.Parse(fontBytes)
 	if err != nil {
 		return nil, err
@@ -142,5 +149,24 @@ func LoadFontFace(path string, points float64) (font.Face, error) {
 		Size: points,
 		// Hinting: font.HintingFull,
 	})
-	return face, nil
+	return &trueTypeFace{Face: face, font: f, data: fontBytes, points: points}, nil
+}
+
+// trueTypeFace is the font.Face returned by LoadFontFace and ParseFontFace.
+// It keeps the parsed font and its raw bytes around so that the vector
+// backends can refer to the font or embed it and TextPath can use the glyph
+// outlines. Text is shaped and drawn by glyph index, see shape.go, with the
+// state for that created on first use.
+type trueTypeFace struct {
+	font.Face
+	font   *truetype.Font
+	data   []byte
+	points float64
+
+	ot           *otFont
+	glyph        truetype.GlyphBuf
+	glyphMetrics map[truetype.Index]glyphMetrics
+	glyphMasks   map[glyphMaskKey]glyphMask
+	raster       *raster.Rasterizer
+	canvas       *image.Alpha
 }